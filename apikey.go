@@ -0,0 +1,235 @@
+package hi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// Keys the APIKeyAuth middleware stores the principal and the scopes of a request under.
+const (
+	APIKeyPrincipalKey = "api_key_principal"
+	APIKeyScopesKey    = "api_key_scopes"
+)
+
+// API key errors, recorded in the context errors of the rejected requests.
+var (
+	ErrAPIKeyMissing = errors.New("api key missing")
+	ErrAPIKeyInvalid = errors.New("api key invalid")
+	ErrAPIKeyScope   = errors.New("api key scope insufficient")
+)
+
+// APIKeySource extracts the API key of a request, returning "" if there is none.
+type APIKeySource func(c IContext) string
+
+// APIKeyFromHeader reads the API key from the request header name.
+func APIKeyFromHeader(name string) APIKeySource {
+	return func(c IContext) string {
+		return c.Req().Header.Get(name)
+	}
+}
+
+// APIKeyFromQuery reads the API key from the query parameter name.
+func APIKeyFromQuery(name string) APIKeySource {
+	return func(c IContext) string {
+		return c.Req().URL.Query().Get(name)
+	}
+}
+
+// APIKeyFromCookie reads the API key from the cookie name.
+func APIKeyFromCookie(name string) APIKeySource {
+	return func(c IContext) string {
+		if cookie, err := c.Req().Cookie(name); err == nil {
+			return cookie.Value
+		}
+		return ""
+	}
+}
+
+// APIKeyInfo describes the owner of an API key.
+type APIKeyInfo struct {
+	// Principal identifies the owner, it is set to APIKeyPrincipalKey and AuthUserKey.
+	Principal any
+	// Scopes are the permissions granted to the key.
+	Scopes []string
+}
+
+// APIKeyStore looks API keys up.
+type APIKeyStore interface {
+	// Lookup returns the owner of key, ok is false for unknown keys.
+	Lookup(ctx context.Context, key string) (info APIKeyInfo, ok bool, err error)
+}
+
+// HashAPIKey returns the hex SHA-256 of key, the form keys are kept in by MemoryAPIKeyStore.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryAPIKeyStore is an in-memory APIKeyStore. Keys are only kept hashed, and looked up by
+// hash so that the lookup time does not depend on how much of a key matches. It is safe for
+// concurrent use.
+type MemoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[[sha256.Size]byte]APIKeyInfo
+}
+
+var _ APIKeyStore = (*MemoryAPIKeyStore)(nil)
+
+// NewMemoryAPIKeyStore returns an empty MemoryAPIKeyStore.
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{keys: make(map[[sha256.Size]byte]APIKeyInfo)}
+}
+
+// Add registers key for principal with scopes.
+func (s *MemoryAPIKeyStore) Add(key string, principal any, scopes ...string) {
+	s.set(sha256.Sum256([]byte(key)), APIKeyInfo{Principal: principal, Scopes: scopes})
+}
+
+// AddHash registers the key of HashAPIKey hash for principal with scopes, so that the keys
+// themselves need not be stored in the configuration.
+func (s *MemoryAPIKeyStore) AddHash(hash string, principal any, scopes ...string) error {
+	var sum [sha256.Size]byte
+	if n, err := hex.Decode(sum[:], []byte(hash)); err != nil || n != sha256.Size {
+		return errors.New("invalid api key hash")
+	}
+	s.set(sum, APIKeyInfo{Principal: principal, Scopes: scopes})
+	return nil
+}
+
+// Remove revokes key.
+func (s *MemoryAPIKeyStore) Remove(key string) {
+	s.mu.Lock()
+	delete(s.keys, sha256.Sum256([]byte(key)))
+	s.mu.Unlock()
+}
+
+func (s *MemoryAPIKeyStore) set(sum [sha256.Size]byte, info APIKeyInfo) {
+	s.mu.Lock()
+	s.keys[sum] = info
+	s.mu.Unlock()
+}
+
+// Lookup implements the APIKeyStore interface.
+func (s *MemoryAPIKeyStore) Lookup(_ context.Context, key string) (APIKeyInfo, bool, error) {
+	sum := sha256.Sum256([]byte(key))
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	info, ok := s.keys[sum]
+	return info, ok, nil
+}
+
+// APIKeyConfig defines the config for APIKeyAuth middleware.
+type APIKeyConfig struct {
+	// Store looks the keys up, see MemoryAPIKeyStore.
+	Store APIKeyStore
+
+	// Sources extract the key, the first one finding a key wins.
+	// Optional. Default value reads the X-API-Key header.
+	Sources []APIKeySource
+
+	// Scopes are required from every key, see also RequireScopes.
+	// Optional.
+	Scopes []string
+
+	// Unauthorized answers the requests without a valid key, err is ErrAPIKeyMissing,
+	// ErrAPIKeyInvalid or the store error.
+	// Optional. Default value aborts with status 401, 500 for store errors.
+	Unauthorized func(c IContext, err error)
+
+	// Skip is a Skipper that indicates which requests are not authenticated.
+	// Optional.
+	Skip Skipper
+}
+
+// APIKeyAuth returns an API key authentication middleware reading the X-API-Key header and
+// looking the keys up in store. The key must grant all scopes.
+func APIKeyAuth[T IContext](store APIKeyStore, scopes ...string) HandlerFunc[T] {
+	return APIKeyAuthWithConfig[T](APIKeyConfig{Store: store, Scopes: scopes})
+}
+
+// APIKeyAuthWithConfig returns an APIKeyAuth middleware with config.
+//
+// The principal of the key is stored under APIKeyPrincipalKey and AuthUserKey, so that it
+// shows in the logs and RateLimitByUser accounts per key, and its scopes under
+// APIKeyScopesKey for RequireScopes.
+func APIKeyAuthWithConfig[T IContext](conf APIKeyConfig) HandlerFunc[T] {
+	assert1(conf.Store != nil, "api key store can not be nil")
+	if len(conf.Sources) == 0 {
+		conf.Sources = []APIKeySource{APIKeyFromHeader("X-API-Key")}
+	}
+	if conf.Unauthorized == nil {
+		conf.Unauthorized = defaultAPIKeyUnauthorized
+	}
+
+	return func(c T) {
+		if conf.Skip != nil && conf.Skip(c) {
+			return
+		}
+
+		var key string
+		for _, source := range conf.Sources {
+			if key = source(c); key != "" {
+				break
+			}
+		}
+		if key == "" {
+			conf.Unauthorized(c, ErrAPIKeyMissing)
+			return
+		}
+
+		info, ok, err := conf.Store.Lookup(c.Req().Context(), key)
+		if err == nil && !ok {
+			err = ErrAPIKeyInvalid
+		}
+		if err != nil {
+			conf.Unauthorized(c, err)
+			return
+		}
+
+		c.Set(APIKeyPrincipalKey, info.Principal)
+		c.Set(AuthUserKey, info.Principal)
+		c.Set(APIKeyScopesKey, info.Scopes)
+		if !hasScopes(info.Scopes, conf.Scopes) {
+			forbidScope(c)
+		}
+	}
+}
+
+// RequireScopes returns a middleware rejecting with 403 the requests whose API key does not
+// grant all scopes. Attach it to the routes or groups behind APIKeyAuth.
+func RequireScopes[T IContext](scopes ...string) HandlerFunc[T] {
+	return func(c T) {
+		granted, _ := c.GetKeys()[APIKeyScopesKey].([]string)
+		if !hasScopes(granted, scopes) {
+			forbidScope(c)
+		}
+	}
+}
+
+func hasScopes(granted, required []string) bool {
+	for _, scope := range required {
+		if !slices.Contains(granted, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+func forbidScope(c IContext) {
+	_ = c.Error(ErrAPIKeyScope)
+	c.GetExecer().AbortWithStatus(http.StatusForbidden)
+}
+
+func defaultAPIKeyUnauthorized(c IContext, err error) {
+	_ = c.Error(err)
+	if err == ErrAPIKeyMissing || err == ErrAPIKeyInvalid {
+		c.GetExecer().AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	c.GetExecer().AbortWithStatus(http.StatusInternalServerError)
+}
@@ -0,0 +1,90 @@
+package hi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	store := NewMemoryAPIKeyStore()
+	store.Add("k-read", "partner-a", "orders:read")
+	require.NoError(t, store.AddHash(HashAPIKey("k-write"), "partner-b", "orders:read", "orders:write"))
+	assert.Error(t, store.AddHash("nothex", "partner-c"))
+
+	router := New(&Context{})
+	router.Use(APIKeyAuthWithConfig[*Context](APIKeyConfig{
+		Store: store,
+		Sources: []APIKeySource{
+			APIKeyFromHeader("X-API-Key"),
+			APIKeyFromQuery("api_key"),
+			APIKeyFromCookie("api_key"),
+		},
+		Scopes: []string{"orders:read"},
+	}))
+	handler := func(c *Context) {
+		c.String(http.StatusOK, fmt.Sprint(c.GetKeys()[APIKeyPrincipalKey], " ", c.GetKeys()[AuthUserKey]))
+	}
+	router.GET("/orders", handler)
+	writes := router.Group("/orders", RequireScopes[*Context]("orders:write"))
+	writes.POST("", handler)
+
+	w := PerformRequest(router, http.MethodGet, "/orders", header{"X-API-Key", "k-read"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "partner-a partner-a", w.Body.String())
+
+	w = PerformRequest(router, http.MethodGet, "/orders?api_key=k-write")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "partner-b partner-b", w.Body.String())
+
+	w = PerformRequest(router, http.MethodGet, "/orders", header{"Cookie", "api_key=k-read"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = PerformRequest(router, http.MethodPost, "/orders", header{"X-API-Key", "k-read"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = PerformRequest(router, http.MethodPost, "/orders", header{"X-API-Key", "k-write"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = PerformRequest(router, http.MethodGet, "/orders")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = PerformRequest(router, http.MethodGet, "/orders", header{"X-API-Key", "unknown"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	store.Remove("k-read")
+	w = PerformRequest(router, http.MethodGet, "/orders", header{"X-API-Key", "k-read"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+type failingAPIKeyStore struct{}
+
+func (failingAPIKeyStore) Lookup(context.Context, string) (APIKeyInfo, bool, error) {
+	return APIKeyInfo{}, false, errors.New("store down")
+}
+
+func TestAPIKeyAuthErrors(t *testing.T) {
+	var errs []error
+	router := New(&Context{})
+	router.Use(func(c *Context) {
+		c.Next()
+		for _, err := range c.GetErrors() {
+			errs = append(errs, err.Err)
+		}
+	})
+	router.Use(APIKeyAuth[*Context](failingAPIKeyStore{}))
+	router.GET("/", func(c *Context) {})
+
+	w := PerformRequest(router, http.MethodGet, "/", header{"X-API-Key", "k"})
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	w = PerformRequest(router, http.MethodGet, "/")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Len(t, errs, 2)
+	assert.EqualError(t, errs[0], "store down")
+	assert.ErrorIs(t, errs[1], ErrAPIKeyMissing)
+
+	assert.Panics(t, func() { APIKeyAuth[*Context](nil) })
+}
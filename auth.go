@@ -69,6 +69,30 @@ func BasicAuth[T IContext](accounts Accounts) HandlerFunc[T] {
 	return BasicAuthForRealm[T](accounts, "")
 }
 
+// BasicAuthWithVerifier returns a Basic HTTP Authorization middleware checking the credentials
+// with verify, see HashVerifier and HtpasswdFile. The identity returned by verify is set to
+// the key AuthUserKey. If the realm is empty, "Authorization Required" will be used by default.
+func BasicAuthWithVerifier[T IContext](verify Verifier, realm string) HandlerFunc[T] {
+	assert1(verify != nil, "verifier can not be nil")
+	if realm == "" {
+		realm = "Authorization Required"
+	}
+	realm = "Basic realm=" + strconv.Quote(realm)
+	return func(c T) {
+		user, pass, ok := c.Req().BasicAuth()
+		var identity any
+		if ok {
+			identity, ok = verify(user, pass)
+		}
+		if !ok {
+			c.GetExecer().Header("WWW-Authenticate", realm)
+			c.GetExecer().AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Set(AuthUserKey, identity)
+	}
+}
+
 func processAccounts(accounts Accounts) authPairs {
 	length := len(accounts)
 	assert1(length > 0, "Empty list of authorized credentials")
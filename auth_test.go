@@ -5,6 +5,7 @@
 package hi
 
 import (
+	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -176,3 +177,25 @@ func TestBasicAuthForProxy407(t *testing.T) {
 	// assert.Equal(t, http.StatusProxyAuthRequired, w.Code)
 	// assert.Equal(t, "Basic realm=\"Proxy Authorization Required\"", w.Header().Get("Proxy-Authenticate"))
 }
+
+func TestBasicAuthWithVerifier(t *testing.T) {
+	type account struct{ name string }
+	router := New(&Context{})
+	router.Use(BasicAuthWithVerifier[*Context](func(user, pass string) (any, bool) {
+		return &account{name: user}, user == "admin" && pass == "password"
+	}, ""))
+	router.GET("/login", func(c *Context) {
+		c.String(http.StatusOK, c.GetKeys()[AuthUserKey].(*account).name)
+	})
+
+	w := PerformRequest(router, http.MethodGet, "/login", header{"Authorization", authorizationHeader("admin", "password")})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "admin", w.Body.String())
+
+	w = PerformRequest(router, http.MethodGet, "/login", header{"Authorization", authorizationHeader("admin", "wrong")})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Basic realm="Authorization Required"`, w.Header().Get("WWW-Authenticate"))
+
+	w = PerformRequest(router, http.MethodGet, "/login")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,398 @@
+package hi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/nbcx/hi/binding"
+)
+
+// ErrForbidden is recorded in the context errors of the requests denied by an Authorizer,
+// wrapped with the reason of the decision.
+var ErrForbidden = errors.New("forbidden")
+
+// AuthzSubject is the principal an authorization decision is made for.
+type AuthzSubject struct {
+	ID         string
+	Roles      []string
+	Attributes map[string]string
+}
+
+// AuthzPrincipal is implemented by the principals stored under AuthUserKey that carry their
+// own roles and attributes.
+type AuthzPrincipal interface {
+	AuthzSubject() AuthzSubject
+}
+
+// AuthzRequest holds the attributes of a request a policy is evaluated against.
+type AuthzRequest struct {
+	Subject AuthzSubject
+	Method  string
+	// Route is the route template of the request, such as /users/:id.
+	Route  string
+	Host   string
+	Params map[string]string
+}
+
+// Attribute returns the attribute name of the request: method, route, host, param.<name>,
+// subject.id or subject.<attribute>.
+func (r *AuthzRequest) Attribute(name string) (string, bool) {
+	switch name {
+	case "method":
+		return r.Method, true
+	case "route":
+		return r.Route, true
+	case "host":
+		return r.Host, true
+	case "subject.id":
+		return r.Subject.ID, r.Subject.ID != ""
+	}
+	if param, ok := strings.CutPrefix(name, "param."); ok {
+		value, ok := r.Params[param]
+		return value, ok
+	}
+	if attr, ok := strings.CutPrefix(name, "subject."); ok {
+		value, ok := r.Subject.Attributes[attr]
+		return value, ok
+	}
+	return "", false
+}
+
+// Policy is an attribute-based rule, it returns nil to allow the request and an error
+// explaining the denial otherwise.
+type Policy func(r *AuthzRequest) error
+
+// AuthzDecision is the outcome of an authorization.
+type AuthzDecision struct {
+	Allowed bool
+	// Reason explains the decision.
+	Reason string
+}
+
+// Authorizer is a role and attribute based policy engine. Routes and groups declare what they
+// require with RequirePermissions and RequirePolicies; the Authorizer grants permissions to
+// roles and evaluates named policies against the subject and the request attributes.
+//
+// Rules are defined in code with Grant, Assign and DefinePolicy, or loaded from YAML or TOML,
+// see LoadRules. It is safe for concurrent use.
+type Authorizer struct {
+	// Subject resolves the subject of a request.
+	// Optional. Default value reads the principal under AuthUserKey: an AuthzPrincipal, or an
+	// ID whose roles are assigned with Assign.
+	Subject func(c IContext) (AuthzSubject, bool)
+
+	// Denied answers the denied requests.
+	// Optional. Default value aborts with status 403.
+	Denied func(c IContext, decision AuthzDecision)
+
+	mu       sync.RWMutex
+	roles    map[string]*authzRole
+	users    map[string][]string
+	policies map[string]Policy
+}
+
+type authzRole struct {
+	permissions []string
+	inherits    []string
+}
+
+// NewAuthorizer returns an Authorizer without rules.
+func NewAuthorizer() *Authorizer {
+	return &Authorizer{
+		roles:    make(map[string]*authzRole),
+		users:    make(map[string][]string),
+		policies: make(map[string]Policy),
+	}
+}
+
+// Grant grants permissions to role. A permission ending with "*" grants all permissions with
+// its prefix, "*" alone grants everything.
+func (a *Authorizer) Grant(role string, permissions ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.role(role).permissions = append(a.role(role).permissions, permissions...)
+}
+
+// Inherit makes role inherit the permissions of parents.
+func (a *Authorizer) Inherit(role string, parents ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.role(role).inherits = append(a.role(role).inherits, parents...)
+}
+
+// Assign assigns roles to the subject id.
+func (a *Authorizer) Assign(id string, roles ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.users[id] = append(a.users[id], roles...)
+}
+
+// DefinePolicy registers policy under name.
+func (a *Authorizer) DefinePolicy(name string, policy Policy) {
+	assert1(policy != nil, "policy can not be nil")
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.policies[name] = policy
+}
+
+func (a *Authorizer) role(name string) *authzRole {
+	r, ok := a.roles[name]
+	if !ok {
+		r = &authzRole{}
+		a.roles[name] = r
+	}
+	return r
+}
+
+// Decide decides whether r holds all permissions and satisfies all policies.
+func (a *Authorizer) Decide(r *AuthzRequest, permissions, policies []string) AuthzDecision {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	roles := append(slices.Clone(r.Subject.Roles), a.users[r.Subject.ID]...)
+	var reasons []string
+	for _, permission := range permissions {
+		role, ok := a.grantingRole(roles, permission, nil)
+		if !ok {
+			return AuthzDecision{Reason: fmt.Sprintf("permission %q not granted to %q (roles %v)", permission, r.Subject.ID, roles)}
+		}
+		reasons = append(reasons, fmt.Sprintf("permission %q granted by role %q", permission, role))
+	}
+	for _, name := range policies {
+		policy, ok := a.policies[name]
+		if !ok {
+			return AuthzDecision{Reason: fmt.Sprintf("policy %q is not defined", name)}
+		}
+		if err := policy(r); err != nil {
+			return AuthzDecision{Reason: fmt.Sprintf("policy %q: %v", name, err)}
+		}
+		reasons = append(reasons, fmt.Sprintf("policy %q satisfied", name))
+	}
+	return AuthzDecision{Allowed: true, Reason: strings.Join(reasons, ", ")}
+}
+
+// grantingRole returns the role of roles, or of their ancestors, granting permission.
+func (a *Authorizer) grantingRole(roles []string, permission string, seen map[string]bool) (string, bool) {
+	for _, name := range roles {
+		if seen[name] {
+			continue
+		}
+		r, ok := a.roles[name]
+		if !ok {
+			continue
+		}
+		for _, granted := range r.permissions {
+			if prefix, wildcard := strings.CutSuffix(granted, "*"); granted == permission ||
+				(wildcard && strings.HasPrefix(permission, prefix)) {
+				return name, true
+			}
+		}
+		if seen == nil {
+			seen = make(map[string]bool)
+		}
+		seen[name] = true
+		if _, ok := a.grantingRole(r.inherits, permission, seen); ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// subject resolves the subject of c.
+func (a *Authorizer) subject(c IContext) (AuthzSubject, bool) {
+	if a.Subject != nil {
+		return a.Subject(c)
+	}
+	switch p := c.GetKeys()[AuthUserKey].(type) {
+	case nil:
+		return AuthzSubject{}, false
+	case AuthzPrincipal:
+		return p.AuthzSubject(), true
+	case string:
+		return AuthzSubject{ID: p}, p != ""
+	default:
+		return AuthzSubject{ID: fmt.Sprint(p)}, true
+	}
+}
+
+func (a *Authorizer) authorize(c IContext, permissions, policies []string) {
+	subject, ok := a.subject(c)
+	var decision AuthzDecision
+	if !ok {
+		decision.Reason = "no authenticated subject"
+	} else {
+		exec := c.GetExecer()
+		r := &AuthzRequest{
+			Subject: subject,
+			Method:  c.Req().Method,
+			Route:   exec.FullPath(),
+			Host:    c.Req().Host,
+			Params:  make(map[string]string),
+		}
+		for _, param := range exec.GetParams() {
+			r.Params[param.Key] = param.Value
+		}
+		decision = a.Decide(r, permissions, policies)
+	}
+
+	if IsDebugging() {
+		verdict := "deny"
+		if decision.Allowed {
+			verdict = "allow"
+		}
+		debugPrint("authz %s %s %s: %s: %s\n", verdict, c.Req().Method, c.GetExecer().FullPath(), subject.ID, decision.Reason)
+	}
+	if decision.Allowed {
+		return
+	}
+	if a.Denied != nil {
+		a.Denied(c, decision)
+		return
+	}
+	_ = c.Error(fmt.Errorf("%w: %s", ErrForbidden, decision.Reason))
+	c.GetExecer().AbortWithStatus(http.StatusForbidden)
+}
+
+// RequirePermissions returns a middleware letting through the requests whose subject holds
+// all permissions in a, and sending the others to the Denied handler of a. Attach it to the
+// routes or groups requiring the permissions, behind the authentication middleware.
+func RequirePermissions[T IContext](a *Authorizer, permissions ...string) HandlerFunc[T] {
+	assert1(a != nil, "authorizer can not be nil")
+	return func(c T) {
+		a.authorize(c, permissions, nil)
+	}
+}
+
+// RequirePolicies returns a middleware letting through the requests satisfying all the named
+// policies of a, and sending the others to the Denied handler of a.
+func RequirePolicies[T IContext](a *Authorizer, policies ...string) HandlerFunc[T] {
+	assert1(a != nil, "authorizer can not be nil")
+	return func(c T) {
+		a.authorize(c, nil, policies)
+	}
+}
+
+// AuthzRules are the rules of an Authorizer, as loaded by LoadRules.
+//
+//	roles:
+//	  viewer:
+//	    permissions: ["orders:read"]
+//	  editor:
+//	    inherits: [viewer]
+//	    permissions: ["orders:*"]
+//	users:
+//	  alice: [editor]
+//	policies:
+//	  owner:
+//	    - attribute: param.user
+//	      equals_attribute: subject.id
+//	  read-only:
+//	    - attribute: method
+//	      in: [GET, HEAD]
+type AuthzRules struct {
+	Roles    map[string]AuthzRoleRules   `yaml:"roles" toml:"roles"`
+	Users    map[string][]string         `yaml:"users" toml:"users"`
+	Policies map[string][]AuthzCondition `yaml:"policies" toml:"policies"`
+}
+
+// AuthzRoleRules defines a role of AuthzRules.
+type AuthzRoleRules struct {
+	Permissions []string `yaml:"permissions" toml:"permissions"`
+	Inherits    []string `yaml:"inherits" toml:"inherits"`
+}
+
+// AuthzCondition is a condition on an attribute of the request, see AuthzRequest.Attribute.
+// A policy of AuthzRules is satisfied when all its conditions are.
+type AuthzCondition struct {
+	Attribute string `yaml:"attribute" toml:"attribute"`
+	// Equals compares the attribute to a value.
+	Equals string `yaml:"equals" toml:"equals"`
+	// EqualsAttribute compares the attribute to another attribute.
+	EqualsAttribute string `yaml:"equals_attribute" toml:"equals_attribute"`
+	// In compares the attribute to a list of values.
+	In []string `yaml:"in" toml:"in"`
+}
+
+func (cond AuthzCondition) check(r *AuthzRequest) error {
+	value, ok := r.Attribute(cond.Attribute)
+	if !ok {
+		return fmt.Errorf("attribute %s is missing", cond.Attribute)
+	}
+	switch {
+	case cond.EqualsAttribute != "":
+		other, ok := r.Attribute(cond.EqualsAttribute)
+		if !ok || value != other {
+			return fmt.Errorf("%s %q does not equal %s %q", cond.Attribute, value, cond.EqualsAttribute, other)
+		}
+	case len(cond.In) > 0:
+		if !slices.Contains(cond.In, value) {
+			return fmt.Errorf("%s %q is not in %v", cond.Attribute, value, cond.In)
+		}
+	default:
+		if value != cond.Equals {
+			return fmt.Errorf("%s %q does not equal %q", cond.Attribute, value, cond.Equals)
+		}
+	}
+	return nil
+}
+
+// Load adds rules to a.
+func (a *Authorizer) Load(rules AuthzRules) {
+	for name, role := range rules.Roles {
+		a.Grant(name, role.Permissions...)
+		a.Inherit(name, role.Inherits...)
+	}
+	for id, roles := range rules.Users {
+		a.Assign(id, roles...)
+	}
+	for name, conditions := range rules.Policies {
+		a.DefinePolicy(name, func(r *AuthzRequest) error {
+			for _, cond := range conditions {
+				if err := cond.check(r); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// LoadRules decodes AuthzRules from data with b, such as binding.YAML or binding.TOML, and
+// adds them to a.
+func (a *Authorizer) LoadRules(b binding.BindingBody, data []byte) error {
+	var rules AuthzRules
+	if err := b.BindBody(data, &rules); err != nil {
+		return err
+	}
+	for name, conditions := range rules.Policies {
+		for _, cond := range conditions {
+			if cond.Attribute == "" {
+				return fmt.Errorf("policy %q: condition without attribute", name)
+			}
+		}
+	}
+	a.Load(rules)
+	return nil
+}
+
+// LoadRulesFile loads the rules of the YAML (.yaml, .yml) or TOML (.toml) file at path.
+func (a *Authorizer) LoadRulesFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		return a.LoadRules(binding.YAML, data)
+	case ".toml":
+		return a.LoadRules(binding.TOML, data)
+	default:
+		return fmt.Errorf("unsupported rules file extension %q", ext)
+	}
+}
@@ -0,0 +1,172 @@
+package hi
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nbcx/hi/binding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type authzTestUser struct {
+	id   string
+	role string
+}
+
+func (u authzTestUser) AuthzSubject() AuthzSubject {
+	return AuthzSubject{ID: u.id, Roles: []string{u.role}, Attributes: map[string]string{"tenant": "acme"}}
+}
+
+const authzYAMLRules = `
+roles:
+  viewer:
+    permissions: ["orders:read"]
+  editor:
+    inherits: [viewer]
+    permissions: ["orders:write"]
+  admin:
+    permissions: ["*"]
+users:
+  alice: [editor]
+  bob: [viewer]
+policies:
+  owner:
+    - attribute: param.user
+      equals_attribute: subject.id
+  read-only:
+    - attribute: method
+      in: [GET, HEAD]
+`
+
+func authzRouter(a *Authorizer) *Engine[*Context] {
+	router := New(&Context{})
+	router.Use(func(c *Context) {
+		if user := c.Request.Header.Get("X-User"); user != "" {
+			c.Set(AuthUserKey, user)
+		}
+	})
+	ok := func(c *Context) { c.String(http.StatusOK, "ok") }
+	orders := router.Group("/orders", RequirePermissions[*Context](a, "orders:read"))
+	orders.GET("", ok)
+	orders.POST("", RequirePermissions[*Context](a, "orders:write"), ok)
+	orders.DELETE("", RequirePermissions[*Context](a, "orders:delete"), ok)
+	router.GET("/users/:user/profile", RequirePolicies[*Context](a, "owner", "read-only"), ok)
+	router.PUT("/users/:user/profile", RequirePolicies[*Context](a, "owner", "read-only"), ok)
+	return router
+}
+
+func TestAuthorizerRules(t *testing.T) {
+	a := NewAuthorizer()
+	require.NoError(t, a.LoadRules(binding.YAML, []byte(authzYAMLRules)))
+	router := authzRouter(a)
+
+	for _, tc := range []struct {
+		user, method, path string
+		status             int
+	}{
+		{"bob", http.MethodGet, "/orders", http.StatusOK},
+		{"bob", http.MethodPost, "/orders", http.StatusForbidden},
+		{"alice", http.MethodPost, "/orders", http.StatusOK},
+		{"alice", http.MethodDelete, "/orders", http.StatusForbidden},
+		{"mallory", http.MethodGet, "/orders", http.StatusForbidden},
+		{"", http.MethodGet, "/orders", http.StatusForbidden},
+		{"bob", http.MethodGet, "/users/bob/profile", http.StatusOK},
+		{"bob", http.MethodGet, "/users/alice/profile", http.StatusForbidden},
+		{"bob", http.MethodPut, "/users/bob/profile", http.StatusForbidden},
+	} {
+		w := PerformRequest(router, tc.method, tc.path, header{"X-User", tc.user})
+		assert.Equal(t, tc.status, w.Code, "%s %s %s", tc.user, tc.method, tc.path)
+	}
+
+	a.Assign("mallory", "admin")
+	w := PerformRequest(router, http.MethodDelete, "/orders", header{"X-User", "mallory"})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAuthorizerPrincipalAndDecision(t *testing.T) {
+	a := NewAuthorizer()
+	a.Grant("support", "orders:*")
+	a.DefinePolicy("same-tenant", func(r *AuthzRequest) error {
+		if tenant, _ := r.Attribute("subject.tenant"); tenant != r.Params["tenant"] {
+			return errors.New("other tenant")
+		}
+		return nil
+	})
+
+	var denied AuthzDecision
+	a.Denied = func(c IContext, decision AuthzDecision) {
+		denied = decision
+		c.GetExecer().AbortWithStatus(http.StatusNotFound)
+	}
+	router := New(&Context{})
+	router.Use(func(c *Context) { c.Set(AuthUserKey, authzTestUser{id: "carol", role: "support"}) })
+	router.GET("/:tenant/orders", RequirePermissions[*Context](a, "orders:read"), RequirePolicies[*Context](a, "same-tenant"),
+		func(c *Context) { c.String(http.StatusOK, "ok") })
+
+	w := PerformRequest(router, http.MethodGet, "/acme/orders")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = PerformRequest(router, http.MethodGet, "/globex/orders")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, AuthzDecision{Reason: `policy "same-tenant": other tenant`}, denied)
+
+	decision := a.Decide(&AuthzRequest{Subject: AuthzSubject{ID: "dave", Roles: []string{"support"}}},
+		[]string{"orders:refund", "users:read"}, nil)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, `permission "users:read" not granted to "dave" (roles [support])`, decision.Reason)
+
+	decision = a.Decide(&AuthzRequest{}, nil, []string{"undefined"})
+	assert.Equal(t, `policy "undefined" is not defined`, decision.Reason)
+}
+
+func TestAuthorizerDebugExplain(t *testing.T) {
+	a := NewAuthorizer()
+	a.Grant("viewer", "orders:read")
+	a.Assign("bob", "viewer")
+	router := authzRouter(a)
+
+	out := captureOutput(t, func() {
+		SetMode(DebugMode)
+		defer SetMode(TestMode)
+		PerformRequest(router, http.MethodGet, "/orders", header{"X-User", "bob"})
+		w := PerformRequest(router, http.MethodPost, "/orders", header{"X-User", "bob"})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+	assert.Contains(t, out, `authz allow GET /orders: bob: permission "orders:read" granted by role "viewer"`)
+	assert.Contains(t, out, `authz deny POST /orders: bob: permission "orders:write" not granted to "bob" (roles [viewer])`)
+}
+
+func TestAuthorizerLoadRulesFile(t *testing.T) {
+	dir := t.TempDir()
+	tomlFile := filepath.Join(dir, "rules.toml")
+	require.NoError(t, os.WriteFile(tomlFile, []byte(`
+[users]
+bob = ["viewer"]
+
+[roles.viewer]
+permissions = ["orders:read"]
+
+[[policies.read-only]]
+attribute = "method"
+in = ["GET"]
+`), 0o600))
+
+	a := NewAuthorizer()
+	require.NoError(t, a.LoadRulesFile(tomlFile))
+	decision := a.Decide(&AuthzRequest{Subject: AuthzSubject{ID: "bob"}, Method: http.MethodGet},
+		[]string{"orders:read"}, []string{"read-only"})
+	assert.True(t, decision.Allowed, decision.Reason)
+
+	yamlFile := filepath.Join(dir, "rules.yml")
+	require.NoError(t, os.WriteFile(yamlFile, bytes.TrimSpace([]byte(authzYAMLRules)), 0o600))
+	require.NoError(t, a.LoadRulesFile(yamlFile))
+
+	require.NoError(t, os.WriteFile(yamlFile, []byte("policies:\n  bad:\n    - equals: x\n"), 0o600))
+	assert.Error(t, a.LoadRulesFile(yamlFile))
+	assert.Error(t, a.LoadRulesFile(filepath.Join(dir, "rules.json")))
+}
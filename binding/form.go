@@ -21,10 +21,10 @@ func (formBinding) Name() string {
 
 func (formBinding) Bind(req *http.Request, obj any) error {
 	if err := req.ParseForm(); err != nil {
-		return err
+		return BodyError(req, err)
 	}
 	if err := req.ParseMultipartForm(defaultMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
-		return err
+		return BodyError(req, err)
 	}
 	if err := mapForm(obj, req.Form); err != nil {
 		return err
@@ -38,7 +38,7 @@ func (formPostBinding) Name() string {
 
 func (formPostBinding) Bind(req *http.Request, obj any) error {
 	if err := req.ParseForm(); err != nil {
-		return err
+		return BodyError(req, err)
 	}
 	if err := mapForm(obj, req.PostForm); err != nil {
 		return err
@@ -52,7 +52,7 @@ func (formMultipartBinding) Name() string {
 
 func (formMultipartBinding) Bind(req *http.Request, obj any) error {
 	if err := req.ParseMultipartForm(defaultMemory); err != nil {
-		return err
+		return BodyError(req, err)
 	}
 	if err := mappingByPtr(obj, (*multipartRequest)(req), "form"); err != nil {
 		return err
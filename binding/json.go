@@ -34,7 +34,7 @@ func (jsonBinding) Bind(req *http.Request, obj any) error {
 	if req == nil || req.Body == nil {
 		return errors.New("invalid request")
 	}
-	return decodeJSON(req.Body, obj)
+	return BodyError(req, decodeJSON(req.Body, obj))
 }
 
 func (jsonBinding) BindBody(body []byte, obj any) error {
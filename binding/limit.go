@@ -0,0 +1,54 @@
+package binding
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrBodyTooLarge is matched by errors.Is for the errors of the bindings whose request body
+// exceeded its size limit.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// BodyTooLargeError is returned by the bindings when the request body exceeds its size
+// limit, so that it can be told from a malformed body. Err is the error of the decoder.
+type BodyTooLargeError struct {
+	Limit int64
+	Err   error
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("request body larger than %d bytes", e.Limit)
+}
+
+func (e *BodyTooLargeError) Unwrap() []error {
+	return []error{ErrBodyTooLarge, e.Err}
+}
+
+// LimitedBody is implemented by the request bodies whose size is limited, to report
+// whether the limit was exceeded: some decoders do not wrap the read errors.
+type LimitedBody interface {
+	BodyLimitExceeded() (limit int64, exceeded bool)
+}
+
+// BodyError returns err as a *BodyTooLargeError if the request body exceeded its limit,
+// unchanged otherwise.
+func BodyError(req *http.Request, err error) error {
+	if err == nil {
+		return nil
+	}
+	var tooLarge *BodyTooLargeError
+	if errors.As(err, &tooLarge) {
+		return err
+	}
+	if body, ok := req.Body.(LimitedBody); ok {
+		if limit, exceeded := body.BodyLimitExceeded(); exceeded {
+			return &BodyTooLargeError{Limit: limit, Err: err}
+		}
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return &BodyTooLargeError{Limit: maxBytesErr.Limit, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package binding
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type limitTestStruct struct {
+	Foo string `json:"foo" xml:"foo" yaml:"foo" toml:"foo" form:"foo"`
+}
+
+type testLimitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (b *testLimitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+func (b *testLimitedBody) BodyLimitExceeded() (int64, bool) { return 16, b.exceeded }
+
+func TestBindingBodyTooLarge(t *testing.T) {
+	bodies := map[string]string{
+		MIMEJSON:              `{"foo":"` + strings.Repeat("x", 64) + `"}`,
+		MIMEXML:               `<root><foo>` + strings.Repeat("x", 64) + `</foo></root>`,
+		MIMEYAML:              `foo: ` + strings.Repeat("x", 64),
+		MIMETOML:              `foo = "` + strings.Repeat("x", 64) + `"`,
+		MIMEPlain:             strings.Repeat("x", 64),
+		MIMEPROTOBUF:          strings.Repeat("x", 64),
+		MIMEPOSTForm:          "foo=" + strings.Repeat("x", 64),
+		MIMEMultipartPOSTForm: "--b\r\nContent-Disposition: form-data; name=\"foo\"\r\n\r\n" + strings.Repeat("x", 64) + "\r\n--b--\r\n",
+	}
+	bindings := map[string]Binding{
+		MIMEJSON:              JSON,
+		MIMEXML:               XML,
+		MIMEYAML:              YAML,
+		MIMETOML:              TOML,
+		MIMEPlain:             Plain,
+		MIMEPROTOBUF:          ProtoBuf,
+		MIMEPOSTForm:          FormPost,
+		MIMEMultipartPOSTForm: FormMultipart,
+	}
+	for contentType, body := range bodies {
+		req, _ := http.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if contentType == MIMEMultipartPOSTForm {
+			req.Header.Set("Content-Type", contentType+"; boundary=b")
+		}
+		// multipart does not wrap the read errors, LimitedBody tells them
+		req.Body = &testLimitedBody{ReadCloser: http.MaxBytesReader(nil, req.Body, 16)}
+
+		var obj limitTestStruct
+		err := bindings[contentType].Bind(req, &obj)
+		require.ErrorIs(t, err, ErrBodyTooLarge, contentType)
+		var tooLarge *BodyTooLargeError
+		require.True(t, errors.As(err, &tooLarge), contentType)
+		assert.Equal(t, int64(16), tooLarge.Limit, contentType)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/", strings.NewReader(`{"foo":`))
+	err := JSON.Bind(req, &limitTestStruct{})
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrBodyTooLarge)
+}
+
+func TestBodyError(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "/", nil)
+	assert.NoError(t, BodyError(req, nil))
+
+	// the decoders that do not wrap the read errors are caught by LimitedBody
+	body := &testLimitedBody{ReadCloser: io.NopCloser(strings.NewReader(""))}
+	req.Body = body
+	malformed := errors.New("malformed")
+	assert.Equal(t, malformed, BodyError(req, malformed))
+	body.exceeded = true
+	err := BodyError(req, malformed)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+	assert.ErrorIs(t, err, malformed)
+	assert.Equal(t, "request body larger than 16 bytes", err.Error())
+	assert.Same(t, err, BodyError(req, err))
+}
@@ -21,7 +21,7 @@ func (msgpackBinding) Name() string {
 }
 
 func (msgpackBinding) Bind(req *http.Request, obj any) error {
-	return decodeMsgPack(req.Body, obj)
+	return BodyError(req, decodeMsgPack(req.Body, obj))
 }
 
 func (msgpackBinding) BindBody(body []byte, obj any) error {
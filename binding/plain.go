@@ -18,7 +18,7 @@ func (plainBinding) Name() string {
 func (plainBinding) Bind(req *http.Request, obj interface{}) error {
 	all, err := io.ReadAll(req.Body)
 	if err != nil {
-		return err
+		return BodyError(req, err)
 	}
 
 	return decodePlain(all, obj)
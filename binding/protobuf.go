@@ -21,7 +21,7 @@ func (protobufBinding) Name() string {
 func (b protobufBinding) Bind(req *http.Request, obj any) error {
 	buf, err := io.ReadAll(req.Body)
 	if err != nil {
-		return err
+		return BodyError(req, err)
 	}
 	return b.BindBody(buf, obj)
 }
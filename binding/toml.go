@@ -19,7 +19,7 @@ func (tomlBinding) Name() string {
 }
 
 func (tomlBinding) Bind(req *http.Request, obj any) error {
-	return decodeToml(req.Body, obj)
+	return BodyError(req, decodeToml(req.Body, obj))
 }
 
 func (tomlBinding) BindBody(body []byte, obj any) error {
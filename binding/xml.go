@@ -18,7 +18,7 @@ func (xmlBinding) Name() string {
 }
 
 func (xmlBinding) Bind(req *http.Request, obj any) error {
-	return decodeXML(req.Body, obj)
+	return BodyError(req, decodeXML(req.Body, obj))
 }
 
 func (xmlBinding) BindBody(body []byte, obj any) error {
@@ -19,7 +19,7 @@ func (yamlBinding) Name() string {
 }
 
 func (yamlBinding) Bind(req *http.Request, obj any) error {
-	return decodeYAML(req.Body, obj)
+	return BodyError(req, decodeYAML(req.Body, obj))
 }
 
 func (yamlBinding) BindBody(body []byte, obj any) error {
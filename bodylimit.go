@@ -0,0 +1,142 @@
+package hi
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+
+	"github.com/nbcx/hi/binding"
+)
+
+// DefaultBodyLimit is the default limit of BodyLimitWithConfig.
+const DefaultBodyLimit = 4 << 20
+
+// bodyLimitKey is the key the limited body of a request is stored under in the context, so
+// that a BodyLimit of a route finds it behind the bodies wrapping it.
+const bodyLimitKey = "_hi/bodylimit"
+
+// BodyLimitConfig defines the config for BodyLimit middleware.
+type BodyLimitConfig struct {
+	// Limit is the maximum size of the request bodies in bytes, a negative value disables it.
+	// Optional. Default value is DefaultBodyLimit.
+	Limit int64
+
+	// ContentTypes override Limit for the media types matching their path.Match patterns,
+	// such as "multipart/*". An exact media type wins over the patterns, the longest pattern
+	// over the shorter ones. As for Limit, 0 stands for DefaultBodyLimit and a negative value
+	// disables the limit.
+	// Optional. Default value is empty.
+	ContentTypes map[string]int64
+}
+
+// BodyLimit returns a middleware limiting the size of the request bodies to limit bytes.
+// See BodyLimitWithConfig.
+func BodyLimit[T IContext](limit int64) HandlerFunc[T] {
+	return BodyLimitWithConfig[T](BodyLimitConfig{Limit: limit})
+}
+
+// BodyLimitWithConfig returns a BodyLimit middleware with config.
+//
+// Requests whose Content-Length exceeds the limit are rejected with 413 at once. Otherwise
+// the body is wrapped with http.MaxBytesReader, reading beyond the limit fails, the bindings
+// then return a *binding.BodyTooLargeError and Context.Bind and its shortcuts abort with 413.
+// A BodyLimit of a route replaces the one of its group or engine as long as it was not
+// exceeded, even once the body is wrapped by middleware such as Decompress; the bytes already
+// read count towards the new limit. Bodies fully read by an earlier middleware, such as
+// VerifyWebhook, keep the outer limit, as do the requests rejected for their Content-Length:
+// to raise the limit of some routes, raise the outer one for their content types or put
+// BodyLimit on the routes only.
+func BodyLimitWithConfig[T IContext](conf BodyLimitConfig) HandlerFunc[T] {
+	if conf.Limit == 0 {
+		conf.Limit = DefaultBodyLimit
+	}
+	contentTypes := make(map[string]int64, len(conf.ContentTypes))
+	patterns := make([]string, 0, len(conf.ContentTypes))
+	for pattern, limit := range conf.ContentTypes {
+		_, err := path.Match(pattern, "")
+		assert1(err == nil, "invalid content type pattern "+pattern)
+		if limit == 0 {
+			limit = DefaultBodyLimit
+		}
+		contentTypes[pattern] = limit
+		patterns = append(patterns, pattern)
+	}
+	conf.ContentTypes = contentTypes
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	limitOf := func(contentType string) int64 {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		if limit, ok := conf.ContentTypes[mediaType]; ok {
+			return limit
+		}
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, mediaType); ok {
+				return conf.ContentTypes[pattern]
+			}
+		}
+		return conf.Limit
+	}
+
+	return func(c T) {
+		req := c.Req()
+		lb, _ := c.GetKeys()[bodyLimitKey].(*limitedBody)
+		if lb != nil && lb.exceeded {
+			c.Next()
+			return
+		}
+		if lb == nil && (req.Body == nil || req.Body == http.NoBody) {
+			c.Next()
+			return
+		}
+		limit := limitOf(req.Header.Get("Content-Type"))
+		if limit >= 0 && req.ContentLength > limit {
+			_ = c.Error(&binding.BodyTooLargeError{Limit: limit, Err: &http.MaxBytesError{Limit: limit}})
+			c.GetExecer().AbortWithStatus(http.StatusRequestEntityTooLarge)
+			return
+		}
+		if lb == nil {
+			lb = &limitedBody{body: req.Body}
+			c.Set(bodyLimitKey, lb)
+			req.Body = lb
+		}
+		lb.limit = limit
+		lb.ReadCloser = lb.body
+		if limit >= 0 {
+			lb.ReadCloser = http.MaxBytesReader(c.GetExecer().WriterMem().ResponseWriter, lb.body, max(limit-lb.read, 0))
+		}
+		c.Next()
+	}
+}
+
+// limitedBody is the request body installed by BodyLimit. It remembers whether the limit was
+// exceeded for binding.BodyError. A negative limit leaves body unlimited.
+type limitedBody struct {
+	io.ReadCloser
+	body     io.ReadCloser
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+var _ binding.LimitedBody = (*limitedBody)(nil)
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	var maxBytesErr *http.MaxBytesError
+	if err != nil && errors.As(err, &maxBytesErr) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+func (b *limitedBody) BodyLimitExceeded() (int64, bool) {
+	return b.limit, b.exceeded
+}
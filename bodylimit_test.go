@@ -0,0 +1,165 @@
+package hi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nbcx/hi/binding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bodyLimitTestBody struct {
+	Name string `json:"name" form:"name"`
+}
+
+// performBodyLimit sends body without a Content-Length when chunked.
+func performBodyLimit(router *Engine[*Context], path, contentType, body string, chunked bool) *httptest.ResponseRecorder {
+	var r io.Reader = strings.NewReader(body)
+	if chunked {
+		r = io.MultiReader(r)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, r)
+	req.Header.Set("Content-Type", contentType)
+	if chunked {
+		req.ContentLength = -1
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestBodyLimit(t *testing.T) {
+	var bindErr error
+	router := New(&Context{})
+	router.Use(BodyLimit[*Context](32))
+	bind := func(c *Context) {
+		var obj bodyLimitTestBody
+		if bindErr = c.Bind(&obj); bindErr == nil {
+			c.String(http.StatusOK, obj.Name)
+		}
+	}
+	router.POST("/", bind)
+	router.POST("/upload", BodyLimit[*Context](1024), bind)
+	router.POST("/cached", func(c *Context) {
+		var obj bodyLimitTestBody
+		bindErr = c.ShouldBindBodyWithJSON(&obj)
+	})
+	large := `{"name":"` + strings.Repeat("x", 64) + `"}`
+
+	w := performBodyLimit(router, "/", MIMEJSON, `{"name":"gopher"}`, true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gopher", w.Body.String())
+
+	w = performBodyLimit(router, "/", MIMEJSON, large, false)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	for _, tc := range []struct{ contentType, body string }{
+		{MIMEJSON, large},
+		{MIMEXML, `<root><name>` + strings.Repeat("x", 64) + `</name></root>`},
+		{MIMEYAML, `name: ` + strings.Repeat("x", 64)},
+		{MIMEPOSTForm, "name=" + strings.Repeat("x", 64)},
+		{MIMEMultipartPOSTForm + "; boundary=b", "--b\r\nContent-Disposition: form-data; name=\"name\"\r\n\r\n" + strings.Repeat("x", 64) + "\r\n--b--\r\n"},
+	} {
+		bindErr = nil
+		w = performBodyLimit(router, "/", tc.contentType, tc.body, true)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, tc.contentType)
+		var tooLarge *binding.BodyTooLargeError
+		require.True(t, errors.As(bindErr, &tooLarge), "%s: %v", tc.contentType, bindErr)
+		assert.Equal(t, int64(32), tooLarge.Limit)
+	}
+
+	w = performBodyLimit(router, "/", MIMEJSON, `{"name":`, true)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NotErrorIs(t, bindErr, binding.ErrBodyTooLarge)
+
+	// the limit of the route replaces the one of the engine
+	w = performBodyLimit(router, "/upload", MIMEJSON, large, true)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	performBodyLimit(router, "/cached", MIMEJSON, large, true)
+	assert.ErrorIs(t, bindErr, binding.ErrBodyTooLarge)
+}
+
+func TestBodyLimitBehindDecompress(t *testing.T) {
+	router := New(&Context{})
+	router.Use(BodyLimit[*Context](32), Decompress[*Context]())
+	read := func(c *Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Status(http.StatusRequestEntityTooLarge)
+			return
+		}
+		c.String(http.StatusOK, "%d", len(body))
+	}
+	router.POST("/", read)
+	router.POST("/upload", BodyLimit[*Context](1024), read)
+
+	var data strings.Builder
+	for i := range 100 {
+		fmt.Fprintf(&data, "%d,", i*7919%1000)
+	}
+	compressed := gzipData(t, []byte(data.String()))
+	require.Greater(t, len(compressed), 32)
+	require.Less(t, len(compressed), 1024)
+	post := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, io.MultiReader(bytes.NewReader(compressed)))
+		req.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/").Code)
+	// the limit of the route replaces the one of the engine behind Decompress
+	w := post("/upload")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, strconv.Itoa(data.Len()), w.Body.String())
+}
+
+func TestBodyLimitContentTypes(t *testing.T) {
+	router := New(&Context{})
+	router.Use(BodyLimitWithConfig[*Context](BodyLimitConfig{
+		Limit: 16,
+		ContentTypes: map[string]int64{
+			"multipart/*":          1024,
+			"application/*":        64,
+			"application/json":     32,
+			"application/x-ndjson": -1,
+			"text/csv":             0,
+		},
+	}))
+	router.POST("/", func(c *Context) {
+		if _, err := io.ReadAll(c.Request.Body); err != nil {
+			c.Status(http.StatusRequestEntityTooLarge)
+		}
+	})
+
+	for _, tc := range []struct {
+		contentType string
+		size        int
+		status      int
+	}{
+		{MIMEPlain, 16, http.StatusOK},
+		{MIMEPlain, 17, http.StatusRequestEntityTooLarge},
+		{MIMEJSON + "; charset=utf-8", 32, http.StatusOK},
+		{MIMEJSON, 33, http.StatusRequestEntityTooLarge},
+		{MIMEXML, 64, http.StatusOK},
+		{MIMEXML, 65, http.StatusRequestEntityTooLarge},
+		{MIMEMultipartPOSTForm, 1024, http.StatusOK},
+		{"application/x-ndjson", 4096, http.StatusOK},
+		{"text/csv", 4096, http.StatusOK},
+	} {
+		w := performBodyLimit(router, "/", tc.contentType, strings.Repeat("x", tc.size), true)
+		assert.Equal(t, tc.status, w.Code, "%s %d", tc.contentType, tc.size)
+	}
+
+	assert.Panics(t, func() { BodyLimitWithConfig[*Context](BodyLimitConfig{ContentTypes: map[string]int64{"[": 1}}) })
+}
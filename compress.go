@@ -0,0 +1,425 @@
+package hi
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultCompressMinSize is the default size under which responses are not compressed.
+const DefaultCompressMinSize = 1024
+
+// DefaultCompressContentTypes are the media types compressed by default.
+var DefaultCompressContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/*+json",
+	"application/javascript",
+	"application/xml",
+	"application/*+xml",
+	"application/x-ndjson",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+// EncoderWriter compresses the data written to it. Flush writes the pending data to the
+// underlying writer, Close flushes the remaining data without closing the underlying writer.
+type EncoderWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// Encoder is a content coding of the Compress middleware. Other codings are plugged in by
+// implementing it, e.g. zstd with github.com/klauspost/compress/zstd:
+//
+//	type zstdEncoder struct{}
+//
+//	func (zstdEncoder) Encoding() string { return "zstd" }
+//
+//	func (zstdEncoder) NewWriter(w io.Writer) hi.EncoderWriter {
+//		enc, _ := zstd.NewWriter(w)
+//		return enc
+//	}
+type Encoder interface {
+	// Encoding returns the content coding token, as used in Accept-Encoding and
+	// Content-Encoding.
+	Encoding() string
+	// NewWriter returns an EncoderWriter compressing into w.
+	NewWriter(w io.Writer) EncoderWriter
+}
+
+type pooledEncoder struct {
+	encoding string
+	pool     sync.Pool
+}
+
+type pooledWriter struct {
+	EncoderWriter
+	reset func(w io.Writer)
+	pool  *sync.Pool
+}
+
+func (w *pooledWriter) Close() error {
+	err := w.EncoderWriter.Close()
+	w.reset(io.Discard)
+	w.pool.Put(w)
+	return err
+}
+
+func (e *pooledEncoder) Encoding() string { return e.encoding }
+
+func (e *pooledEncoder) NewWriter(w io.Writer) EncoderWriter {
+	pw := e.pool.Get().(*pooledWriter)
+	pw.reset(w)
+	return pw
+}
+
+// GzipEncoder returns the gzip Encoder compressing at level, see compress/gzip.
+func GzipEncoder(level int) Encoder {
+	_, err := gzip.NewWriterLevel(io.Discard, level)
+	assert1(err == nil, "invalid gzip compression level "+strconv.Itoa(level))
+	e := &pooledEncoder{encoding: "gzip"}
+	e.pool.New = func() any {
+		gw, _ := gzip.NewWriterLevel(io.Discard, level)
+		return &pooledWriter{EncoderWriter: gw, reset: gw.Reset, pool: &e.pool}
+	}
+	return e
+}
+
+// DeflateEncoder returns the deflate Encoder compressing at level, see compress/zlib.
+// Following RFC 9110, the data is sent in the zlib format.
+func DeflateEncoder(level int) Encoder {
+	_, err := zlib.NewWriterLevel(io.Discard, level)
+	assert1(err == nil, "invalid deflate compression level "+strconv.Itoa(level))
+	e := &pooledEncoder{encoding: "deflate"}
+	e.pool.New = func() any {
+		zw, _ := zlib.NewWriterLevel(io.Discard, level)
+		return &pooledWriter{EncoderWriter: zw, reset: zw.Reset, pool: &e.pool}
+	}
+	return e
+}
+
+// CompressConfig defines the config for Compress middleware.
+type CompressConfig struct {
+	// Encoders are the content codings offered, by order of preference when the client
+	// accepts several of them equally.
+	// Optional. Default value is gzip then deflate, at the default compression level.
+	Encoders []Encoder
+
+	// MinSize is the size under which responses are sent uncompressed, compressing them
+	// would not pay off. Responses flushed before reaching it are compressed anyway.
+	// Optional. Default value is DefaultCompressMinSize, a negative value compresses all
+	// the responses.
+	MinSize int
+
+	// ContentTypes are the media types compressed, as path.Match patterns such as
+	// "text/*".
+	// Optional. Default value is DefaultCompressContentTypes.
+	ContentTypes []string
+
+	// ExcludedContentTypes are the media types never compressed, as path.Match patterns,
+	// taking precedence over ContentTypes.
+	// Optional. Default value is empty.
+	ExcludedContentTypes []string
+
+	// Skip returns true for the requests whose response must not be compressed.
+	// Optional. Default value is nil.
+	Skip func(c IContext) bool
+}
+
+// Compress returns a middleware compressing the responses with gzip or deflate, depending
+// on the Accept-Encoding of the request. See CompressWithConfig.
+func Compress[T IContext]() HandlerFunc[T] {
+	return CompressWithConfig[T](CompressConfig{})
+}
+
+// CompressWithConfig returns a Compress middleware with config.
+//
+// The responses are buffered until MinSize bytes are written, or until they are flushed,
+// then compressed with the encoder the client prefers if their content type is allowed.
+// HEAD and range requests are not compressed, nor the responses that already have a
+// Content-Encoding, a Content-Range or no body. Size reports the uncompressed size of the
+// response. The handlers that compute a Content-Length must leave it unset or correct, it is
+// removed from the compressed responses.
+func CompressWithConfig[T IContext](conf CompressConfig) HandlerFunc[T] {
+	if len(conf.Encoders) == 0 {
+		conf.Encoders = []Encoder{GzipEncoder(gzip.DefaultCompression), DeflateEncoder(flate.DefaultCompression)}
+	}
+	if conf.MinSize == 0 {
+		conf.MinSize = DefaultCompressMinSize
+	}
+	if conf.ContentTypes == nil {
+		conf.ContentTypes = DefaultCompressContentTypes
+	}
+	for _, patterns := range [][]string{conf.ContentTypes, conf.ExcludedContentTypes} {
+		for _, pattern := range patterns {
+			_, err := path.Match(pattern, "")
+			assert1(err == nil, "invalid content type pattern "+pattern)
+		}
+	}
+
+	return func(c T) {
+		req := c.Req()
+		rw := c.GetExecer().WriterMem()
+		if req.Method == http.MethodHead || req.Header.Get("Range") != "" || rw.Written() ||
+			(conf.Skip != nil && conf.Skip(c)) {
+			c.Next()
+			return
+		}
+		cw := &compressWriter{
+			ResponseWriter: rw.ResponseWriter,
+			conf:           &conf,
+			encoder:        negotiateEncoder(req.Header.Values("Accept-Encoding"), conf.Encoders),
+		}
+		rw.ResponseWriter = cw
+		defer func() {
+			rw.ResponseWriter = cw.ResponseWriter
+			if err := cw.close(); err != nil {
+				_ = c.Error(err)
+			}
+		}()
+		c.Next()
+	}
+}
+
+// negotiateEncoder returns the encoder of encoders with the highest q-value in the
+// Accept-Encoding header values, nil if none is acceptable.
+func negotiateEncoder(accept []string, encoders []Encoder) Encoder {
+	qvalues := make(map[string]float64)
+	for _, value := range accept {
+		for _, part := range strings.Split(value, ",") {
+			coding, params, _ := strings.Cut(part, ";")
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding == "" {
+				continue
+			}
+			q := 1.0
+			for _, param := range strings.Split(params, ";") {
+				if name, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.EqualFold(name, "q") {
+					if v, err := strconv.ParseFloat(value, 64); err == nil && v >= 0 && v <= 1 {
+						q = v
+					} else {
+						q = 0
+					}
+				}
+			}
+			if coding == "x-gzip" {
+				coding = "gzip"
+			}
+			qvalues[coding] = q
+		}
+	}
+
+	var best Encoder
+	bestQ := 0.0
+	for _, encoder := range encoders {
+		q, ok := qvalues[encoder.Encoding()]
+		if !ok {
+			q = qvalues["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoder, q
+		}
+	}
+	return best
+}
+
+// compressWriter is installed under the responseWriter by Compress. It holds the header and
+// buffers the body until it decides whether to compress them.
+type compressWriter struct {
+	http.ResponseWriter
+	conf    *CompressConfig
+	encoder Encoder
+
+	status   int
+	buf      []byte
+	decided  bool
+	ew       EncoderWriter
+	hijacked bool
+}
+
+var _ http.ResponseWriter = (*compressWriter)(nil)
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.status != 0 {
+		return
+	}
+	cw.status = code
+	h := cw.Header()
+	if cw.encoder == nil || !bodyAllowedForStatus(code) || code == http.StatusPartialContent ||
+		h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		cw.decide(false)
+		return
+	}
+	if h.Get("Content-Type") != "" && !cw.compressible() {
+		cw.decide(false)
+		return
+	}
+	if n, err := strconv.Atoi(h.Get("Content-Length")); err == nil && n < cw.conf.MinSize {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(data []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, data...)
+		if len(cw.buf) >= cw.conf.MinSize {
+			cw.decide(cw.compressible())
+			if err := cw.flushBuffer(); err != nil {
+				return 0, err
+			}
+		}
+		return len(data), nil
+	}
+	if cw.ew != nil {
+		if _, err := cw.ew.Write(data); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	return cw.ResponseWriter.Write(data)
+}
+
+// Flush implements the http.Flusher interface, compressing the response if the content
+// type allows it whatever its size.
+func (cw *compressWriter) Flush() {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.decide(cw.compressible())
+	}
+	if err := cw.flushBuffer(); err != nil {
+		return
+	}
+	if cw.ew != nil {
+		if err := cw.ew.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements the http.Hijacker interface.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if cw.ew != nil {
+		return nil, nil, errors.New("can not hijack a compressed response")
+	}
+	cw.hijacked = true
+	return cw.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// CloseNotify implements the http.CloseNotifier interface.
+func (cw *compressWriter) CloseNotify() <-chan bool {
+	return cw.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
+// compressible reports whether the content type of the response allows compressing it. It
+// sniffs the content type from the buffered body if it is not set, as net/http would do
+// from the compressed one otherwise.
+func (cw *compressWriter) compressible() bool {
+	h := cw.Header()
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		if len(cw.buf) == 0 {
+			return false
+		}
+		contentType = http.DetectContentType(cw.buf)
+		h.Set("Content-Type", contentType)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return matchContentType(cw.conf.ContentTypes, mediaType) && !matchContentType(cw.conf.ExcludedContentTypes, mediaType)
+}
+
+func matchContentType(patterns []string, mediaType string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, mediaType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// decide writes the header, with the compression headers if compress.
+func (cw *compressWriter) decide(compress bool) {
+	cw.decided = true
+	h := cw.Header()
+	addVary(h, "Accept-Encoding")
+	if compress {
+		h.Set("Content-Encoding", cw.encoder.Encoding())
+		h.Del("Content-Length")
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if compress {
+		cw.ew = cw.encoder.NewWriter(cw.ResponseWriter)
+	}
+}
+
+func (cw *compressWriter) flushBuffer() error {
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	buf := cw.buf
+	cw.buf = nil
+	var err error
+	if cw.ew != nil {
+		_, err = cw.ew.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// close sends the response buffered if it is still undecided and finishes the compression.
+func (cw *compressWriter) close() error {
+	if cw.hijacked || cw.status == 0 {
+		return nil
+	}
+	if !cw.decided {
+		cw.decide(len(cw.buf) >= cw.conf.MinSize && cw.compressible())
+	}
+	err := cw.flushBuffer()
+	if cw.ew != nil {
+		if cerr := cw.ew.Close(); err == nil {
+			err = cerr
+		}
+		cw.ew = nil
+	}
+	return err
+}
+
+func addVary(h http.Header, field string) {
+	for _, value := range h.Values("Vary") {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v == "*" || strings.EqualFold(v, field) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", field)
+}
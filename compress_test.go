@@ -0,0 +1,226 @@
+package hi
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var compressTestBody = strings.Repeat(`{"message":"hello world"}`, 100)
+
+func gunzip(t *testing.T, data []byte) string {
+	t.Helper()
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(out)
+}
+
+func TestCompress(t *testing.T) {
+	size := 0
+	router := New(&Context{})
+	router.Use(func(c *Context) {
+		c.Next()
+		size = c.Response.Size()
+	}, Compress[*Context]())
+	router.GET("/json", func(c *Context) {
+		c.Header("ETag", `"v1"`)
+		c.Data(http.StatusOK, []byte(compressTestBody), MIMEJSON)
+	})
+	router.GET("/small", func(c *Context) { c.String(http.StatusOK, "small") })
+	router.GET("/png", func(c *Context) { c.Data(http.StatusOK, []byte(compressTestBody), "image/png") })
+	router.GET("/sniffed", func(c *Context) { _, _ = c.Response.WriteString(compressTestBody) })
+	router.GET("/encoded", func(c *Context) {
+		c.Header("Content-Encoding", "br")
+		c.Data(http.StatusOK, []byte(compressTestBody), MIMEJSON)
+	})
+	router.GET("/empty", func(c *Context) { c.Status(http.StatusNoContent) })
+
+	w := PerformRequest(router, http.MethodGet, "/json", header{"Accept-Encoding", "gzip, deflate"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Equal(t, MIMEJSON, w.Header().Get("Content-Type"))
+	assert.Equal(t, `W/"v1"`, w.Header().Get("ETag"))
+	assert.Empty(t, w.Header().Get("Content-Length"))
+	assert.Less(t, w.Body.Len(), len(compressTestBody))
+	assert.Equal(t, compressTestBody, gunzip(t, w.Body.Bytes()))
+	assert.Equal(t, len(compressTestBody), size)
+
+	w = PerformRequest(router, http.MethodGet, "/json")
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Equal(t, compressTestBody, w.Body.String())
+
+	w = PerformRequest(router, http.MethodGet, "/sniffed", header{"Accept-Encoding", "gzip"})
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, compressTestBody, gunzip(t, w.Body.Bytes()))
+
+	for _, path := range []string{"/small", "/png", "/encoded"} {
+		w = PerformRequest(router, http.MethodGet, path, header{"Accept-Encoding", "gzip"})
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.NotEqual(t, "gzip", w.Header().Get("Content-Encoding"), path)
+	}
+	assert.Equal(t, compressTestBody, w.Body.String())
+
+	w = PerformRequest(router, http.MethodGet, "/empty", header{"Accept-Encoding", "gzip"})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = PerformRequest(router, http.MethodGet, "/json", header{"Accept-Encoding", "gzip"}, header{"Range", "bytes=0-9"})
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	w = PerformRequest(router, http.MethodHead, "/json", header{"Accept-Encoding", "gzip"})
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+}
+
+type testEncoder struct{}
+
+func (testEncoder) Encoding() string { return "zstd" }
+
+func (testEncoder) NewWriter(w io.Writer) EncoderWriter {
+	return &testEncoderWriter{w: w}
+}
+
+type testEncoderWriter struct{ w io.Writer }
+
+func (tw *testEncoderWriter) Write(p []byte) (int, error) { return tw.w.Write(bytes.ToUpper(p)) }
+func (tw *testEncoderWriter) Flush() error                { return nil }
+func (tw *testEncoderWriter) Close() error                { return nil }
+
+func TestCompressNegotiation(t *testing.T) {
+	router := New(&Context{})
+	router.Use(CompressWithConfig[*Context](CompressConfig{
+		Encoders: []Encoder{testEncoder{}, GzipEncoder(gzip.BestSpeed), DeflateEncoder(zlib.BestCompression)},
+		MinSize:  -1,
+	}))
+	router.GET("/", func(c *Context) { c.String(http.StatusOK, "hello") })
+
+	for accept, encoding := range map[string]string{
+		"gzip;q=0.5, deflate":          "deflate",
+		"gzip, deflate, zstd":          "zstd",
+		"GZIP;q=1.0, zstd;q=0.9":       "gzip",
+		"x-gzip":                       "gzip",
+		"*":                            "zstd",
+		"*;q=0.1, zstd;q=0, gzip;q=0":  "deflate",
+		"gzip;q=0":                     "",
+		"identity":                     "",
+		"br":                           "",
+		"gzip;q=invalid, deflate;q=.2": "deflate",
+	} {
+		w := PerformRequest(router, http.MethodGet, "/", header{"Accept-Encoding", accept})
+		assert.Equal(t, encoding, w.Header().Get("Content-Encoding"), accept)
+		switch encoding {
+		case "zstd":
+			assert.Equal(t, "HELLO", w.Body.String())
+		case "deflate":
+			r, err := zlib.NewReader(w.Body)
+			require.NoError(t, err)
+			body, _ := io.ReadAll(r)
+			assert.Equal(t, "hello", string(body))
+		case "":
+			assert.Equal(t, "hello", w.Body.String())
+		}
+	}
+
+	assert.Panics(t, func() { GzipEncoder(42) })
+	assert.Panics(t, func() { CompressWithConfig[*Context](CompressConfig{ExcludedContentTypes: []string{"["}}) })
+}
+
+func TestCompressContentTypes(t *testing.T) {
+	router := New(&Context{})
+	router.Use(CompressWithConfig[*Context](CompressConfig{
+		MinSize:              10,
+		ContentTypes:         []string{"text/*", "application/*+json"},
+		ExcludedContentTypes: []string{"text/csv"},
+		Skip:                 func(c IContext) bool { return c.Req().URL.Query().Has("raw") },
+	}))
+	router.GET("/:type/:subtype", func(c *Context) {
+		c.Data(http.StatusOK, []byte(compressTestBody), c.Param("type").String()+"/"+c.Param("subtype").String()+"; charset=utf-8")
+	})
+
+	for path, compressed := range map[string]bool{
+		"/text/html":                true,
+		"/application/problem+json": true,
+		"/text/csv":                 false,
+		"/application/json":         false,
+		"/text/html?raw":            false,
+	} {
+		w := PerformRequest(router, http.MethodGet, path, header{"Accept-Encoding", "gzip"})
+		assert.Equal(t, compressed, w.Header().Get("Content-Encoding") == "gzip", path)
+	}
+}
+
+func TestCompressStream(t *testing.T) {
+	router := New(&Context{})
+	router.Use(Compress[*Context]())
+	router.GET("/stream", func(c *Context) {
+		i := 0
+		c.Stream(func(w io.Writer) bool {
+			_, _ = io.WriteString(w, "chunk\n")
+			i++
+			return i < 3
+		})
+	})
+	router.GET("/sse", func(c *Context) {
+		c.SSEvent("message", "hello")
+		c.Response.Flush()
+		c.SSEvent("message", "world")
+	})
+
+	w := PerformRequest(router, http.MethodGet, "/stream", header{"Accept-Encoding", "gzip"})
+	assert.True(t, w.Flushed)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "chunk\nchunk\nchunk\n", gunzip(t, w.Body.Bytes()))
+
+	// server-sent events, over a real connection
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/sse", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	gr, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(gr)
+	require.NoError(t, err)
+	assert.Equal(t, "event:message\ndata:hello\n\nevent:message\ndata:world\n\n", string(body))
+}
+
+func TestCompressHijack(t *testing.T) {
+	router := New(&Context{})
+	router.Use(Compress[*Context]())
+	router.GET("/", func(c *Context) {
+		conn, buf, err := c.Response.Hijack()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		_, _ = buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		_ = buf.Flush()
+	})
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(bufio.NewReader(resp.Body))
+	assert.Equal(t, "hijacked", string(body))
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+}
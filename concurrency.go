@@ -0,0 +1,302 @@
+package hi
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrOverloaded is recorded in the context errors of the requests shed by ConcurrencyLimit.
+var ErrOverloaded = errors.New("server overloaded")
+
+// AdaptiveLimit tunes the limit of a ConcurrencyLimiter from the observed requests. Update is
+// called with the limiter lock held, implementations need no synchronization of their own.
+type AdaptiveLimit interface {
+	// Update returns the new limit after a request completed in latency with inFlight requests
+	// being handled. dropped reports a request that timed out or was refused downstream.
+	Update(limit float64, inFlight int, latency time.Duration, dropped bool) float64
+}
+
+// AIMDLimit is an additive-increase/multiplicative-decrease AdaptiveLimit: the limit grows by
+// about one per limit requests completed in time, and shrinks by Backoff on dropped or slow
+// requests.
+type AIMDLimit struct {
+	// Min and Max bound the limit.
+	Min, Max int
+	// Backoff is the factor the limit is multiplied by on congestion.
+	// Optional. Default value is 0.9.
+	Backoff float64
+	// Timeout is the latency above which a request signals congestion.
+	// Optional. Default value is no latency threshold.
+	Timeout time.Duration
+}
+
+// Update implements the AdaptiveLimit interface.
+func (a *AIMDLimit) Update(limit float64, inFlight int, latency time.Duration, dropped bool) float64 {
+	backoff := a.Backoff
+	if backoff <= 0 || backoff >= 1 {
+		backoff = 0.9
+	}
+	switch {
+	case dropped || (a.Timeout > 0 && latency > a.Timeout):
+		limit *= backoff
+	case float64(inFlight)*2 >= limit:
+		// only grow when the limit is actually used
+		limit += 1 / limit
+	}
+	return clampLimit(limit, a.Min, a.Max)
+}
+
+// GradientLimit is an AdaptiveLimit following the ratio between the lowest and the current
+// latency: the limit shrinks as requests queue up in the service and latency grows, and grows
+// back by a queue allowance of √limit while latency stays near its minimum.
+type GradientLimit struct {
+	// Min and Max bound the limit.
+	Min, Max int
+	// Smoothing is the weight of each new estimate, in (0, 1].
+	// Optional. Default value is 0.2.
+	Smoothing float64
+	// MinLatencyWindow is the number of samples after which the lowest latency is re-measured,
+	// so that the limiter adapts when the service gets durably slower.
+	// Optional. Default value is 1000.
+	MinLatencyWindow int
+
+	minLatency time.Duration
+	samples    int
+}
+
+// Update implements the AdaptiveLimit interface.
+func (g *GradientLimit) Update(limit float64, _ int, latency time.Duration, dropped bool) float64 {
+	window := g.MinLatencyWindow
+	if window <= 0 {
+		window = 1000
+	}
+	smoothing := g.Smoothing
+	if smoothing <= 0 || smoothing > 1 {
+		smoothing = 0.2
+	}
+	if g.samples++; g.samples >= window {
+		g.samples = 0
+		g.minLatency = 0
+	}
+	if latency > 0 && (g.minLatency == 0 || latency < g.minLatency) {
+		g.minLatency = latency
+	}
+
+	gradient := 0.5
+	if !dropped && latency > 0 {
+		gradient = math.Max(0.5, math.Min(1, float64(g.minLatency)/float64(latency)))
+	}
+	estimate := limit*gradient + math.Sqrt(limit)
+	limit = limit*(1-smoothing) + estimate*smoothing
+	return clampLimit(limit, g.Min, g.Max)
+}
+
+func clampLimit(limit float64, lower, upper int) float64 {
+	lower = max(lower, 1)
+	if upper > 0 {
+		limit = math.Min(limit, float64(upper))
+	}
+	return math.Max(limit, float64(lower))
+}
+
+// ConcurrencyLimiterConfig defines the config of a ConcurrencyLimiter.
+type ConcurrencyLimiterConfig struct {
+	// Limit is the maximum number of requests handled at once, the initial one in adaptive mode.
+	Limit int
+
+	// QueueTimeout is how long a request waits for a slot when the limit is reached.
+	// Optional. Default value is 0, requests over the limit are shed right away.
+	QueueTimeout time.Duration
+
+	// MaxQueue is the maximum number of requests waiting for a slot.
+	// Optional. Default value is Limit.
+	MaxQueue int
+
+	// Adaptive tunes the limit automatically, see AIMDLimit and GradientLimit.
+	// Optional. Default value is a static limit.
+	Adaptive AdaptiveLimit
+
+	// RetryAfter is advertised to the shed requests.
+	// Optional. Default value is 1 second.
+	RetryAfter time.Duration
+
+	// Rejected answers the shed requests, after the Retry-After header is set.
+	// Optional. Default value aborts with status 503.
+	Rejected func(c IContext)
+}
+
+// ConcurrencyStats is a snapshot of the state of a ConcurrencyLimiter.
+type ConcurrencyStats struct {
+	Limit    int
+	InFlight int
+	Queued   int
+	Accepted uint64
+	Rejected uint64
+}
+
+// ConcurrencyLimiter bounds the number of requests handled at once. Install one with
+// ConcurrencyLimit on the engine for a global cap, or on a RouterGroup for a cap per group;
+// the same limiter can be shared by several groups. It is safe for concurrent use.
+type ConcurrencyLimiter struct {
+	conf ConcurrencyLimiterConfig
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	queue    []chan struct{}
+	accepted uint64
+	rejected uint64
+}
+
+// NewConcurrencyLimiter returns a ConcurrencyLimiter with config.
+func NewConcurrencyLimiter(conf ConcurrencyLimiterConfig) *ConcurrencyLimiter {
+	assert1(conf.Limit > 0, "concurrency limit must be positive")
+	if conf.MaxQueue <= 0 {
+		conf.MaxQueue = conf.Limit
+	}
+	if conf.RetryAfter <= 0 {
+		conf.RetryAfter = time.Second
+	}
+	if conf.Rejected == nil {
+		conf.Rejected = defaultConcurrencyRejected
+	}
+	return &ConcurrencyLimiter{conf: conf, limit: float64(conf.Limit)}
+}
+
+// Stats returns the current state of the limiter.
+func (l *ConcurrencyLimiter) Stats() ConcurrencyStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return ConcurrencyStats{
+		Limit:    int(l.limit),
+		InFlight: l.inFlight,
+		Queued:   len(l.queue),
+		Accepted: l.accepted,
+		Rejected: l.rejected,
+	}
+}
+
+// RegisterMetrics exposes the state of the limiter in reg, as metrics prefixed with name.
+func (l *ConcurrencyLimiter) RegisterMetrics(reg *MetricsRegistry, name string) {
+	reg.GaugeFunc(name+"_limit", "Current concurrency limit.", func() float64 {
+		return float64(l.Stats().Limit)
+	})
+	reg.GaugeFunc(name+"_in_flight", "Number of requests being handled.", func() float64 {
+		return float64(l.Stats().InFlight)
+	})
+	reg.GaugeFunc(name+"_queued", "Number of requests waiting for a slot.", func() float64 {
+		return float64(l.Stats().Queued)
+	})
+	reg.CounterFunc(name+"_accepted_total", "Total number of requests admitted.", func() float64 {
+		return float64(l.Stats().Accepted)
+	})
+	reg.CounterFunc(name+"_rejected_total", "Total number of requests shed.", func() float64 {
+		return float64(l.Stats().Rejected)
+	})
+}
+
+// acquire takes a slot, waiting in the queue for at most QueueTimeout. It reports whether the
+// request is admitted.
+func (l *ConcurrencyLimiter) acquire(ctx context.Context) bool {
+	l.mu.Lock()
+	if l.inFlight < int(l.limit) {
+		l.inFlight++
+		l.accepted++
+		l.mu.Unlock()
+		return true
+	}
+	if l.conf.QueueTimeout <= 0 || len(l.queue) >= l.conf.MaxQueue {
+		l.rejected++
+		l.mu.Unlock()
+		return false
+	}
+	ready := make(chan struct{})
+	l.queue = append(l.queue, ready)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.conf.QueueTimeout)
+	defer timer.Stop()
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	select {
+	case <-ready:
+		return true
+	case <-timer.C:
+	case <-done:
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if i := slices.Index(l.queue, ready); i >= 0 {
+		l.queue = slices.Delete(l.queue, i, i+1)
+		l.rejected++
+		return false
+	}
+	// the slot was handed over while giving up
+	return true
+}
+
+// release frees a slot, updates the adaptive limit and hands the free slots to the queue.
+func (l *ConcurrencyLimiter) release(latency time.Duration, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	if l.conf.Adaptive != nil {
+		l.limit = l.conf.Adaptive.Update(l.limit, l.inFlight+1, latency, dropped)
+	}
+	for len(l.queue) > 0 && l.inFlight < int(l.limit) {
+		ready := l.queue[0]
+		l.queue = slices.Delete(l.queue, 0, 1)
+		l.inFlight++
+		l.accepted++
+		close(ready)
+	}
+}
+
+func defaultConcurrencyRejected(c IContext) {
+	_ = c.Error(ErrOverloaded)
+	c.GetExecer().AbortWithStatus(http.StatusServiceUnavailable)
+}
+
+// ConcurrencyLimit returns a middleware admitting at most limit requests at once, shedding the
+// others with 503 and Retry-After.
+func ConcurrencyLimit[T IContext](limit int) HandlerFunc[T] {
+	return ConcurrencyLimitWithLimiter[T](NewConcurrencyLimiter(ConcurrencyLimiterConfig{Limit: limit}))
+}
+
+// ConcurrencyLimitWithLimiter returns a ConcurrencyLimit middleware admitting requests through
+// l. Requests answered with 503 or 504, or whose context deadline was exceeded, count as
+// dropped for the adaptive limit.
+func ConcurrencyLimitWithLimiter[T IContext](l *ConcurrencyLimiter) HandlerFunc[T] {
+	retryAfter := strconv.FormatInt(ceilSeconds(l.conf.RetryAfter), 10)
+
+	return func(c T) {
+		if !l.acquire(c.GetExecer().Context()) {
+			c.GetExecer().Header("Retry-After", retryAfter)
+			l.conf.Rejected(c)
+			return
+		}
+
+		start := time.Now()
+		defer func() {
+			// the deadline of Timeout is installed on the execer context, not on the request
+			ctx := c.GetExecer().Context()
+			if ctx == nil {
+				ctx = c.Req().Context()
+			}
+			status := c.Rsp().Status()
+			dropped := status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout ||
+				errors.Is(ctx.Err(), context.DeadlineExceeded)
+			l.release(time.Since(start), dropped)
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,155 @@
+package hi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrencyLimitSheds(t *testing.T) {
+	limiter := NewConcurrencyLimiter(ConcurrencyLimiterConfig{Limit: 1, RetryAfter: 2 * time.Second})
+	router := New(&Context{})
+	router.Use(ConcurrencyLimitWithLimiter[*Context](limiter))
+	entered, unblock := make(chan struct{}), make(chan struct{})
+	router.GET("/slow", func(c *Context) {
+		close(entered)
+		<-unblock
+	})
+	router.GET("/fast", func(c *Context) {})
+
+	done := make(chan int)
+	go func() { done <- PerformRequest(router, http.MethodGet, "/slow").Code }()
+	<-entered
+
+	w := PerformRequest(router, http.MethodGet, "/fast")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, ConcurrencyStats{Limit: 1, InFlight: 1, Accepted: 1, Rejected: 1}, limiter.Stats())
+
+	close(unblock)
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.Equal(t, http.StatusOK, PerformRequest(router, http.MethodGet, "/fast").Code)
+	assert.Equal(t, 0, limiter.Stats().InFlight)
+}
+
+func TestConcurrencyLimitQueues(t *testing.T) {
+	limiter := NewConcurrencyLimiter(ConcurrencyLimiterConfig{Limit: 1, MaxQueue: 1, QueueTimeout: time.Second})
+	router := New(&Context{})
+	group := router.Group("/limited", ConcurrencyLimitWithLimiter[*Context](limiter))
+	entered, unblock := make(chan struct{}, 2), make(chan struct{})
+	group.GET("/", func(c *Context) {
+		entered <- struct{}{}
+		<-unblock
+	})
+	router.GET("/free", func(c *Context) {})
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- PerformRequest(router, http.MethodGet, "/limited/").Code
+		}()
+	}
+	<-entered
+	require.Eventually(t, func() bool { return limiter.Stats().Queued == 1 }, time.Second, time.Millisecond)
+
+	// the queue is full
+	assert.Equal(t, http.StatusServiceUnavailable, PerformRequest(router, http.MethodGet, "/limited/").Code)
+	// routes outside of the group are not limited
+	assert.Equal(t, http.StatusOK, PerformRequest(router, http.MethodGet, "/free").Code)
+
+	close(unblock)
+	wg.Wait()
+	assert.Equal(t, http.StatusOK, <-codes)
+	assert.Equal(t, http.StatusOK, <-codes)
+	assert.Equal(t, uint64(2), limiter.Stats().Accepted)
+}
+
+func TestConcurrencyLimitQueueTimeout(t *testing.T) {
+	limiter := NewConcurrencyLimiter(ConcurrencyLimiterConfig{Limit: 1, QueueTimeout: 10 * time.Millisecond})
+	require.True(t, limiter.acquire(nil))
+	start := time.Now()
+	assert.False(t, limiter.acquire(nil))
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+	assert.Equal(t, 0, limiter.Stats().Queued)
+	limiter.release(time.Millisecond, false)
+}
+
+func TestAIMDLimit(t *testing.T) {
+	aimd := &AIMDLimit{Min: 2, Max: 10, Timeout: 100 * time.Millisecond}
+	assert.InDelta(t, 4.25, aimd.Update(4, 4, time.Millisecond, false), 1e-9)
+	assert.InDelta(t, 4, aimd.Update(4, 1, time.Millisecond, false), 1e-9)
+	assert.InDelta(t, 3.6, aimd.Update(4, 4, time.Millisecond, true), 1e-9)
+	assert.InDelta(t, 3.6, aimd.Update(4, 4, time.Second, false), 1e-9)
+	assert.InDelta(t, 2, aimd.Update(2, 2, time.Second, false), 1e-9)
+	assert.InDelta(t, 10, aimd.Update(10, 10, time.Millisecond, false), 1e-9)
+}
+
+func TestGradientLimit(t *testing.T) {
+	gradient := &GradientLimit{Min: 1, Max: 100}
+	limit := 16.0
+	// at the minimum latency, the limit grows by the queue allowance
+	limit = gradient.Update(limit, 16, 10*time.Millisecond, false)
+	assert.InDelta(t, 16.8, limit, 1e-9)
+	// latency doubles: the limit shrinks
+	next := gradient.Update(limit, 16, 20*time.Millisecond, false)
+	assert.Less(t, next, limit)
+
+	for i := 0; i < 100; i++ {
+		limit = gradient.Update(limit, 16, time.Second, true)
+	}
+	assert.Less(t, limit, 10.0)
+	assert.GreaterOrEqual(t, limit, 1.0)
+}
+
+func TestConcurrencyLimiterAdaptive(t *testing.T) {
+	limiter := NewConcurrencyLimiter(ConcurrencyLimiterConfig{Limit: 4, Adaptive: &AIMDLimit{Min: 1, Max: 8}})
+	router := New(&Context{})
+	router.Use(ConcurrencyLimitWithLimiter[*Context](limiter))
+	router.GET("/", func(c *Context) { c.Status(http.StatusServiceUnavailable) })
+
+	for i := 0; i < 5; i++ {
+		PerformRequest(router, http.MethodGet, "/")
+	}
+	assert.Equal(t, 2, limiter.Stats().Limit)
+
+	// the deadline of Timeout counts as dropped, whatever the status
+	limiter = NewConcurrencyLimiter(ConcurrencyLimiterConfig{Limit: 4, Adaptive: &AIMDLimit{Min: 1, Max: 8}})
+	router = New(&Context{})
+	router.Use(TimeoutWithConfig[*Context](TimeoutConfig{Timeout: 10 * time.Millisecond, StatusCode: http.StatusRequestTimeout}))
+	router.Use(ConcurrencyLimitWithLimiter[*Context](limiter))
+	router.GET("/", func(c *Context) { <-c.Done() })
+
+	assert.Equal(t, http.StatusRequestTimeout, PerformRequest(router, http.MethodGet, "/").Code)
+	assert.Equal(t, 3, limiter.Stats().Limit)
+}
+
+func TestConcurrencyLimiterMetrics(t *testing.T) {
+	reg := NewMetricsRegistry()
+	limiter := NewConcurrencyLimiter(ConcurrencyLimiterConfig{Limit: 3})
+	limiter.RegisterMetrics(reg, "api_concurrency")
+	require.True(t, limiter.acquire(nil))
+
+	w := httptest.NewRecorder()
+	reg.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, line := range []string{
+		"api_concurrency_limit 3",
+		"api_concurrency_in_flight 1",
+		"api_concurrency_queued 0",
+		"# TYPE api_concurrency_accepted_total counter",
+		"api_concurrency_accepted_total 1",
+		"api_concurrency_rejected_total 0",
+	} {
+		assert.True(t, strings.Contains(body, line+"\n"), line)
+	}
+	assert.Panics(t, func() { ConcurrencyLimit[*Context](0) })
+}
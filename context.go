@@ -1,7 +1,9 @@
 package hi
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"math"
 	"mime/multipart"
@@ -84,6 +86,8 @@ type Context struct {
 	// note: from engin field and func
 
 	// ContextWithFallback enable fallback Context.Deadline(), Context.Done(), Context.Err() and Context.Value() when Context.Request.Context() is not nil.
+	// Requests served by the engine always answer them from the request context, so this
+	// only matters for contexts created outside of it (e.g. CreateTestContext).
 	ContextWithFallback bool
 
 	// MaxMultipartMemory value of 'maxMemory' param that is given to http.Request's ParseMultipartForm
@@ -345,10 +349,11 @@ func (c *Context) Value(key any) any {
 			return val.Any()
 		}
 	}
-	if !c.hasRequestContext() {
+	ctx := c.stdContext()
+	if ctx == nil {
 		return nil
 	}
-	return c.Request.Context().Value(key)
+	return ctx.Value(key)
 }
 
 // Get returns the value for the given key, ie: (value, true).
@@ -712,11 +717,16 @@ func (c *Context) BindUri(obj any) error {
 }
 
 // MustBindWith binds the passed struct pointer using the specified binding engine.
-// It will abort the request with HTTP 400 if any error occurs.
+// It will abort the request with HTTP 400 if any error occurs, 413 if the request body
+// exceeds its limit, see BodyLimit.
 // See the binding package.
 func (c *Context) MustBindWith(obj any, b binding.Binding) error {
 	if err := c.ShouldBindWith(obj, b); err != nil {
-		c.AbortWithError(http.StatusBadRequest, err).SetType(ErrorTypeBind) //nolint: errcheck
+		code := http.StatusBadRequest
+		if errors.Is(err, binding.ErrBodyTooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		c.AbortWithError(code, err).SetType(ErrorTypeBind) //nolint: errcheck
 		return err
 	}
 	return nil
@@ -778,13 +788,19 @@ func (c *Context) ShouldBindUri(obj any) error {
 	for _, v := range params {
 		m[v.Key] = []string{v.Value}
 	}
-	return binding.Uri.BindUri(m, obj)
+	end := startTraceSpan(c, TraceBinding, "bind uri")
+	err := binding.Uri.BindUri(m, obj)
+	end(err)
+	return err
 }
 
 // ShouldBindWith binds the passed struct pointer using the specified binding engine.
 // See the binding package.
 func (c *Context) ShouldBindWith(obj any, b binding.Binding) error {
-	return b.Bind(c.Request, obj)
+	end := startTraceSpan(c, TraceBinding, "bind "+b.Name())
+	err := b.Bind(c.Request, obj)
+	end(err)
+	return err
 }
 
 // ShouldBindBodyWith is similar with ShouldBindWith, but it stores the request
@@ -793,6 +809,9 @@ func (c *Context) ShouldBindWith(obj any, b binding.Binding) error {
 // NOTE: This method reads the body before binding. So you should use
 // ShouldBindWith for better performance if you need to call only once.
 func (c *Context) ShouldBindBodyWith(obj any, bb binding.BindingBody) (err error) {
+	end := startTraceSpan(c, TraceBinding, "bind "+bb.Name())
+	defer func() { end(err) }()
+
 	var body []byte
 	if cb := c.Get(BodyBytesKey); !cb.IsNil() {
 		if cbb, ok := cb.Any().([]byte); ok {
@@ -802,7 +821,7 @@ func (c *Context) ShouldBindBodyWith(obj any, bb binding.BindingBody) (err error
 	if body == nil {
 		body, err = io.ReadAll(c.Request.Body)
 		if err != nil {
-			return err
+			return binding.BodyError(c.Request, err)
 		}
 		c.Set(BodyBytesKey, body)
 	}
@@ -928,6 +947,24 @@ func (c *Context) SetCookie(name, value string, maxAge int, path, domain string,
 	})
 }
 
+// setContextCookie sets cookie through Context.SetCookie when c is a *Context, leaving its
+// SameSite setting as it was, and directly on the response otherwise. The value is escaped
+// the way Context.SetCookie does.
+func setContextCookie(c IContext, cookie *http.Cookie) {
+	if ctx, ok := c.(*Context); ok {
+		prev := ctx.sameSite
+		ctx.SetSameSite(cookie.SameSite)
+		ctx.SetCookie(cookie.Name, cookie.Value, cookie.MaxAge, cookie.Path, cookie.Domain, cookie.Secure, cookie.HttpOnly)
+		ctx.sameSite = prev
+		return
+	}
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+	cookie.Value = url.QueryEscape(cookie.Value)
+	http.SetCookie(c.Rsp(), cookie)
+}
+
 // Cookie returns the named cookie provided in the request or
 // ErrNoCookie if not found. And return the named cookie is unescaped.
 // If multiple cookies match the given name, only one cookie will
@@ -942,6 +979,80 @@ func (c *Context) Cookie(name string) (string, error) {
 	return val, nil
 }
 
+// SetSignedCookie sets a cookie whose value is signed with the Engine.Keyring, so that the
+// client can read it but not change it. value is converted to a string. It returns
+// ErrNoKeyring, and sets no cookie, without an Engine.Keyring.
+func (c *Context) SetSignedCookie(name string, value any, maxAge int, path, domain string, secure, httpOnly bool) error {
+	k := c.execer.Keyring()
+	if k == nil {
+		return ErrNoKeyring
+	}
+	c.SetCookie(name, k.Sign(name, to.String(value)), maxAge, path, domain, secure, httpOnly)
+	return nil
+}
+
+// SignedCookie returns the value of the named cookie set by SetSignedCookie, or the specified
+// defaultValue if it does not exist. A cookie whose signature is invalid is ignored, and
+// ErrCookieSignature is added to the context errors, as is ErrNoKeyring without an
+// Engine.Keyring.
+func (c *Context) SignedCookie(name string, defaultValue ...any) *to.Value {
+	if value, ok := c.readCookie(name, func(k *Keyring, raw string) (string, error) { return k.Verify(name, raw) }); ok {
+		return to.V(value)
+	}
+	if len(defaultValue) == 0 {
+		return nil
+	}
+	return to.V(defaultValue[0])
+}
+
+// SetEncryptedCookie sets a cookie whose value is encrypted with the Engine.Keyring, so that
+// the client can neither read nor change it. value is converted to a string. It returns
+// ErrNoKeyring, and sets no cookie, without an Engine.Keyring.
+func (c *Context) SetEncryptedCookie(name string, value any, maxAge int, path, domain string, secure, httpOnly bool) error {
+	k := c.execer.Keyring()
+	if k == nil {
+		return ErrNoKeyring
+	}
+	c.SetCookie(name, k.Encrypt(name, []byte(to.String(value))), maxAge, path, domain, secure, httpOnly)
+	return nil
+}
+
+// EncryptedCookie returns the value of the named cookie set by SetEncryptedCookie, or the
+// specified defaultValue if it does not exist. A cookie that can not be decrypted is ignored,
+// and ErrCookieDecrypt is added to the context errors, as is ErrNoKeyring without an
+// Engine.Keyring.
+func (c *Context) EncryptedCookie(name string, defaultValue ...any) *to.Value {
+	decrypt := func(k *Keyring, raw string) (string, error) {
+		plaintext, err := k.Decrypt(name, raw)
+		return string(plaintext), err
+	}
+	if value, ok := c.readCookie(name, decrypt); ok {
+		return to.V(value)
+	}
+	if len(defaultValue) == 0 {
+		return nil
+	}
+	return to.V(defaultValue[0])
+}
+
+func (c *Context) readCookie(name string, open func(k *Keyring, raw string) (string, error)) (string, bool) {
+	raw, err := c.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	k := c.execer.Keyring()
+	if k == nil {
+		_ = c.Error(fmt.Errorf("cookie %s: %w", name, ErrNoKeyring))
+		return "", false
+	}
+	value, err := open(k, raw)
+	if err != nil {
+		_ = c.Error(fmt.Errorf("cookie %s: %w", name, err))
+		return "", false
+	}
+	return value, true
+}
+
 // Render writes the response headers and calls render.Render to render data.
 func (c *Context) Render(code int, r render.Render) {
 	c.Status(code)
@@ -952,7 +1063,10 @@ func (c *Context) Render(code int, r render.Render) {
 		return
 	}
 
-	if err := r.Render(c.Response); err != nil {
+	end := startTraceSpan(c, TraceRender, "render")
+	err := r.Render(c.Response)
+	end(err)
+	if err != nil {
 		// Pushing error to c.Errors
 		_ = c.Error(err)
 		c.Abort()
@@ -1120,7 +1234,7 @@ func (c *Context) SSEvent(name string, message any) {
 // indicates "Is client disconnected in middle of stream"
 func (c *Context) Stream(step func(w io.Writer) bool) bool {
 	w := c.Response
-	clientGone := w.CloseNotify()
+	clientGone := c.Done()
 	for {
 		select {
 		case <-clientGone:
@@ -1226,31 +1340,55 @@ func (c *Context) hasRequestContext() bool {
 	return hasFallback && hasRequestContext
 }
 
+// stdContext returns the context.Context that Deadline, Done, Err and Value are
+// answered from: the one installed on the execer (e.g. by Timeout) if any,
+// otherwise c.Request.Context() when ContextWithFallback is enabled.
+func (c *Context) stdContext() context.Context {
+	if c.execer != nil {
+		if ctx := c.execer.Context(); ctx != nil {
+			return ctx
+		}
+	}
+	if c.hasRequestContext() {
+		return c.Request.Context()
+	}
+	return nil
+}
+
 // Deadline returns that there is no deadline (ok==false) when c.Request has no Context.
 func (c *Context) Deadline() (deadline time.Time, ok bool) {
-	if !c.hasRequestContext() {
+	ctx := c.stdContext()
+	if ctx == nil {
 		return
 	}
-	return c.Request.Context().Deadline()
+	return ctx.Deadline()
 }
 
 // Done returns nil (chan which will wait forever) when c.Request has no Context.
 func (c *Context) Done() <-chan struct{} {
-	if !c.hasRequestContext() {
+	ctx := c.stdContext()
+	if ctx == nil {
 		return nil
 	}
-	return c.Request.Context().Done()
+	return ctx.Done()
 }
 
 // Err returns nil when c.Request has no Context.
 func (c *Context) Err() error {
-	if !c.hasRequestContext() {
+	ctx := c.stdContext()
+	if ctx == nil {
 		return nil
 	}
-	return c.Request.Context().Err()
+	return ctx.Err()
 }
 
-// ClientIP implements one best effort algorithm to return the real client IP.
+// ClientIP returns the IP of the client: the address of the connection or, for the requests
+// of the Engine.SetTrustedProxies, the address reported in the first of RemoteIPHeaders that
+// holds one, unless ForwardedByClientIP is disabled.
 func (c *Context) ClientIP() string {
-	return ClientIP(c.Request)
+	var headers []string
+	if c.ForwardedByClientIP {
+		headers = c.RemoteIPHeaders
+	}
+	return clientIP(c, headers)
 }
@@ -0,0 +1,483 @@
+package hi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CSRFKey is the key the masked CSRF token of a request is stored under in the context. In
+// CSRFSynchronizer mode, the token of a request without a secret is only stored there once it
+// is issued by CSRFToken.
+const CSRFKey = "csrf_token"
+
+// CSRF errors, recorded in the context errors of the rejected requests.
+var (
+	ErrCSRFTokenMissing = errors.New("csrf: token missing")
+	ErrCSRFTokenInvalid = errors.New("csrf: token invalid")
+	ErrCSRFOrigin       = errors.New("csrf: origin not allowed")
+)
+
+// csrfFieldKey is the key the name of the CSRF form field is stored under in the context.
+const csrfFieldKey = "_hi/csrffield"
+
+// csrfIssueKey is the key the function issuing the pending secret of a request is stored
+// under in the context, in CSRFSynchronizer mode.
+const csrfIssueKey = "_hi/csrfissue"
+
+const csrfSecretLength = 32
+
+// CSRFMode selects where the CSRF secret is kept.
+type CSRFMode uint8
+
+const (
+	// CSRFDoubleSubmit keeps the secret in a cookie, the submitted token must match it. Set
+	// CSRFConfig.Key to sign the cookie, so that a sibling subdomain can not plant one.
+	CSRFDoubleSubmit CSRFMode = iota
+	// CSRFSynchronizer keeps the secret in a CSRFStore, the cookie only carries its ID.
+	CSRFSynchronizer
+)
+
+// CSRFStore keeps the secrets of the CSRFSynchronizer mode.
+type CSRFStore interface {
+	// Get returns the secret stored under id, ok is false if there is none.
+	Get(ctx context.Context, id string) (secret string, ok bool, err error)
+	// Set stores secret under id for ttl.
+	Set(ctx context.Context, id, secret string, ttl time.Duration) error
+}
+
+// CSRFConfig defines the config for CSRF middleware.
+type CSRFConfig struct {
+	// Mode selects where the secret is kept.
+	// Optional. Default value is CSRFDoubleSubmit.
+	Mode CSRFMode
+
+	// Key signs the cookie in CSRFDoubleSubmit mode.
+	// Optional. Default value is an unsigned cookie.
+	Key []byte
+
+	// Store keeps the secrets in CSRFSynchronizer mode.
+	// Optional. Default value is a new in-memory store, see NewMemoryCSRFStore.
+	Store CSRFStore
+
+	// Header is the request header the token is read from, and the response header it is
+	// exposed on. In CSRFSynchronizer mode, a new secret is only exposed once CSRFToken or
+	// CSRFTemplateField is called.
+	// Optional. Default value is "X-CSRF-Token".
+	Header string
+
+	// FormField is the form field the token is read from when the header is missing.
+	// Optional. Default value is "csrf_token".
+	FormField string
+
+	// CookieName is the name of the cookie.
+	// Optional. Default value is "_csrf".
+	CookieName string
+
+	// CookiePath, CookieDomain and CookieSecure are the attributes of the cookie.
+	// Optional. Default path is "/".
+	CookiePath   string
+	CookieDomain string
+	CookieSecure bool
+
+	// CookieMaxAge is the lifetime of the cookie, in seconds, and of the stored secret.
+	// Optional. Default value is 12 hours.
+	CookieMaxAge int
+
+	// SameSite is passed to Context.SetSameSite for the cookie.
+	// Optional. Default value is http.SameSiteLaxMode.
+	SameSite http.SameSite
+
+	// TrustedOrigins are the origins, e.g. "https://admin.example.com", allowed besides the one
+	// of the request host.
+	// Optional.
+	TrustedOrigins []string
+
+	// ExemptPaths are route template prefixes that are not checked, typically the BasePath()
+	// of the route groups receiving cross-site requests such as webhooks. They match whole
+	// path segments: "/api" exempts "/api" and "/api/...", not "/apikeys".
+	// Optional.
+	ExemptPaths []string
+
+	// Skip is a Skipper that indicates which requests are not checked.
+	// Optional.
+	Skip Skipper
+
+	// ErrorHandler answers the rejected requests.
+	// Optional. Default value records err and aborts with status 403.
+	ErrorHandler func(c IContext, err error)
+}
+
+// CSRF returns a middleware protecting the unsafe methods against cross-site request forgery
+// in CSRFDoubleSubmit mode.
+func CSRF[T IContext]() HandlerFunc[T] {
+	return CSRFWithConfig[T](CSRFConfig{})
+}
+
+// CSRFWithConfig returns a CSRF middleware with config.
+//
+// Every request gets a per-request masked token, available with CSRFToken and CSRFTemplateField
+// for templates and on the response header. Requests with unsafe methods must send it back in
+// the header or the form field, and come from an allowed Origin (or Referer).
+//
+// In CSRFSynchronizer mode, the secret of a client without one is only written to the Store
+// when its token is first used, so that requests never rendering it do not fill the store.
+func CSRFWithConfig[T IContext](conf CSRFConfig) HandlerFunc[T] {
+	if conf.Mode == CSRFSynchronizer && conf.Store == nil {
+		conf.Store = NewMemoryCSRFStore()
+	}
+	if conf.Header == "" {
+		conf.Header = "X-CSRF-Token"
+	}
+	if conf.FormField == "" {
+		conf.FormField = "csrf_token"
+	}
+	if conf.CookieName == "" {
+		conf.CookieName = "_csrf"
+	}
+	if conf.CookiePath == "" {
+		conf.CookiePath = "/"
+	}
+	if conf.CookieMaxAge == 0 {
+		conf.CookieMaxAge = 12 * 60 * 60
+	}
+	if conf.SameSite == 0 {
+		conf.SameSite = http.SameSiteLaxMode
+	}
+	if conf.ErrorHandler == nil {
+		conf.ErrorHandler = defaultCSRFErrorHandler
+	}
+	csrf := &csrfProtector{conf: conf}
+
+	return func(c T) {
+		req := c.Req()
+		secret, found, err := csrf.loadSecret(c)
+		if err != nil {
+			conf.ErrorHandler(c, err)
+			return
+		}
+		c.Set(csrfFieldKey, conf.FormField)
+		addVary(c.Rsp().Header(), "Cookie")
+		switch {
+		case found:
+			csrf.setToken(c, maskCSRFToken(secret))
+		case conf.Mode == CSRFSynchronizer:
+			// the cookie is set now, while the header can still be modified, but the
+			// secret it refers to is only stored by CSRFToken
+			id, pending := randomCSRFSecret(), randomCSRFSecret()
+			csrf.setCookie(c, id)
+			c.Set(csrfIssueKey, sync.OnceValue(func() string { return csrf.issue(c, id, pending) }))
+		default:
+			csrf.setToken(c, maskCSRFToken(csrf.newSecret(c)))
+		}
+
+		if csrfSafeMethod(req.Method) || csrf.exempt(c) {
+			return
+		}
+		if err := csrf.checkOrigin(c); err != nil {
+			conf.ErrorHandler(c, err)
+			return
+		}
+		sent := req.Header.Get(conf.Header)
+		if sent == "" {
+			sent = req.PostFormValue(conf.FormField)
+		}
+		switch {
+		case sent == "" || !found:
+			conf.ErrorHandler(c, ErrCSRFTokenMissing)
+		case !validCSRFToken(sent, secret):
+			conf.ErrorHandler(c, ErrCSRFTokenInvalid)
+		}
+	}
+}
+
+// CSRFToken returns the masked CSRF token of the request, or "" if the CSRF middleware is not
+// installed. It changes on every request, so it can be embedded in compressed pages.
+func CSRFToken(c IContext) string {
+	keys := c.GetKeys()
+	if token, ok := keys[CSRFKey].(string); ok {
+		return token
+	}
+	if issue, ok := keys[csrfIssueKey].(func() string); ok {
+		return issue()
+	}
+	return ""
+}
+
+// CSRFTemplateField returns a hidden form input carrying the CSRF token, for templates.
+func CSRFTemplateField(c IContext) template.HTML {
+	field, _ := c.GetKeys()[csrfFieldKey].(string)
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(field) + // #nosec G203
+		`" value="` + template.HTMLEscapeString(CSRFToken(c)) + `">`)
+}
+
+func defaultCSRFErrorHandler(c IContext, err error) {
+	_ = c.Error(err)
+	c.GetExecer().AbortWithStatus(http.StatusForbidden)
+}
+
+func csrfSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+type csrfProtector struct {
+	conf CSRFConfig
+}
+
+func (p *csrfProtector) exempt(c IContext) bool {
+	if p.conf.Skip != nil && p.conf.Skip(c) {
+		return true
+	}
+	route := c.GetExecer().FullPath()
+	if route == "" {
+		return false
+	}
+	for _, prefix := range p.conf.ExemptPaths {
+		if route == prefix || strings.HasPrefix(route, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin requires the Origin, or failing that the Referer, to be the one of the request
+// scheme and host or a trusted one. Requests carrying neither are only accepted over plain
+// HTTP, as told by isHTTPS.
+func (p *csrfProtector) checkOrigin(c IContext) error {
+	req := c.Req()
+	https := isHTTPS(c)
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		referer := req.Header.Get("Referer")
+		if referer == "" {
+			if https {
+				return ErrCSRFOrigin
+			}
+			return nil
+		}
+		u, err := url.Parse(referer)
+		if err != nil {
+			return ErrCSRFOrigin
+		}
+		origin = u.Scheme + "://" + u.Host
+	}
+	if slices.Contains(p.conf.TrustedOrigins, origin) {
+		return nil
+	}
+	scheme := "http"
+	if https {
+		scheme = "https"
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" || !strings.EqualFold(u.Scheme, scheme) || !strings.EqualFold(u.Host, req.Host) {
+		return ErrCSRFOrigin
+	}
+	return nil
+}
+
+// loadSecret returns the secret of the request, found is false if it has none or its
+// cookie does not verify.
+func (p *csrfProtector) loadSecret(c IContext) (secret string, found bool, err error) {
+	cookie, err := c.Req().Cookie(p.conf.CookieName)
+	if err != nil || cookie.Value == "" {
+		return "", false, nil
+	}
+	value, err := url.QueryUnescape(cookie.Value)
+	if err != nil {
+		return "", false, nil
+	}
+
+	if p.conf.Mode == CSRFSynchronizer {
+		return p.conf.Store.Get(c.Req().Context(), value)
+	}
+	secret = value
+	if p.conf.Key != nil {
+		var mac string
+		var ok bool
+		if secret, mac, ok = strings.Cut(value, "."); !ok || !hmac.Equal([]byte(mac), []byte(p.sign(secret))) {
+			return "", false, nil
+		}
+	}
+	if raw, err := base64.RawURLEncoding.DecodeString(secret); err != nil || len(raw) != csrfSecretLength {
+		return "", false, nil
+	}
+	return secret, true, nil
+}
+
+// newSecret generates a secret and sets the cookie carrying it, in CSRFDoubleSubmit mode.
+func (p *csrfProtector) newSecret(c IContext) string {
+	secret := randomCSRFSecret()
+	value := secret
+	if p.conf.Key != nil {
+		value = secret + "." + p.sign(secret)
+	}
+	p.setCookie(c, value)
+	return secret
+}
+
+// issue stores the pending secret of a request under the id its cookie carries, and returns
+// its token. Failures are recorded in the context errors and yield an empty token.
+func (p *csrfProtector) issue(c IContext, id, secret string) string {
+	ttl := time.Duration(p.conf.CookieMaxAge) * time.Second
+	if err := p.conf.Store.Set(c.Req().Context(), id, secret, ttl); err != nil {
+		_ = c.Error(err)
+		p.setToken(c, "")
+		return ""
+	}
+	token := maskCSRFToken(secret)
+	p.setToken(c, token)
+	return token
+}
+
+func (p *csrfProtector) setToken(c IContext, token string) {
+	c.Set(CSRFKey, token)
+	if token != "" {
+		c.GetExecer().Header(p.conf.Header, token)
+	}
+}
+
+func (p *csrfProtector) sign(secret string) string {
+	mac := hmac.New(sha256.New, p.conf.Key)
+	mac.Write([]byte(secret))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (p *csrfProtector) setCookie(c IContext, value string) {
+	setContextCookie(c, &http.Cookie{
+		Name:     p.conf.CookieName,
+		Value:    value,
+		MaxAge:   p.conf.CookieMaxAge,
+		Path:     p.conf.CookiePath,
+		Domain:   p.conf.CookieDomain,
+		SameSite: p.conf.SameSite,
+		Secure:   p.conf.CookieSecure,
+		HttpOnly: true,
+	})
+}
+
+func randomCSRFSecret() string {
+	b := make([]byte, csrfSecretLength)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// maskCSRFToken returns a one-time pad followed by the secret XORed with it, so that the token
+// differs on every response (BREACH).
+func maskCSRFToken(secret string) string {
+	raw, _ := base64.RawURLEncoding.DecodeString(secret)
+	token := make([]byte, 2*len(raw))
+	if _, err := rand.Read(token[:len(raw)]); err != nil {
+		panic(err)
+	}
+	for i, b := range raw {
+		token[len(raw)+i] = b ^ token[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+func validCSRFToken(token, secret string) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != 2*csrfSecretLength {
+		return false
+	}
+	want, _ := base64.RawURLEncoding.DecodeString(secret)
+	got := make([]byte, csrfSecretLength)
+	for i := range got {
+		got[i] = raw[i] ^ raw[csrfSecretLength+i]
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// DefaultMemoryCSRFStoreLimit is the number of secrets a MemoryCSRFStore returned by
+// NewMemoryCSRFStore holds.
+const DefaultMemoryCSRFStoreLimit = 100_000
+
+// MemoryCSRFStore is an in-memory CSRFStore. Expired secrets are evicted lazily, and the
+// oldest ones when it is full.
+type MemoryCSRFStore struct {
+	mu        sync.Mutex
+	secrets   map[string]csrfEntry
+	limit     int
+	lastSweep time.Time
+}
+
+type csrfEntry struct {
+	secret  string
+	expires time.Time
+}
+
+var _ CSRFStore = (*MemoryCSRFStore)(nil)
+
+// NewMemoryCSRFStore returns an empty MemoryCSRFStore holding up to
+// DefaultMemoryCSRFStoreLimit secrets.
+func NewMemoryCSRFStore() *MemoryCSRFStore {
+	return NewMemoryCSRFStoreWithLimit(DefaultMemoryCSRFStoreLimit)
+}
+
+// NewMemoryCSRFStoreWithLimit returns an empty MemoryCSRFStore holding up to limit secrets.
+func NewMemoryCSRFStoreWithLimit(limit int) *MemoryCSRFStore {
+	assert1(limit > 0, "the CSRF store limit must be positive")
+	return &MemoryCSRFStore{secrets: make(map[string]csrfEntry), limit: limit}
+}
+
+// Get implements the CSRFStore interface.
+func (s *MemoryCSRFStore) Get(_ context.Context, id string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.secrets[id]
+	if !ok || !time.Now().Before(e.expires) {
+		return "", false, nil
+	}
+	return e.secret, true, nil
+}
+
+// Set implements the CSRFStore interface.
+func (s *MemoryCSRFStore) Set(_ context.Context, id, secret string, ttl time.Duration) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, replace := s.secrets[id]
+	full := !replace && len(s.secrets) >= s.limit
+	if full || now.Sub(s.lastSweep) > time.Minute {
+		s.lastSweep = now
+		for key, e := range s.secrets {
+			if !now.Before(e.expires) {
+				delete(s.secrets, key)
+			}
+		}
+	}
+	if !replace && len(s.secrets) >= s.limit {
+		s.evictOldest()
+	}
+	s.secrets[id] = csrfEntry{secret: secret, expires: now.Add(ttl)}
+	return nil
+}
+
+// evictOldest removes the secret expiring first.
+func (s *MemoryCSRFStore) evictOldest() {
+	var oldest string
+	var expires time.Time
+	for key, e := range s.secrets {
+		if oldest == "" || e.expires.Before(expires) {
+			oldest, expires = key, e.expires
+		}
+	}
+	delete(s.secrets, oldest)
+}
@@ -0,0 +1,218 @@
+package hi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func csrfRouter(conf CSRFConfig) *Engine[*Context] {
+	router := New(&Context{})
+	router.Use(CSRFWithConfig[*Context](conf))
+	router.GET("/form", func(c *Context) { c.String(http.StatusOK, string(CSRFTemplateField(c))) })
+	router.POST("/form", func(c *Context) { c.String(http.StatusOK, "saved") })
+	hooks := router.Group("/hooks")
+	hooks.POST("/github", func(c *Context) { c.String(http.StatusOK, "hook") })
+	router.POST("/hooksadmin", func(c *Context) { c.String(http.StatusOK, "admin") })
+	return router
+}
+
+func csrfCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	return cookies[0]
+}
+
+func postCSRF(router http.Handler, cookie *http.Cookie, token string, headers ...header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/form", strings.NewReader(url.Values{"csrf_token": {token}}.Encode()))
+	req.Header.Set("Content-Type", MIMEPOSTForm)
+	for _, h := range headers {
+		req.Header.Set(h.Key, h.Value)
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	router := csrfRouter(CSRFConfig{Key: []byte("secret")})
+
+	w := PerformRequest(router, http.MethodGet, "/form")
+	assert.Equal(t, http.StatusOK, w.Code)
+	cookie := csrfCookie(t, w)
+	assert.Equal(t, "_csrf", cookie.Name)
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+	token := w.Header().Get("X-CSRF-Token")
+	assert.Equal(t, `<input type="hidden" name="csrf_token" value="`+token+`">`, w.Body.String())
+
+	// the token is masked differently on every response
+	req := httptest.NewRequest(http.MethodGet, "/form", nil)
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Empty(t, w.Result().Cookies())
+	other := w.Header().Get("X-CSRF-Token")
+	assert.NotEqual(t, token, other)
+
+	assert.Equal(t, "saved", postCSRF(router, cookie, token).Body.String())
+	assert.Equal(t, http.StatusOK, postCSRF(router, cookie, "", header{"X-CSRF-Token", other}).Code)
+
+	w = postCSRF(router, cookie, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = postCSRF(router, nil, token)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = postCSRF(router, cookie, token[:len(token)-2]+"AA")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// a planted unsigned cookie is ignored
+	planted := &http.Cookie{Name: "_csrf", Value: strings.Split(cookie.Value, ".")[0]}
+	assert.Equal(t, http.StatusForbidden, postCSRF(router, planted, token).Code)
+}
+
+func TestCSRFSynchronizer(t *testing.T) {
+	store := NewMemoryCSRFStore()
+	router := csrfRouter(CSRFConfig{Mode: CSRFSynchronizer, Store: store})
+
+	w := PerformRequest(router, http.MethodGet, "/form")
+	cookie := csrfCookie(t, w)
+	token := w.Header().Get("X-CSRF-Token")
+	assert.Len(t, store.secrets, 1)
+	assert.NotContains(t, store.secrets, token)
+
+	assert.Equal(t, http.StatusOK, postCSRF(router, cookie, token).Code)
+	assert.Equal(t, http.StatusForbidden, postCSRF(router, &http.Cookie{Name: "_csrf", Value: "unknown"}, token).Code)
+}
+
+func TestCSRFSynchronizerStoresRenderedSecretsOnly(t *testing.T) {
+	store := NewMemoryCSRFStore()
+	router := csrfRouter(CSRFConfig{Mode: CSRFSynchronizer, Store: store})
+	router.GET("/plain", func(c *Context) { c.String(http.StatusOK, "ok") })
+
+	for range 3 {
+		w := PerformRequest(router, http.MethodGet, "/plain")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("X-CSRF-Token"))
+		PerformRequest(router, http.MethodHead, "/plain")
+	}
+	assert.Empty(t, store.secrets)
+
+	// the cookie set by a request that did not render the token refers to nothing
+	w := PerformRequest(router, http.MethodGet, "/plain")
+	assert.Equal(t, http.StatusForbidden, postCSRF(router, csrfCookie(t, w), "").Code)
+
+	w = PerformRequest(router, http.MethodGet, "/form")
+	assert.Len(t, store.secrets, 1)
+	assert.Equal(t, http.StatusOK, postCSRF(router, csrfCookie(t, w), w.Header().Get("X-CSRF-Token")).Code)
+}
+
+func TestMemoryCSRFStoreLimit(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryCSRFStoreWithLimit(2)
+	require.NoError(t, store.Set(ctx, "a", "1", time.Hour))
+	require.NoError(t, store.Set(ctx, "b", "2", 2*time.Hour))
+	require.NoError(t, store.Set(ctx, "a", "3", 3*time.Hour))
+	assert.Len(t, store.secrets, 2)
+
+	// the secret expiring first makes room
+	require.NoError(t, store.Set(ctx, "c", "4", time.Hour))
+	assert.Len(t, store.secrets, 2)
+	_, ok, _ := store.Get(ctx, "b")
+	assert.False(t, ok)
+	secret, ok, _ := store.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, "3", secret)
+
+	// expired secrets go first
+	require.NoError(t, store.Set(ctx, "d", "5", -time.Second))
+	require.NoError(t, store.Set(ctx, "e", "6", time.Hour))
+	_, ok, _ = store.Get(ctx, "a")
+	assert.True(t, ok)
+
+	assert.Panics(t, func() { NewMemoryCSRFStoreWithLimit(0) })
+}
+
+func TestCSRFOriginChecks(t *testing.T) {
+	router := csrfRouter(CSRFConfig{TrustedOrigins: []string{"https://admin.example.com"}, ExemptPaths: []string{"/hooks"}})
+	w := PerformRequest(router, http.MethodGet, "/form")
+	cookie, token := csrfCookie(t, w), w.Header().Get("X-CSRF-Token")
+
+	assert.Equal(t, http.StatusOK, postCSRF(router, cookie, token, header{"Origin", "http://example.com"}).Code)
+	assert.Equal(t, http.StatusOK, postCSRF(router, cookie, token, header{"Origin", "https://admin.example.com"}).Code)
+	assert.Equal(t, http.StatusOK, postCSRF(router, cookie, token, header{"Referer", "http://example.com/form"}).Code)
+	assert.Equal(t, http.StatusForbidden, postCSRF(router, cookie, token, header{"Origin", "https://evil.example"}).Code)
+	assert.Equal(t, http.StatusForbidden, postCSRF(router, cookie, token, header{"Origin", "null"}).Code)
+	assert.Equal(t, http.StatusForbidden, postCSRF(router, cookie, token, header{"Referer", "https://evil.example/x"}).Code)
+
+	// exempt group
+	w = PerformRequest(router, http.MethodPost, "/hooks/github", header{"Origin", "https://github.com"})
+	assert.Equal(t, "hook", w.Body.String())
+	// the exempt paths match whole segments
+	w = PerformRequest(router, http.MethodPost, "/hooksadmin", header{"Origin", "https://github.com"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// over HTTPS, the scheme must match and an origin is required
+	require.NoError(t, router.SetTrustedProxies([]string{"192.0.2.1"}))
+	https := func(headers ...header) int {
+		return postCSRF(router, cookie, token, append(headers, header{"X-Forwarded-Proto", "https"})...).Code
+	}
+	assert.Equal(t, http.StatusOK, https(header{"Origin", "https://example.com"}))
+	assert.Equal(t, http.StatusForbidden, https(header{"Origin", "http://example.com"}))
+	assert.Equal(t, http.StatusForbidden, https(header{"Referer", "http://example.com/form"}))
+	assert.Equal(t, http.StatusForbidden, https())
+	assert.Equal(t, http.StatusOK, postCSRF(router, cookie, token).Code)
+	assert.Equal(t, http.StatusForbidden, postCSRF(router, cookie, token, header{"Origin", "https://example.com"}).Code)
+}
+
+func TestCSRFVary(t *testing.T) {
+	router := New(&Context{})
+	router.Use(func(c *Context) { c.Header("Vary", "Origin") })
+	router.Use(CSRF[*Context]())
+	router.GET("/", func(c *Context) {})
+
+	w := PerformRequest(router, http.MethodGet, "/")
+	assert.Equal(t, []string{"Origin", "Cookie"}, w.Header().Values("Vary"))
+}
+
+func TestCSRFErrorPath(t *testing.T) {
+	var errs []string
+	router := New(&Context{})
+	router.Use(func(c *Context) {
+		c.Next()
+		errs = c.Errors.Errors()
+	})
+	router.Use(CSRF[*Context]())
+	router.POST("/", func(c *Context) {})
+
+	w := PerformRequest(router, http.MethodPost, "/", header{"Origin", "https://evil.example"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, []string{ErrCSRFOrigin.Error()}, errs)
+
+	w = PerformRequest(router, http.MethodPost, "/")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, []string{ErrCSRFTokenMissing.Error()}, errs)
+}
+
+func TestCSRFKeepsContextSameSite(t *testing.T) {
+	router := New(&Context{})
+	router.Use(func(c *Context) { c.SetSameSite(http.SameSiteStrictMode) })
+	router.Use(CSRFWithConfig[*Context](CSRFConfig{SameSite: http.SameSiteNoneMode, CookieSecure: true}))
+	router.GET("/", func(c *Context) { c.SetCookie("other", "v", 0, "", "", false, false) })
+
+	w := PerformRequest(router, http.MethodGet, "/")
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 2)
+	assert.Equal(t, http.SameSiteNoneMode, cookies[0].SameSite)
+	assert.True(t, cookies[0].Secure)
+	assert.Equal(t, http.SameSiteStrictMode, cookies[1].SameSite)
+}
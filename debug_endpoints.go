@@ -0,0 +1,147 @@
+package hi
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/nbcx/hi/render"
+)
+
+var processStart = time.Now()
+
+// pprofProfiles are the runtime profiles served by name under pprof/.
+var pprofProfiles = []string{"allocs", "block", "goroutine", "heap", "mutex", "threadcreate"}
+
+// Debug registers debugging endpoints under relativePath, behind handlers (e.g. an
+// authentication middleware), and returns their group:
+//
+//	GET  pprof/         net/http/pprof index, profiles, cmdline, profile, symbol and trace
+//	GET  runtime        goroutine, scheduler and memory statistics
+//	GET  info           framework version, Mode() and the build info of the binary
+//	GET  routes         registered routes
+//	GET  routes/tree    dump of the route trees
+//
+// These endpoints disclose internals and can be expensive, never expose them unauthenticated.
+//
+//	router.Debug("/debug", hi.BasicAuth[*hi.Context](accounts))
+func (engine *Engine[T]) Debug(relativePath string, handlers ...HandlerFunc[T]) *RouterGroup[T] {
+	group := engine.Group(relativePath, handlers...)
+
+	group.GET("/pprof/", WrapF[T](pprof.Index))
+	group.GET("/pprof/cmdline", WrapF[T](pprof.Cmdline))
+	group.GET("/pprof/profile", WrapF[T](pprof.Profile))
+	group.GET("/pprof/symbol", WrapF[T](pprof.Symbol))
+	group.POST("/pprof/symbol", WrapF[T](pprof.Symbol))
+	group.GET("/pprof/trace", WrapF[T](pprof.Trace))
+	for _, name := range pprofProfiles {
+		group.GET("/pprof/"+name, WrapH[T](pprof.Handler(name)))
+	}
+
+	group.GET("/runtime", func(c T) {
+		renderDebugJSON(c, runtimeStats())
+	})
+	group.GET("/info", func(c T) {
+		renderDebugJSON(c, buildInfo())
+	})
+	group.GET("/routes", func(c T) {
+		routes := engine.Routes()
+		list := make([]map[string]string, len(routes))
+		for i, route := range routes {
+			list[i] = map[string]string{"method": route.Method, "path": route.Path, "handler": route.Handler}
+		}
+		renderDebugJSON(c, list)
+	})
+	group.GET("/routes/tree", func(c T) {
+		c.Rsp().Header().Set("Content-Type", MIMEPlain+"; charset=utf-8")
+		c.GetExecer().WriterMem().WriteHeader(http.StatusOK)
+		engine.trees.dump(c.Rsp())
+	})
+	return group
+}
+
+func renderDebugJSON[T IContext](c T, obj any) {
+	c.GetExecer().WriterMem().WriteHeader(http.StatusOK)
+	if err := (render.IndentedJSON{Data: obj}).Render(c.Rsp()); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+func runtimeStats() map[string]any {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return map[string]any{
+		"uptime":     time.Since(processStart).String(),
+		"goroutines": runtime.NumGoroutine(),
+		"cpus":       runtime.NumCPU(),
+		"gomaxprocs": runtime.GOMAXPROCS(0),
+		"cgo_calls":  runtime.NumCgoCall(),
+		"memory": map[string]any{
+			"alloc":          m.Alloc,
+			"total_alloc":    m.TotalAlloc,
+			"sys":            m.Sys,
+			"mallocs":        m.Mallocs,
+			"frees":          m.Frees,
+			"heap_alloc":     m.HeapAlloc,
+			"heap_sys":       m.HeapSys,
+			"heap_idle":      m.HeapIdle,
+			"heap_inuse":     m.HeapInuse,
+			"heap_objects":   m.HeapObjects,
+			"stack_inuse":    m.StackInuse,
+			"num_gc":         m.NumGC,
+			"pause_total_ns": m.PauseTotalNs,
+			"last_gc":        time.Unix(0, int64(m.LastGC)).UTC(),
+		},
+	}
+}
+
+func buildInfo() map[string]any {
+	info := map[string]any{
+		"version": Version,
+		"mode":    Mode(),
+		"go":      runtime.Version(),
+		"os":      runtime.GOOS,
+		"arch":    runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info["path"] = bi.Path
+		info["main"] = map[string]string{"path": bi.Main.Path, "version": bi.Main.Version, "sum": bi.Main.Sum}
+		settings := make(map[string]string, len(bi.Settings))
+		for _, setting := range bi.Settings {
+			settings[setting.Key] = setting.Value
+		}
+		info["settings"] = settings
+		deps := make([]string, len(bi.Deps))
+		for i, dep := range bi.Deps {
+			deps[i] = dep.Path + "@" + dep.Version
+		}
+		info["deps"] = deps
+	}
+	return info
+}
+
+var nodeTypeNames = [...]string{static: "static", root: "root", param: "param", catchAll: "catchAll"}
+
+// dump writes one line per node of the trees, indented by depth.
+func (trees methodTrees[T]) dump(w io.Writer) {
+	for _, tree := range trees {
+		fmt.Fprintln(w, tree.method)
+		tree.root.dump(w, 1)
+	}
+}
+
+func (n *node[T]) dump(w io.Writer, depth int) {
+	fmt.Fprintf(w, "%s%q %s", strings.Repeat("  ", depth), n.path, nodeTypeNames[n.nType])
+	if len(n.handlers) > 0 {
+		fmt.Fprintf(w, " %s (%d handlers) -> %s", n.fullPath, len(n.handlers), nameOfFunction(n.handlers.Last()))
+	}
+	fmt.Fprintln(w)
+	for _, child := range n.children {
+		child.dump(w, depth+1)
+	}
+}
@@ -0,0 +1,55 @@
+package hi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineDebugEndpoints(t *testing.T) {
+	router := New(&Context{})
+	router.GET("/users/:id", func(c *Context) {})
+	router.Debug("/debug", func(c *Context) {
+		if c.GetHeader("Authorization") != "secret" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+		}
+	})
+	auth := header{"Authorization", "secret"}
+
+	w := PerformRequest(router, http.MethodGet, "/debug/info")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = PerformRequest(router, http.MethodGet, "/debug/info", auth)
+	require.Equal(t, http.StatusOK, w.Code)
+	var info map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, Version, info["version"])
+	assert.Equal(t, Mode(), info["mode"])
+
+	w = PerformRequest(router, http.MethodGet, "/debug/runtime", auth)
+	require.Equal(t, http.StatusOK, w.Code)
+	var stats map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Greater(t, stats["goroutines"], 0.0)
+	assert.Contains(t, stats, "memory")
+
+	w = PerformRequest(router, http.MethodGet, "/debug/routes", auth)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"path": "/users/:id"`)
+
+	w = PerformRequest(router, http.MethodGet, "/debug/routes/tree", auth)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "GET\n")
+	assert.Contains(t, w.Body.String(), `":id" param /users/:id (1 handlers)`)
+
+	w = PerformRequest(router, http.MethodGet, "/debug/pprof/", auth)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "goroutine")
+
+	w = PerformRequest(router, http.MethodGet, "/debug/pprof/goroutine?debug=1", auth)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "goroutine profile")
+}
@@ -0,0 +1,236 @@
+package hi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/nbcx/hi/binding"
+)
+
+// DefaultDecompressMaxSize is the default limit of the decompressed request bodies.
+const DefaultDecompressMaxSize = 10 << 20
+
+// Decompression errors, recorded in the context errors of the rejected requests.
+var (
+	ErrUnsupportedContentEncoding = errors.New("unsupported content encoding")
+	ErrMalformedContentEncoding   = errors.New("malformed content encoding")
+)
+
+// Decoder decodes a content coding of the request bodies, see Decompress.
+type Decoder interface {
+	// Encoding returns the content coding token, as used in Content-Encoding.
+	Encoding() string
+	// NewReader returns a reader decoding r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+type decoder struct {
+	encoding  string
+	newReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+func (d decoder) Encoding() string { return d.encoding }
+
+func (d decoder) NewReader(r io.Reader) (io.ReadCloser, error) { return d.newReader(r) }
+
+// GzipDecoder returns the gzip Decoder.
+func GzipDecoder() Decoder {
+	return decoder{encoding: "gzip", newReader: func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	}}
+}
+
+// DeflateDecoder returns the deflate Decoder, of the zlib format as per RFC 9110.
+func DeflateDecoder() Decoder {
+	return decoder{encoding: "deflate", newReader: zlib.NewReader}
+}
+
+// DecompressConfig defines the config for Decompress middleware.
+type DecompressConfig struct {
+	// Decoders are the content codings accepted.
+	// Optional. Default value is gzip and deflate.
+	Decoders []Decoder
+
+	// MaxSize limits the size of the decompressed bodies, so that small compressed bodies can
+	// not exhaust the memory once decompressed. Reading beyond it fails with a
+	// *http.MaxBytesError.
+	// Optional. Default value is DefaultDecompressMaxSize.
+	MaxSize int64
+}
+
+// Decompress returns a middleware decoding the request bodies compressed with gzip or
+// deflate, as announced by their Content-Encoding. See DecompressWithConfig.
+func Decompress[T IContext]() HandlerFunc[T] {
+	return DecompressWithConfig[T](DecompressConfig{})
+}
+
+// DecompressWithConfig returns a Decompress middleware with config.
+//
+// The body is decoded as it is read, so that the bindings and ShouldBindBodyWith get the
+// decompressed data, and reading invalid compressed data fails with an error wrapping
+// ErrMalformedContentEncoding; a body already cached under BodyBytesKey is decompressed at
+// once, and rejected with 400 if invalid. The Content-Encoding and Content-Length headers of
+// the request are removed. Requests with an unsupported coding are rejected with 415 and the
+// Accept-Encoding of the supported ones.
+func DecompressWithConfig[T IContext](conf DecompressConfig) HandlerFunc[T] {
+	if len(conf.Decoders) == 0 {
+		conf.Decoders = []Decoder{GzipDecoder(), DeflateDecoder()}
+	}
+	if conf.MaxSize <= 0 {
+		conf.MaxSize = DefaultDecompressMaxSize
+	}
+	decoders := make(map[string]Decoder, len(conf.Decoders))
+	names := make([]string, 0, len(conf.Decoders))
+	for _, d := range conf.Decoders {
+		decoders[d.Encoding()] = d
+		names = append(names, d.Encoding())
+	}
+	accepted := strings.Join(names, ", ")
+
+	return func(c T) {
+		req := c.Req()
+		codings := contentCodings(req.Header.Values("Content-Encoding"))
+		if len(codings) == 0 || req.Body == nil || req.Body == http.NoBody {
+			c.Next()
+			return
+		}
+		chain := make([]Decoder, len(codings))
+		for i, coding := range codings {
+			if chain[i] = decoders[coding]; chain[i] == nil {
+				_ = c.Error(fmt.Errorf("%w: %s", ErrUnsupportedContentEncoding, coding))
+				c.GetExecer().Header("Accept-Encoding", accepted)
+				c.GetExecer().AbortWithStatus(http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+
+		req.Header.Del("Content-Encoding")
+		req.Header.Del("Content-Length")
+		req.ContentLength = -1
+		body := &decompressedBody{limit: conf.MaxSize, remaining: conf.MaxSize, closers: []io.Closer{req.Body}, chain: chain}
+		cached, isCached := c.GetKeys()[BodyBytesKey].([]byte)
+		if !isCached {
+			// the decoders are created on the first read, once the handlers that follow, such as
+			// a BodyLimit of the route, are set up: they read ahead of the decoded data
+			req.Body = body
+			c.Next()
+			return
+		}
+
+		err := body.open(bytes.NewReader(cached))
+		var data []byte
+		if err == nil {
+			data, err = io.ReadAll(body)
+		}
+		_ = body.Close()
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				_ = c.Error(err)
+				c.GetExecer().AbortWithStatus(http.StatusRequestEntityTooLarge)
+				return
+			}
+			if !errors.Is(err, ErrMalformedContentEncoding) {
+				err = fmt.Errorf("%w: %w", ErrMalformedContentEncoding, err)
+			}
+			_ = c.Error(err)
+			c.GetExecer().AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		c.Set(BodyBytesKey, data)
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		c.Next()
+	}
+}
+
+// contentCodings returns the lowercase content codings of the Content-Encoding header
+// values, without identity.
+func contentCodings(values []string) []string {
+	var codings []string
+	for _, value := range values {
+		for _, coding := range strings.Split(value, ",") {
+			if coding = strings.ToLower(strings.TrimSpace(coding)); coding != "" && coding != "identity" {
+				codings = append(codings, coding)
+			}
+		}
+	}
+	return codings
+}
+
+// decompressedBody reads the decoded body, up to limit bytes.
+type decompressedBody struct {
+	r         io.Reader
+	chain     []Decoder
+	err       error
+	limit     int64
+	remaining int64
+	closers   []io.Closer
+}
+
+// open sets up the decoders of the chain reading src, the codings being listed in the order
+// they were applied.
+func (b *decompressedBody) open(src io.Reader) error {
+	r := src
+	for i := len(b.chain) - 1; i >= 0; i-- {
+		rc, err := b.chain[i].NewReader(r)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrMalformedContentEncoding, b.chain[i].Encoding(), err)
+		}
+		b.closers = append(b.closers, rc)
+		r = rc
+	}
+	b.r = r
+	return nil
+}
+
+func (b *decompressedBody) Read(p []byte) (int, error) {
+	if b.r == nil {
+		if b.err == nil {
+			b.err = b.open(b.closers[0].(io.Reader))
+		}
+		if b.err != nil {
+			return 0, b.err
+		}
+	}
+	if b.remaining < 0 {
+		return 0, &http.MaxBytesError{Limit: b.limit}
+	}
+	// read one byte more than allowed to tell a body of exactly limit bytes from a larger one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.r.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), &http.MaxBytesError{Limit: b.limit}
+	}
+	return n, err
+}
+
+// BodyLimitExceeded implements the binding.LimitedBody interface, for the limit of the
+// decompressed body and the one of the compressed body set by BodyLimit.
+func (b *decompressedBody) BodyLimitExceeded() (int64, bool) {
+	if b.remaining < 0 {
+		return b.limit, true
+	}
+	if body, ok := b.closers[0].(binding.LimitedBody); ok {
+		return body.BodyLimitExceeded()
+	}
+	return 0, false
+}
+
+func (b *decompressedBody) Close() error {
+	var err error
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		if cerr := b.closers[i].Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+package hi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func deflateData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+type decompressTestBody struct {
+	Name string `json:"name"`
+}
+
+func performDecompress(router *Engine[*Context], body []byte, encoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", MIMEJSON)
+	req.Header.Set("Content-Encoding", encoding)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestDecompress(t *testing.T) {
+	var bindErr error
+	router := New(&Context{})
+	router.Use(DecompressWithConfig[*Context](DecompressConfig{MaxSize: 1024}))
+	router.POST("/", func(c *Context) {
+		var obj decompressTestBody
+		if bindErr = c.ShouldBindJSON(&obj); bindErr != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.String(http.StatusOK, obj.Name+" "+c.Request.Header.Get("Content-Encoding"))
+	})
+	body := []byte(`{"name":"gopher"}`)
+
+	w := performDecompress(router, gzipData(t, body), "gzip")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gopher ", w.Body.String())
+
+	w = performDecompress(router, deflateData(t, body), "Deflate")
+	assert.Equal(t, "gopher ", w.Body.String())
+
+	w = performDecompress(router, gzipData(t, deflateData(t, body)), "deflate, gzip")
+	assert.Equal(t, "gopher ", w.Body.String())
+
+	w = performDecompress(router, body, "identity")
+	assert.Equal(t, "gopher identity", w.Body.String())
+
+	w = performDecompress(router, body, "br")
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	assert.Equal(t, "gzip, deflate", w.Header().Get("Accept-Encoding"))
+
+	w = performDecompress(router, body, "gzip")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.ErrorIs(t, bindErr, ErrMalformedContentEncoding)
+
+	// a small body decompressing beyond the limit
+	bomb := gzipData(t, []byte(`{"name":"`+strings.Repeat("0", 4096)+`"}`))
+	w = performDecompress(router, bomb, "gzip")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var maxBytesErr *http.MaxBytesError
+	require.True(t, errors.As(bindErr, &maxBytesErr), "%v", bindErr)
+	assert.Equal(t, int64(1024), maxBytesErr.Limit)
+}
+
+func TestDecompressBodyWith(t *testing.T) {
+	router := New(&Context{})
+	router.Use(func(c *Context) {
+		// caches the raw body, as VerifyWebhook does
+		_, _ = cachedBody(c, 1<<20)
+	}, DecompressWithConfig[*Context](DecompressConfig{MaxSize: 1024}))
+	router.POST("/", func(c *Context) {
+		var first, second decompressTestBody
+		if c.ShouldBindBodyWithJSON(&first) != nil || c.ShouldBindBodyWithJSON(&second) != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		raw, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, first.Name+" "+second.Name+" "+string(raw))
+	})
+	body := []byte(`{"name":"gopher"}`)
+
+	w := performDecompress(router, gzipData(t, body), "gzip")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `gopher gopher {"name":"gopher"}`, w.Body.String())
+
+	w = performDecompress(router, gzipData(t, bytes.Repeat([]byte(" "), 2048)), "gzip")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestDecompressedBodyLimit(t *testing.T) {
+	for _, size := range []int{0, 1, 1023, 1024} {
+		body := &decompressedBody{r: bytes.NewReader(make([]byte, size)), limit: 1024, remaining: 1024}
+		data, err := io.ReadAll(body)
+		require.NoError(t, err, size)
+		assert.Len(t, data, size)
+	}
+	body := &decompressedBody{r: bytes.NewReader(make([]byte, 1025)), limit: 1024, remaining: 1024}
+	data, err := io.ReadAll(body)
+	assert.Len(t, data, 1024)
+	var maxBytesErr *http.MaxBytesError
+	assert.ErrorAs(t, err, &maxBytesErr)
+}
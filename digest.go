@@ -0,0 +1,381 @@
+package hi
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DigestAlgorithm is a hash algorithm of Digest authentication.
+type DigestAlgorithm string
+
+// Digest authentication algorithms.
+const (
+	DigestSHA256 DigestAlgorithm = "SHA-256"
+	DigestMD5    DigestAlgorithm = "MD5"
+)
+
+// Digest quality of protection values.
+const (
+	DigestQOPAuth    = "auth"
+	DigestQOPAuthInt = "auth-int"
+)
+
+// DefaultNonceExpiry is the default lifetime of the nonces of a MemoryNonceStore.
+const DefaultNonceExpiry = 5 * time.Minute
+
+// DefaultDigestMaxBodySize is the default maximum size of the bodies read for qop auth-int.
+const DefaultDigestMaxBodySize = 1 << 20
+
+func (alg DigestAlgorithm) hash(s string) string {
+	var h hash.Hash
+	if alg == DigestMD5 {
+		h = md5.New()
+	} else {
+		h = sha256.New()
+	}
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// DigestHA1 returns the hex H(user:realm:password) of algorithm, the secret stored to check
+// Digest credentials without keeping the password.
+func DigestHA1(alg DigestAlgorithm, user, realm, password string) string {
+	return alg.hash(user + ":" + realm + ":" + password)
+}
+
+// DigestCredentials resolves the secrets checking Digest credentials. As the password never
+// reaches the server, the credentials cannot be checked by a Verifier: they are checked
+// against the HA1 of the user instead.
+type DigestCredentials interface {
+	// HA1 returns the DigestHA1 of user in realm with alg, and the identity set to AuthUserKey.
+	HA1(user, realm string, alg DigestAlgorithm) (ha1 string, identity any, ok bool)
+}
+
+// DigestCredentialsFunc is a function implementing DigestCredentials.
+type DigestCredentialsFunc func(user, realm string, alg DigestAlgorithm) (ha1 string, identity any, ok bool)
+
+// HA1 implements the DigestCredentials interface.
+func (f DigestCredentialsFunc) HA1(user, realm string, alg DigestAlgorithm) (string, any, bool) {
+	return f(user, realm, alg)
+}
+
+// HA1 implements the DigestCredentials interface. The identity is the user name.
+func (a Accounts) HA1(user, realm string, alg DigestAlgorithm) (string, any, bool) {
+	password, ok := a[user]
+	if !ok {
+		return "", nil, false
+	}
+	return DigestHA1(alg, user, realm, password), user, true
+}
+
+// NonceStore issues the server nonces of Digest authentication and tracks their use.
+// Implementations must be safe for concurrent use.
+type NonceStore interface {
+	// Issue returns a new nonce.
+	Issue() (string, error)
+	// Use records the use of nonce with the nonce count nc. It reports stale for expired
+	// nonces, and ok false for unknown nonces and replays, when nc is not greater than the
+	// counts seen so far.
+	Use(nonce string, nc uint64) (ok, stale bool)
+}
+
+// MemoryNonceStore is a NonceStore issuing stateless nonces, a random value and its issue
+// time authenticated with an HMAC. Only the nonce counts of the nonces used with valid
+// credentials are kept in memory, so that unauthenticated requests cost no memory; they are
+// evicted lazily once expired.
+type MemoryNonceStore struct {
+	expiry time.Duration
+	now    func() time.Time
+	key    []byte
+
+	mu        sync.Mutex
+	used      map[string]*nonceEntry
+	lastSweep time.Time
+}
+
+type nonceEntry struct {
+	expires time.Time
+	nc      uint64
+}
+
+var _ NonceStore = (*MemoryNonceStore)(nil)
+
+const (
+	nonceDataSize = 8 + 12
+	nonceMACSize  = 16
+)
+
+// NewMemoryNonceStore returns a MemoryNonceStore issuing nonces valid for expiry, or for
+// DefaultNonceExpiry if expiry is not positive.
+func NewMemoryNonceStore(expiry time.Duration) *MemoryNonceStore {
+	if expiry <= 0 {
+		expiry = DefaultNonceExpiry
+	}
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	assert1(err == nil, "nonce key generation failed")
+	return &MemoryNonceStore{expiry: expiry, now: time.Now, key: key, used: make(map[string]*nonceEntry)}
+}
+
+func (s *MemoryNonceStore) mac(data []byte) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write(data)
+	return h.Sum(nil)[:nonceMACSize]
+}
+
+// Issue implements the NonceStore interface.
+func (s *MemoryNonceStore) Issue() (string, error) {
+	b := make([]byte, nonceDataSize, nonceDataSize+nonceMACSize)
+	binary.BigEndian.PutUint64(b, uint64(s.now().UnixNano()))
+	if _, err := rand.Read(b[8:]); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(append(b, s.mac(b)...)), nil
+}
+
+// Use implements the NonceStore interface.
+func (s *MemoryNonceStore) Use(nonce string, nc uint64) (ok, stale bool) {
+	b, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(b) != nonceDataSize+nonceMACSize ||
+		!hmac.Equal(b[nonceDataSize:], s.mac(b[:nonceDataSize])) {
+		return false, false
+	}
+	now := s.now()
+	expires := time.Unix(0, int64(binary.BigEndian.Uint64(b))).Add(s.expiry)
+	if !now.Before(expires) {
+		return false, true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) >= s.expiry {
+		s.lastSweep = now
+		for n, e := range s.used {
+			if !now.Before(e.expires) {
+				delete(s.used, n)
+			}
+		}
+	}
+	e, found := s.used[nonce]
+	if !found {
+		s.used[nonce] = &nonceEntry{expires: expires, nc: nc}
+		return true, false
+	}
+	if nc <= e.nc {
+		return false, false
+	}
+	e.nc = nc
+	return true, false
+}
+
+// DigestAuthConfig defines the config for DigestAuth middleware.
+type DigestAuthConfig struct {
+	// Credentials resolves the secrets of the users, see Accounts and DigestCredentialsFunc.
+	Credentials DigestCredentials
+
+	// Realm is the protection space.
+	// Optional. Default value is "Authorization Required".
+	Realm string
+
+	// Algorithms are offered in order of preference, one challenge each.
+	// Optional. Default value is SHA-256 then MD5.
+	Algorithms []DigestAlgorithm
+
+	// QOP are the qualities of protection offered.
+	// Optional. Default value is auth and auth-int.
+	QOP []string
+
+	// Nonces issues and tracks the nonces.
+	// Optional. Default value is a new MemoryNonceStore.
+	Nonces NonceStore
+
+	// MaxBodySize is the maximum size of the bodies read to check qop auth-int, as they are
+	// read before the user is authenticated. Larger requests are rejected with 413.
+	// Optional. Default value is DefaultDigestMaxBodySize.
+	MaxBodySize int64
+}
+
+// DigestAuth returns a Digest HTTP Authorization middleware (RFC 7616), offering SHA-256 and
+// MD5 with qop auth and auth-int. The identity of the user is set to the key AuthUserKey.
+// If the realm is empty, "Authorization Required" will be used by default.
+func DigestAuth[T IContext](credentials DigestCredentials, realm string) HandlerFunc[T] {
+	return DigestAuthWithConfig[T](DigestAuthConfig{Credentials: credentials, Realm: realm})
+}
+
+// DigestAuthWithConfig returns a DigestAuth middleware with config.
+func DigestAuthWithConfig[T IContext](conf DigestAuthConfig) HandlerFunc[T] {
+	assert1(conf.Credentials != nil, "digest credentials can not be nil")
+	if conf.Realm == "" {
+		conf.Realm = "Authorization Required"
+	}
+	if len(conf.Algorithms) == 0 {
+		conf.Algorithms = []DigestAlgorithm{DigestSHA256, DigestMD5}
+	}
+	for _, alg := range conf.Algorithms {
+		assert1(alg == DigestSHA256 || alg == DigestMD5, "unsupported digest algorithm "+string(alg))
+	}
+	if len(conf.QOP) == 0 {
+		conf.QOP = []string{DigestQOPAuth, DigestQOPAuthInt}
+	}
+	for _, qop := range conf.QOP {
+		assert1(qop == DigestQOPAuth || qop == DigestQOPAuthInt, "unsupported digest qop "+qop)
+	}
+	if conf.Nonces == nil {
+		conf.Nonces = NewMemoryNonceStore(DefaultNonceExpiry)
+	}
+	if conf.MaxBodySize <= 0 {
+		conf.MaxBodySize = DefaultDigestMaxBodySize
+	}
+	opaque := make([]byte, 12)
+	_, err := rand.Read(opaque)
+	assert1(err == nil, "digest opaque generation failed")
+	d := &digestAuth{conf: conf, opaque: base64.RawURLEncoding.EncodeToString(opaque)}
+
+	return func(c T) {
+		identity, ok, stale, err := d.authenticate(c)
+		if err != nil {
+			_ = c.Error(err)
+			c.GetExecer().AbortWithStatus(http.StatusRequestEntityTooLarge)
+			return
+		}
+		if !ok {
+			d.challenge(c, stale)
+			return
+		}
+		c.Set(AuthUserKey, identity)
+	}
+}
+
+type digestAuth struct {
+	conf   DigestAuthConfig
+	opaque string
+}
+
+func (d *digestAuth) challenge(c IContext, stale bool) {
+	nonce, err := d.conf.Nonces.Issue()
+	if err != nil {
+		_ = c.Error(err)
+		c.GetExecer().AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	header := c.Rsp().Header()
+	for _, alg := range d.conf.Algorithms {
+		challenge := "Digest realm=" + strconv.Quote(d.conf.Realm) +
+			`, qop="` + strings.Join(d.conf.QOP, ", ") + `", algorithm=` + string(alg) +
+			`, nonce="` + nonce + `", opaque="` + d.opaque + `"`
+		if stale {
+			challenge += ", stale=true"
+		}
+		header.Add("WWW-Authenticate", challenge)
+	}
+	c.GetExecer().AbortWithStatus(http.StatusUnauthorized)
+}
+
+// authenticate checks the Digest credentials of the request. stale reports valid credentials
+// with an expired nonce, err a body larger than MaxBodySize.
+func (d *digestAuth) authenticate(c IContext) (identity any, ok, stale bool, err error) {
+	req := c.Req()
+	scheme, rest, _ := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Digest") {
+		return nil, false, false, nil
+	}
+	params := parseAuthParams(rest)
+
+	alg := DigestAlgorithm(params["algorithm"])
+	if alg == "" {
+		alg = DigestMD5
+	}
+	qop, nc, cnonce, nonce := params["qop"], params["nc"], params["cnonce"], params["nonce"]
+	count, err := strconv.ParseUint(nc, 16, 64)
+	if !slices.Contains(d.conf.Algorithms, alg) || !slices.Contains(d.conf.QOP, qop) ||
+		err != nil || len(nc) != 8 || cnonce == "" || nonce == "" ||
+		params["realm"] != d.conf.Realm || params["opaque"] != d.opaque {
+		return nil, false, false, nil
+	}
+	requestURI := req.RequestURI
+	if requestURI == "" {
+		requestURI = req.URL.RequestURI()
+	}
+	if params["uri"] != requestURI {
+		return nil, false, false, nil
+	}
+
+	a2 := req.Method + ":" + params["uri"]
+	if qop == DigestQOPAuthInt {
+		body, err := cachedBody(c, d.conf.MaxBodySize)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return nil, false, false, err
+			}
+			_ = c.Error(err)
+			return nil, false, false, nil
+		}
+		a2 += ":" + alg.hash(string(body))
+	}
+
+	ha1, identity, found := d.conf.Credentials.HA1(params["username"], d.conf.Realm, alg)
+	if !found {
+		// compute the response anyway, so that unknown users are not told apart by timing
+		ha1 = DigestHA1(alg, params["username"], d.conf.Realm, "")
+	}
+	expected := alg.hash(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + alg.hash(a2))
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(params["response"])) != 1 || !found {
+		return nil, false, false, nil
+	}
+
+	ok, stale = d.conf.Nonces.Use(nonce, count)
+	return identity, ok, stale, nil
+}
+
+// parseAuthParams parses the comma separated auth-param list of an Authorization header,
+// with token or quoted-string values.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return params
+		}
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return params
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimLeft(rest, " \t")
+
+		var value strings.Builder
+		if strings.HasPrefix(rest, `"`) {
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				value.WriteByte(rest[i])
+			}
+			s = rest[min(i+1, len(rest)):]
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			value.WriteString(strings.TrimSpace(rest[:end]))
+			s = rest[end:]
+		}
+		params[key] = value.String()
+	}
+}
@@ -0,0 +1,212 @@
+package hi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type digestClient struct {
+	user, password string
+	alg            DigestAlgorithm
+	qop            string
+	nc             int
+}
+
+// authorize answers the challenge of w for a request of method on uri.
+func (dc *digestClient) authorize(t *testing.T, w *httptest.ResponseRecorder, method, uri, body string) string {
+	var params map[string]string
+	for _, challenge := range w.Header().Values("WWW-Authenticate") {
+		p := parseAuthParams(strings.TrimPrefix(challenge, "Digest "))
+		if DigestAlgorithm(p["algorithm"]) == dc.alg {
+			params = p
+		}
+	}
+	require.NotNil(t, params, "no %s challenge", dc.alg)
+
+	dc.nc++
+	nc := fmt.Sprintf("%08x", dc.nc)
+	ha1 := DigestHA1(dc.alg, dc.user, params["realm"], dc.password)
+	a2 := method + ":" + uri
+	if dc.qop == DigestQOPAuthInt {
+		a2 += ":" + dc.alg.hash(body)
+	}
+	response := dc.alg.hash(ha1 + ":" + params["nonce"] + ":" + nc + ":cnonce:" + dc.qop + ":" + dc.alg.hash(a2))
+	return fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=%s, qop=%s, nc=%s, cnonce="cnonce", response="%s", opaque="%s"`,
+		dc.user, params["realm"], params["nonce"], uri, dc.alg, dc.qop, nc, response, params["opaque"])
+}
+
+func digestRouter(conf DigestAuthConfig) *Engine[*Context] {
+	router := New(&Context{})
+	router.Use(DigestAuthWithConfig[*Context](conf))
+	handler := func(c *Context) {
+		var body struct{ Name string }
+		if c.Request.Method == http.MethodPost {
+			if err := c.ShouldBindBodyWithJSON(&body); err != nil {
+				c.String(http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		c.String(http.StatusOK, c.GetKeys()[AuthUserKey].(string)+body.Name)
+	}
+	router.GET("/secret", handler)
+	router.POST("/secret", handler)
+	return router
+}
+
+func TestDigestAuth(t *testing.T) {
+	router := digestRouter(DigestAuthConfig{Credentials: Accounts{"admin": "password"}, Realm: "api"})
+
+	w := PerformRequest(router, http.MethodGet, "/secret?x=1")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	challenges := w.Header().Values("WWW-Authenticate")
+	require.Len(t, challenges, 2)
+	assert.True(t, strings.HasPrefix(challenges[0], `Digest realm="api", qop="auth, auth-int", algorithm=SHA-256, nonce="`))
+	assert.Contains(t, challenges[1], "algorithm=MD5")
+
+	for _, alg := range []DigestAlgorithm{DigestSHA256, DigestMD5} {
+		client := &digestClient{user: "admin", password: "password", alg: alg, qop: DigestQOPAuth}
+		w := PerformRequest(router, http.MethodGet, "/secret?x=1")
+		authorization := client.authorize(t, w, http.MethodGet, "/secret?x=1", "")
+
+		w = PerformRequest(router, http.MethodGet, "/secret?x=1", header{"Authorization", authorization})
+		assert.Equal(t, http.StatusOK, w.Code, alg)
+		assert.Equal(t, "admin", w.Body.String())
+
+		// the same nonce count is a replay
+		w = PerformRequest(router, http.MethodGet, "/secret?x=1", header{"Authorization", authorization})
+		assert.Equal(t, http.StatusUnauthorized, w.Code, alg)
+	}
+
+	client := &digestClient{user: "admin", password: "wrong", alg: DigestSHA256, qop: DigestQOPAuth}
+	w = PerformRequest(router, http.MethodGet, "/secret")
+	w = PerformRequest(router, http.MethodGet, "/secret", header{"Authorization", client.authorize(t, w, http.MethodGet, "/secret", "")})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	client = &digestClient{user: "nobody", password: "password", alg: DigestSHA256, qop: DigestQOPAuth}
+	w = PerformRequest(router, http.MethodGet, "/secret")
+	w = PerformRequest(router, http.MethodGet, "/secret", header{"Authorization", client.authorize(t, w, http.MethodGet, "/secret", "")})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// the uri must be the one requested
+	client = &digestClient{user: "admin", password: "password", alg: DigestSHA256, qop: DigestQOPAuth}
+	w = PerformRequest(router, http.MethodGet, "/secret")
+	w = PerformRequest(router, http.MethodGet, "/secret", header{"Authorization", client.authorize(t, w, http.MethodGet, "/other", "")})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestDigestAuthInt(t *testing.T) {
+	router := digestRouter(DigestAuthConfig{Credentials: Accounts{"admin": "password"}})
+	client := &digestClient{user: "admin", password: "password", alg: DigestSHA256, qop: DigestQOPAuthInt}
+	body := `{"Name":"!"}`
+
+	post := func(authorization, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/secret", strings.NewReader(body))
+		req.Header.Set("Content-Type", MIMEJSON)
+		req.Header.Set("Authorization", authorization)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("", body)
+	w = post(client.authorize(t, w, http.MethodPost, "/secret", body), body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "admin!", w.Body.String())
+
+	// a tampered body does not match the digest
+	w = post("", body)
+	w = post(client.authorize(t, w, http.MethodPost, "/secret", body), `{"Name":"?"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// the body is read before the user is authenticated, up to MaxBodySize
+	router = digestRouter(DigestAuthConfig{Credentials: Accounts{"admin": "password"}, MaxBodySize: 8})
+	w = post("", body)
+	w = post(client.authorize(t, w, http.MethodPost, "/secret", body), body)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestDigestAuthStaleNonce(t *testing.T) {
+	nonces := NewMemoryNonceStore(time.Minute)
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	nonces.now = clock.now
+	router := digestRouter(DigestAuthConfig{
+		Credentials: DigestCredentialsFunc(func(user, realm string, alg DigestAlgorithm) (string, any, bool) {
+			return DigestHA1(alg, user, realm, "password"), user, user == "admin"
+		}),
+		Algorithms: []DigestAlgorithm{DigestMD5},
+		QOP:        []string{DigestQOPAuth},
+		Nonces:     nonces,
+	})
+	client := &digestClient{user: "admin", password: "password", alg: DigestMD5, qop: DigestQOPAuth}
+
+	w := PerformRequest(router, http.MethodGet, "/secret")
+	authorization := client.authorize(t, w, http.MethodGet, "/secret", "")
+	clock.advance(2 * time.Minute)
+	w = PerformRequest(router, http.MethodGet, "/secret", header{"Authorization", authorization})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.True(t, strings.HasSuffix(w.Header().Get("WWW-Authenticate"), ", stale=true"))
+
+	// qop auth-int is not offered
+	client.qop = DigestQOPAuthInt
+	w = PerformRequest(router, http.MethodGet, "/secret", header{"Authorization", client.authorize(t, w, http.MethodGet, "/secret", "")})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotContains(t, w.Header().Get("WWW-Authenticate"), "stale")
+}
+
+func TestMemoryNonceStore(t *testing.T) {
+	nonces := NewMemoryNonceStore(time.Minute)
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	nonces.now = clock.now
+
+	// issuing keeps no state, only the used nonces are tracked
+	for range 100 {
+		_, err := nonces.Issue()
+		require.NoError(t, err)
+	}
+	assert.Empty(t, nonces.used)
+
+	nonce, err := nonces.Issue()
+	require.NoError(t, err)
+	ok, stale := nonces.Use(nonce, 1)
+	assert.True(t, ok)
+	assert.False(t, stale)
+	ok, _ = nonces.Use(nonce, 1)
+	assert.False(t, ok)
+	ok, _ = nonces.Use(nonce, 2)
+	assert.True(t, ok)
+	assert.Len(t, nonces.used, 1)
+
+	// forged nonces and nonces of another store are unknown
+	other, _ := NewMemoryNonceStore(time.Minute).Issue()
+	tampered := []byte(nonce)
+	tampered[0] ^= 1
+	for _, forged := range []string{"", "nonce", other, string(tampered)} {
+		ok, stale = nonces.Use(forged, 1)
+		assert.False(t, ok, forged)
+		assert.False(t, stale, forged)
+	}
+
+	clock.advance(time.Minute)
+	ok, stale = nonces.Use(nonce, 3)
+	assert.False(t, ok)
+	assert.True(t, stale)
+	fresh, _ := nonces.Issue()
+	nonces.Use(fresh, 1)
+	assert.Len(t, nonces.used, 1)
+}
+
+func TestParseAuthParams(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"username": `a "b"`,
+		"realm":    "r, s",
+		"nc":       "00000001",
+		"qop":      "auth",
+	}, parseAuthParams(`username="a \"b\"", Realm="r, s",nc=00000001 , qop=auth`))
+}
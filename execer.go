@@ -1,5 +1,7 @@
 package hi
 
+import "context"
+
 // todo: wait check
 type Execer interface {
 	Next()
@@ -17,8 +19,19 @@ type Execer interface {
 	Abort()
 	Header(key, value string)
 	AbortWithStatus(code int)
+	Context() context.Context
+	SetContext(ctx context.Context)
+	SetHandlerObserver(fn HandlerObserver)
+	Keyring() *Keyring
+	SetKeyring(keyring *Keyring)
+	TrustedProxy() bool
+	SetTrustedProxy(trusted bool)
 }
 
+// HandlerObserver is called before each handler of the chain runs, with its index and name.
+// The returned function, if not nil, is called once the handler returns.
+type HandlerObserver func(index int, name string) func()
+
 func NewExecer[T IContext](ctx T, handlers HandlersChain[T]) Execer {
 	return &Exec[T]{ctx: ctx, handlers: handlers, index: -1}
 }
@@ -30,6 +43,17 @@ type Exec[T IContext] struct {
 	params    Params
 	fullPath  string
 	writerMem responseWriter
+	stdCtx    context.Context
+	observer  HandlerObserver
+
+	// continueOnCancel keeps the chain advancing once stdCtx is done.
+	continueOnCancel bool
+
+	// keyring is the Engine.Keyring of the cookies.
+	keyring *Keyring
+
+	// trustedProxy reports that the request comes from one of Engine.SetTrustedProxies.
+	trustedProxy bool
 }
 
 func (c *Exec[T]) Copy() Execer {
@@ -64,6 +88,43 @@ func (c *Exec[T]) SetWriterMem(rw responseWriter) {
 	c.writerMem = rw
 }
 
+// Keyring returns the keyring of the signed and encrypted cookies, nil if none is configured.
+func (c *Exec[T]) Keyring() *Keyring {
+	return c.keyring
+}
+
+// SetKeyring sets the keyring of the signed and encrypted cookies.
+func (c *Exec[T]) SetKeyring(keyring *Keyring) {
+	c.keyring = keyring
+}
+
+// TrustedProxy reports whether the request comes from a trusted proxy, whose forwarding
+// headers can be relied on, see Engine.SetTrustedProxies.
+func (c *Exec[T]) TrustedProxy() bool {
+	return c.trustedProxy
+}
+
+// SetTrustedProxy sets whether the request comes from a trusted proxy.
+func (c *Exec[T]) SetTrustedProxy(trusted bool) {
+	c.trustedProxy = trusted
+}
+
+// Context returns the context.Context installed for the current request, or nil
+// if none was installed (e.g. by the Timeout middleware).
+func (c *Exec[T]) Context() context.Context {
+	return c.stdCtx
+}
+
+// SetContext installs ctx as the context.Context of the current request.
+func (c *Exec[T]) SetContext(ctx context.Context) {
+	c.stdCtx = ctx
+}
+
+// SetHandlerObserver installs fn to observe the handlers run after it; nil removes it.
+func (c *Exec[T]) SetHandlerObserver(fn HandlerObserver) {
+	c.observer = fn
+}
+
 func (c *Exec[T]) SetFullPath(fullPath string) {
 	c.fullPath = fullPath
 }
@@ -83,14 +144,45 @@ func (c *Exec[T]) SetIndex(index int8) {
 func (c *Exec[T]) Next() {
 	c.index++
 	for c.index < int8(len(c.handlers)) {
+		// The first handler always runs, so outer middleware such as Logger
+		// still observe requests that were canceled before the chain started.
+		if c.index > 0 && c.canceled() {
+			return
+		}
 		if c.handlers[c.index] == nil {
 			continue
 		}
-		c.handlers[c.index](c.ctx)
+		if c.observer != nil {
+			c.observe(c.handlers[c.index])
+		} else {
+			c.handlers[c.index](c.ctx)
+		}
 		c.index++
 	}
 }
 
+func (c *Exec[T]) observe(handler HandlerFunc[T]) {
+	if done := c.observer(int(c.index), nameOfFunction(handler)); done != nil {
+		defer done()
+	}
+	handler(c.ctx)
+}
+
+// canceled reports whether the request context is done, in which case the
+// cancellation is recorded in the context errors and the chain is aborted.
+func (c *Exec[T]) canceled() bool {
+	if c.continueOnCancel || c.stdCtx == nil {
+		return false
+	}
+	err := c.stdCtx.Err()
+	if err == nil {
+		return false
+	}
+	c.ctx.Error(err) //nolint: errcheck
+	c.Abort()
+	return true
+}
+
 func (c *Exec[T]) Param(key string) string {
 	return c.params.ByName(key)
 }
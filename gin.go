@@ -5,6 +5,7 @@
 package hi
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
@@ -14,6 +15,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/nbcx/hi/internal/bytesconv"
 	"github.com/nbcx/hi/render"
@@ -166,6 +168,24 @@ type Engine[T IContext] struct {
 	// UseH2C enable h2c support.
 	UseH2C bool
 
+	// ContinueOnCancel if enabled, the handlers chain keeps advancing after the request context
+	// is done, e.g. because the client disconnected. By default the remaining handlers are
+	// skipped and the cancellation is recorded in the context errors.
+	ContinueOnCancel bool
+
+	// ShutdownDrainDelay is how long Shutdown keeps serving once readiness started failing, so
+	// that load balancers stop routing new requests before the listeners close.
+	ShutdownDrainDelay time.Duration
+
+	// TLSConfig configures the TLS listeners of RunTLS, e.g. with the client CAs and the
+	// verification mode of mutual TLS, see MutualTLSConfig. The certificate files given to
+	// RunTLS are loaded on top of it.
+	TLSConfig *tls.Config
+
+	// Keyring signs and encrypts the cookies of Context.SetSignedCookie and
+	// Context.SetEncryptedCookie, and the session cookies when no keys are configured.
+	Keyring *Keyring
+
 	// todo: del
 	// ContextWithFallback enable fallback Context.Deadline(), Context.Done(), Context.Err() and Context.Value() when Context.Request.Context() is not nil.
 	// ContextWithFallback bool
@@ -182,8 +202,13 @@ type Engine[T IContext] struct {
 	trees       methodTrees[T]
 	maxParams   uint16
 	maxSections uint16
-	// trustedProxies []string
-	// trustedCIDRs     []*net.IPNet
+	health      *Health
+	serversMu   sync.Mutex
+	servers     []*http.Server
+	shutdown    bool
+
+	// trustedCIDRs are the networks of SetTrustedProxies.
+	trustedCIDRs []*net.IPNet
 }
 
 var _ IRouter[IContext] = (*Engine[IContext])(nil)
@@ -228,7 +253,7 @@ func New[T IContext](t T, opts ...OptionFunc[T]) *Engine[T] {
 		UnescapePathValues:     true,
 		trees:                  make(methodTrees[T], 0, 9),
 		delims:                 render.Delims{Left: "{{", Right: "}}"},
-		// trustedProxies:         []string{"0.0.0.0/0", "::/0"},
+		health:                 NewHealth(),
 	}
 	engine.RouterGroup.engine = engine
 	engine.pool.New = func() any {
@@ -402,72 +427,56 @@ func iterate[T IContext](path, method string, routes RoutesInfo[T], root *node[T
 	return routes
 }
 
-// func (engine *Engine[T]) prepareTrustedCIDRs() ([]*net.IPNet, error) {
-// 	if engine.trustedProxies == nil {
-// 		return nil, nil
-// 	}
-
-// 	cidr := make([]*net.IPNet, 0, len(engine.trustedProxies))
-// 	for _, trustedProxy := range engine.trustedProxies {
-// 		if !strings.Contains(trustedProxy, "/") {
-// 			ip := parseIP(trustedProxy)
-// 			if ip == nil {
-// 				return cidr, &net.ParseError{Type: "IP address", Text: trustedProxy}
-// 			}
-
-// 			switch len(ip) {
-// 			case net.IPv4len:
-// 				trustedProxy += "/32"
-// 			case net.IPv6len:
-// 				trustedProxy += "/128"
-// 			}
-// 		}
-// 		_, cidrNet, err := net.ParseCIDR(trustedProxy)
-// 		if err != nil {
-// 			return cidr, err
-// 		}
-// 		cidr = append(cidr, cidrNet)
-// 	}
-// 	return cidr, nil
-// }
-
-// // SetTrustedProxies set a list of network origins (IPv4 addresses,
-// // IPv4 CIDRs, IPv6 addresses or IPv6 CIDRs) from which to trust
-// // request's headers that contain alternative client IP when
-// // `(*gin.Engine).ForwardedByClientIP` is `true`. `TrustedProxies`
-// // feature is enabled by default, and it also trusts all proxies
-// // by default. If you want to disable this feature, use
-// // Engine.SetTrustedProxies(nil), then Context.ClientIP() will
-// // return the remote address directly.
-// func (engine *Engine[T]) SetTrustedProxies(trustedProxies []string) error {
-// 	engine.trustedProxies = trustedProxies
-// 	return engine.parseTrustedProxies()
-// }
-
-// // isUnsafeTrustedProxies checks if Engine.trustedCIDRs contains all IPs, it's not safe if it has (returns true)
-// func (engine *Engine[T]) isUnsafeTrustedProxies() bool {
-// 	return engine.isTrustedProxy(net.ParseIP("0.0.0.0")) || engine.isTrustedProxy(net.ParseIP("::"))
-// }
-
-// // parseTrustedProxies parse Engine.trustedProxies to Engine.trustedCIDRs
-// func (engine *Engine[T]) parseTrustedProxies() error {
-// 	trustedCIDRs, err := engine.prepareTrustedCIDRs()
-// 	engine.trustedCIDRs = trustedCIDRs
-// 	return err
-// }
+// SetTrustedProxies sets the network origins (IPv4 addresses, IPv4 CIDRs, IPv6 addresses or
+// IPv6 CIDRs) of the reverse proxies whose forwarding headers, such as X-Forwarded-Proto, are
+// trusted. No proxy is trusted by default, nor after SetTrustedProxies(nil).
+func (engine *Engine[T]) SetTrustedProxies(trustedProxies []string) error {
+	if trustedProxies == nil {
+		engine.trustedCIDRs = nil
+		return nil
+	}
+	cidrs := make([]*net.IPNet, 0, len(trustedProxies))
+	for _, trustedProxy := range trustedProxies {
+		if !strings.Contains(trustedProxy, "/") {
+			ip := parseIP(trustedProxy)
+			if ip == nil {
+				return &net.ParseError{Type: "IP address", Text: trustedProxy}
+			}
+			switch len(ip) {
+			case net.IPv4len:
+				trustedProxy += "/32"
+			case net.IPv6len:
+				trustedProxy += "/128"
+			}
+		}
+		_, cidr, err := net.ParseCIDR(trustedProxy)
+		if err != nil {
+			return err
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	engine.trustedCIDRs = cidrs
+	return nil
+}
 
-// isTrustedProxy will check whether the IP address is included in the trusted list according to Engine.trustedCIDRs
-// func (engine *Engine[T]) isTrustedProxy(ip net.IP) bool {
-// 	if engine.trustedCIDRs == nil {
-// 		return false
-// 	}
-// 	for _, cidr := range engine.trustedCIDRs {
-// 		if cidr.Contains(ip) {
-// 			return true
-// 		}
-// 	}
-// 	return false
-// }
+// isTrustedProxy reports whether remoteAddr, the http.Request.RemoteAddr, is one of the
+// trusted proxies.
+func (engine *Engine[T]) isTrustedProxy(remoteAddr string) bool {
+	if len(engine.trustedCIDRs) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(strings.TrimSpace(remoteAddr))
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	for _, cidr := range engine.trustedCIDRs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
 
 // validateHeader will parse X-Forwarded-For header and return the trusted client IP address
 // func (engine *Engine[T]) validateHeader(header string) (clientIP string, valid bool) {
@@ -513,21 +522,22 @@ func (engine *Engine[T]) updateRouteTrees() {
 
 // parseIP parse a string representation of an IP and returns a net.IP with the
 // minimum byte representation or nil if input is invalid.
-// func parseIP(ip string) net.IP {
-// 	parsedIP := net.ParseIP(ip)
+func parseIP(ip string) net.IP {
+	parsedIP := net.ParseIP(ip)
 
-// 	if ipv4 := parsedIP.To4(); ipv4 != nil {
-// 		// return ip in a 4-byte representation
-// 		return ipv4
-// 	}
+	if ipv4 := parsedIP.To4(); ipv4 != nil {
+		// return ip in a 4-byte representation
+		return ipv4
+	}
 
-// 	// return ip in a 16-byte representation or nil
-// 	return parsedIP
-// }
+	// return ip in a 16-byte representation or nil
+	return parsedIP
+}
 
 // Run attaches the router to a http.Server and starts listening and serving HTTP requests.
 // It is a shortcut for http.ListenAndServe(addr, router)
-// Note: this method will block the calling goroutine indefinitely unless an error happens.
+// Note: this method will block the calling goroutine indefinitely unless an error happens,
+// or Shutdown is called, in which case it returns http.ErrServerClosed.
 func (engine *Engine[T]) Run(addr ...string) (err error) {
 	defer func() { debugPrintError(err) }()
 
@@ -539,7 +549,7 @@ func (engine *Engine[T]) Run(addr ...string) (err error) {
 	engine.updateRouteTrees()
 	address := resolveAddress(addr)
 	debugPrint("Listening and serving HTTP on %s\n", address)
-	err = http.ListenAndServe(address, engine.Handler())
+	err = engine.newServer(address).ListenAndServe()
 	return
 }
 
@@ -556,7 +566,7 @@ func (engine *Engine[T]) RunTLS(addr, certFile, keyFile string) (err error) {
 	// 		"Please check https://github.com/nbcx/hi/blob/master/docs/doc.md#dont-trust-all-proxies for details.")
 	// }
 
-	err = http.ListenAndServeTLS(addr, certFile, keyFile, engine.Handler())
+	err = engine.newServer(addr).ListenAndServeTLS(certFile, keyFile)
 	return
 }
 
@@ -580,7 +590,7 @@ func (engine *Engine[T]) RunUnix(file string) (err error) {
 	defer listener.Close()
 	defer os.Remove(file)
 
-	err = http.Serve(listener, engine.Handler())
+	err = engine.newServer("").Serve(listener)
 	return
 }
 
@@ -636,7 +646,7 @@ func (engine *Engine[T]) RunListener(listener net.Listener) (err error) {
 	// 		"Please check https://github.com/nbcx/hi/blob/master/docs/doc.md#dont-trust-all-proxies for details.")
 	// }
 
-	err = http.Serve(listener, engine.Handler())
+	err = engine.newServer("").Serve(listener)
 	return
 }
 
@@ -663,7 +673,8 @@ func (engine *Engine[T]) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 // }
 
 func (engine *Engine[T]) handleHTTPRequest(c T, w http.ResponseWriter, req *http.Request) {
-	exec := &Exec[T]{ctx: c, index: -1}
+	exec := &Exec[T]{ctx: c, index: -1, stdCtx: req.Context(), continueOnCancel: engine.ContinueOnCancel, keyring: engine.Keyring}
+	exec.trustedProxy = engine.isTrustedProxy(req.RemoteAddr)
 	exec.WriterMem().reset(w)
 	c.SetExecer(exec)
 	c.Init(w, req)
@@ -752,6 +763,10 @@ func serveError[T IContext](c T, code int, defaultMessage []byte) {
 		return
 	}
 	if c.GetExecer().WriterMem().Status() == code {
+		if acceptsProblem(c.Req()) {
+			abortWithProblem(c, NewProblem(code, ""))
+			return
+		}
 		c.GetExecer().WriterMem().Header()["Content-Type"] = mimePlain
 		_, err := c.Rsp().Write(defaultMessage)
 		if err != nil {
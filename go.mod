@@ -16,6 +16,7 @@ require (
 	github.com/quic-go/quic-go v0.43.1
 	github.com/stretchr/testify v1.9.0
 	github.com/ugorji/go/codec v1.2.12
+	golang.org/x/crypto v0.25.0
 	golang.org/x/net v0.27.0
 	google.golang.org/protobuf v1.34.1
 	gopkg.in/yaml.v3 v3.0.1
@@ -42,7 +43,6 @@ require (
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	go.uber.org/mock v0.4.0 // indirect
 	golang.org/x/arch v0.0.0-20210923205945-b76863e36670 // indirect
-	golang.org/x/crypto v0.25.0 // indirect
 	golang.org/x/exp v0.0.0-20221205204356-47842c84f3db // indirect
 	golang.org/x/mod v0.17.0 // indirect
 	golang.org/x/sys v0.22.0 // indirect
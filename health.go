@@ -0,0 +1,286 @@
+package hi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nbcx/hi/render"
+)
+
+// DefaultHealthCheckTimeout is the timeout of a HealthCheck that does not set one.
+const DefaultHealthCheckTimeout = 5 * time.Second
+
+// Health check statuses, as reported by the /livez and /readyz endpoints.
+const (
+	HealthStatusOK           = "ok"
+	HealthStatusFail         = "fail"
+	HealthStatusDegraded     = "degraded"
+	HealthStatusShuttingDown = "shutting_down"
+)
+
+// HealthCheck is a named probe of a dependency of the service.
+type HealthCheck struct {
+	// Name identifies the check in the detail output.
+	Name string
+
+	// Check reports the health of the dependency, it should honor ctx.
+	Check func(ctx context.Context) error
+
+	// Timeout bounds the run of Check.
+	// Optional. Default value is DefaultHealthCheckTimeout.
+	Timeout time.Duration
+
+	// Critical checks fail the probe, other failing checks only degrade it.
+	Critical bool
+
+	// Liveness checks also run on the liveness probe. Checks are readiness only by default, as a
+	// failing liveness probe gets the process restarted.
+	Liveness bool
+}
+
+// HealthCheckResult is the outcome of a HealthCheck.
+type HealthCheckResult struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HealthReport is the detail output of the /livez and /readyz endpoints.
+type HealthReport struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+// Health is a set of health checks. Its readiness fails as soon as the engine it belongs to
+// starts shutting down, see Engine.Shutdown. It is safe for concurrent use.
+type Health struct {
+	mu       sync.RWMutex
+	checks   []HealthCheck
+	draining atomic.Bool
+}
+
+// NewHealth returns an empty Health. Engines have their own, see Engine.Health.
+func NewHealth() *Health {
+	return &Health{}
+}
+
+// Add registers checks, replacing the ones with the same name.
+func (h *Health) Add(checks ...HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, check := range checks {
+		assert1(check.Name != "", "health check name can not be empty")
+		assert1(check.Check != nil, "health check "+check.Name+" has no Check function")
+		if i := slices.IndexFunc(h.checks, func(c HealthCheck) bool { return c.Name == check.Name }); i >= 0 {
+			h.checks[i] = check
+			continue
+		}
+		h.checks = append(h.checks, check)
+	}
+}
+
+// Drain makes readiness fail from now on. It is called by Engine.Shutdown, and can be
+// registered with http.Server.RegisterOnShutdown when serving through your own server.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// Draining reports whether Drain was called.
+func (h *Health) Draining() bool {
+	return h.draining.Load()
+}
+
+// Liveness runs the liveness checks.
+func (h *Health) Liveness(ctx context.Context) HealthReport {
+	return h.run(ctx, true)
+}
+
+// Readiness runs all the checks. It fails without running them once draining.
+func (h *Health) Readiness(ctx context.Context) HealthReport {
+	if h.Draining() {
+		return HealthReport{Status: HealthStatusShuttingDown}
+	}
+	return h.run(ctx, false)
+}
+
+func (h *Health) run(ctx context.Context, liveness bool) HealthReport {
+	h.mu.RLock()
+	checks := make([]HealthCheck, 0, len(h.checks))
+	for _, check := range h.checks {
+		if !liveness || check.Liveness {
+			checks = append(checks, check)
+		}
+	}
+	h.mu.RUnlock()
+
+	report := HealthReport{Status: HealthStatusOK}
+	if len(checks) == 0 {
+		return report
+	}
+	results := make([]HealthCheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runHealthCheck(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	report.Checks = make(map[string]HealthCheckResult, len(checks))
+	for i, check := range checks {
+		result := results[i]
+		report.Checks[check.Name] = result
+		switch {
+		case result.Status == HealthStatusOK:
+		case check.Critical:
+			report.Status = HealthStatusFail
+		case report.Status == HealthStatusOK:
+			report.Status = HealthStatusDegraded
+		}
+	}
+	return report
+}
+
+// runHealthCheck runs check on its own goroutine, so that a check ignoring its context
+// still times out.
+func runHealthCheck(ctx context.Context, check HealthCheck) HealthCheckResult {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- check.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := HealthCheckResult{
+		Status:   HealthStatusOK,
+		Critical: check.Critical,
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		result.Status = HealthStatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Healthy reports whether the report passes the probe: degraded reports do.
+func (r HealthReport) Healthy() bool {
+	return r.Status == HealthStatusOK || r.Status == HealthStatusDegraded
+}
+
+// LivezHandler returns a handler answering the liveness probe of h with its JSON report,
+// with status 200 when healthy and 503 otherwise.
+func LivezHandler[T IContext](h *Health) HandlerFunc[T] {
+	return func(c T) {
+		renderHealthReport(c, h.Liveness(c.Req().Context()))
+	}
+}
+
+// ReadyzHandler returns a handler answering the readiness probe of h with its JSON report,
+// with status 200 when ready and 503 otherwise.
+func ReadyzHandler[T IContext](h *Health) HandlerFunc[T] {
+	return func(c T) {
+		renderHealthReport(c, h.Readiness(c.Req().Context()))
+	}
+}
+
+func renderHealthReport[T IContext](c T, report HealthReport) {
+	code := http.StatusOK
+	if !report.Healthy() {
+		code = http.StatusServiceUnavailable
+	}
+	c.GetExecer().Header("Cache-Control", "no-store")
+	c.GetExecer().WriterMem().WriteHeader(code)
+	if err := (render.JSON{Data: report}).Render(c.Rsp()); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+// Health returns the health checks of the engine. Their readiness fails once Shutdown begins.
+func (engine *Engine[T]) Health() *Health {
+	return engine.health
+}
+
+// HealthEndpoints registers the GET and HEAD /livez and /readyz probes of the engine's health
+// checks, behind handlers.
+func (engine *Engine[T]) HealthEndpoints(handlers ...HandlerFunc[T]) {
+	livez := append(slices.Clone(handlers), LivezHandler[T](engine.health))
+	readyz := append(slices.Clone(handlers), ReadyzHandler[T](engine.health))
+	engine.GET("/livez", livez...)
+	engine.HEAD("/livez", livez...)
+	engine.GET("/readyz", readyz...)
+	engine.HEAD("/readyz", readyz...)
+}
+
+// Shutdown gracefully shuts down the servers started by the Run methods. Readiness starts
+// failing right away; the servers keep serving for ShutdownDrainDelay, so that load balancers
+// stop routing to this instance, then stop accepting connections and wait for the active
+// requests to complete, until ctx is done. See http.Server.Shutdown.
+func (engine *Engine[T]) Shutdown(ctx context.Context) error {
+	engine.health.Drain()
+	if delay := engine.ShutdownDrainDelay; delay > 0 {
+		debugPrint("Draining for %v before shutting down\n", delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	engine.serversMu.Lock()
+	servers := engine.servers
+	engine.servers = nil
+	engine.shutdown = true
+	engine.serversMu.Unlock()
+
+	errs := make([]error, 0, len(servers))
+	for _, srv := range servers {
+		errs = append(errs, srv.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// newServer returns a server serving the engine on addr, tracked for Shutdown. Once the
+// engine is shut down, the server is returned closed.
+func (engine *Engine[T]) newServer(addr string) *http.Server {
+	srv := &http.Server{Addr: addr, Handler: engine.Handler()}
+	if engine.TLSConfig != nil {
+		srv.TLSConfig = engine.TLSConfig.Clone()
+	}
+	engine.serversMu.Lock()
+	defer engine.serversMu.Unlock()
+	if engine.shutdown {
+		_ = srv.Close()
+		return srv
+	}
+	engine.servers = append(engine.servers, srv)
+	return srv
+}
@@ -0,0 +1,110 @@
+package hi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeHealthReport(t *testing.T, body []byte) HealthReport {
+	var report HealthReport
+	require.NoError(t, json.Unmarshal(body, &report))
+	return report
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	router := New(&Context{})
+	router.HealthEndpoints()
+	dbErr := error(nil)
+	router.Health().Add(
+		HealthCheck{Name: "process", Check: func(context.Context) error { return nil }, Liveness: true},
+		HealthCheck{Name: "db", Check: func(context.Context) error { return dbErr }, Critical: true},
+		HealthCheck{Name: "cache", Check: func(context.Context) error { return errors.New("miss") }},
+	)
+
+	w := PerformRequest(router, http.MethodGet, "/livez")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	report := decodeHealthReport(t, w.Body.Bytes())
+	assert.Equal(t, HealthStatusOK, report.Status)
+	assert.Len(t, report.Checks, 1)
+
+	w = PerformRequest(router, http.MethodGet, "/readyz")
+	assert.Equal(t, http.StatusOK, w.Code)
+	report = decodeHealthReport(t, w.Body.Bytes())
+	assert.Equal(t, HealthStatusDegraded, report.Status)
+	assert.Equal(t, HealthStatusFail, report.Checks["cache"].Status)
+	assert.Equal(t, "miss", report.Checks["cache"].Error)
+
+	dbErr = errors.New("connection refused")
+	w = PerformRequest(router, http.MethodGet, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	report = decodeHealthReport(t, w.Body.Bytes())
+	assert.Equal(t, HealthStatusFail, report.Status)
+	assert.True(t, report.Checks["db"].Critical)
+
+	w = PerformRequest(router, http.MethodHead, "/livez")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHealthCheckTimeoutAndPanic(t *testing.T) {
+	h := NewHealth()
+	h.Add(
+		HealthCheck{Name: "slow", Timeout: 10 * time.Millisecond, Critical: true, Check: func(context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		}},
+		HealthCheck{Name: "broken", Check: func(context.Context) error { panic("oops") }},
+	)
+
+	start := time.Now()
+	report := h.Readiness(context.Background())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, HealthStatusFail, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["slow"].Error)
+	assert.Equal(t, "panic: oops", report.Checks["broken"].Error)
+
+	assert.Panics(t, func() { h.Add(HealthCheck{Name: "nil"}) })
+}
+
+func TestEngineShutdownFailsReadiness(t *testing.T) {
+	router := New(&Context{})
+	router.ShutdownDrainDelay = 50 * time.Millisecond
+	router.HealthEndpoints()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	served := make(chan error, 1)
+	go func() { served <- router.RunListener(listener) }()
+	url := "http://" + listener.Addr().String() + "/readyz"
+
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(url)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- router.Shutdown(context.Background()) }()
+
+	// still serving during the drain delay, but no longer ready
+	require.Eventually(t, func() bool { return router.Health().Draining() }, time.Second, time.Millisecond)
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	require.NoError(t, <-shutdown)
+	assert.ErrorIs(t, <-served, http.ErrServerClosed)
+	assert.ErrorIs(t, router.RunListener(listener), http.ErrServerClosed)
+}
@@ -0,0 +1,127 @@
+package hi
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHtpasswdCheckInterval is the default interval between two checks of an htpasswd file
+// for changes.
+const DefaultHtpasswdCheckInterval = time.Second
+
+// HtpasswdFile verifies credentials against an Apache htpasswd file of bcrypt, argon2 or
+// SHA-crypt hashes (htpasswd -B, or mkpasswd), or of the weaker apr1-MD5 and {SHA} ones
+// (htpasswd -m and -s). The file is reloaded when it changes, at most once per CheckInterval.
+// It is safe for concurrent use.
+type HtpasswdFile struct {
+	// CheckInterval is the interval between two checks of the file for changes.
+	// Optional. Default value is DefaultHtpasswdCheckInterval.
+	CheckInterval time.Duration
+
+	path string
+
+	mu        sync.RWMutex
+	hashes    map[string]string
+	dummy     string
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+// NewHtpasswdFile reads the htpasswd file at path.
+func NewHtpasswdFile(path string) (*HtpasswdFile, error) {
+	f := &HtpasswdFile{path: path}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload reads the file again. The previous credentials are kept if the file is invalid.
+func (f *HtpasswdFile) Reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	hashes, dummy, err := parseHtpasswd(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.path, err)
+	}
+	f.mu.Lock()
+	f.hashes, f.dummy, f.modTime = hashes, dummy, info.ModTime()
+	f.mu.Unlock()
+	return nil
+}
+
+// Verify is a Verifier checking the credentials against the file. The identity is the user
+// name.
+func (f *HtpasswdFile) Verify(user, pass string) (any, bool) {
+	f.reloadIfChanged()
+	f.mu.RLock()
+	encoded, found := f.hashes[user]
+	if !found {
+		// hash anyway, so that unknown users are not told apart by timing
+		encoded = f.dummy
+	}
+	f.mu.RUnlock()
+	ok, _ := ComparePasswordHash(encoded, pass)
+	return user, ok && found
+}
+
+func (f *HtpasswdFile) reloadIfChanged() {
+	interval := f.CheckInterval
+	if interval <= 0 {
+		interval = DefaultHtpasswdCheckInterval
+	}
+	now := time.Now()
+	f.mu.Lock()
+	if now.Sub(f.lastCheck) < interval {
+		f.mu.Unlock()
+		return
+	}
+	f.lastCheck = now
+	modTime := f.modTime
+	f.mu.Unlock()
+
+	if info, err := os.Stat(f.path); err == nil && !info.ModTime().Equal(modTime) {
+		if err := f.Reload(); err != nil {
+			debugPrint("[WARNING] htpasswd reload failed: %v\n", err)
+		}
+	}
+}
+
+func parseHtpasswd(data []byte) (hashes map[string]string, dummy string, err error) {
+	hashes = make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		user, encoded, ok := strings.Cut(text, ":")
+		if !ok || user == "" {
+			return nil, "", fmt.Errorf("line %d: malformed entry", line)
+		}
+		if err := checkPasswordHash(encoded); err != nil {
+			return nil, "", fmt.Errorf("line %d: user %q: %w", line, user, err)
+		}
+		hashes[user] = encoded
+		dummy = encoded
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", err
+	}
+	if len(hashes) == 0 {
+		return nil, "", errors.New("no credentials")
+	}
+	return hashes, dummy, nil
+}
@@ -0,0 +1,84 @@
+package hi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHtpasswdFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".htpasswd")
+	require.NoError(t, os.WriteFile(path, []byte(
+		"# users\nalice:$5$saltstring$C3o4O1TC6aRHF4FI.QSZMXtHbaj2gSXr4sUc/3NcUi.\n\n"), 0o600))
+
+	f, err := NewHtpasswdFile(path)
+	require.NoError(t, err)
+	identity, ok := f.Verify("alice", "secret")
+	assert.True(t, ok)
+	assert.Equal(t, "alice", identity)
+	_, ok = f.Verify("bob", "secret")
+	assert.False(t, ok)
+
+	// the file changes: bob is added, alice's password is changed
+	require.NoError(t, os.WriteFile(path, []byte(
+		"alice:"+argon2idHash("changed", "somesalt")+"\n"+
+			"bob:$6$saltstring$AIsRs/Ee56G/tC8MEHhvReZTfx8u3rXXMl6eYrjCG9ibix19DxoMBLogdTET5Ukw9Sf7eZTITsuk0Ry5qulYz.\n"), 0o600))
+	future := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(path, future, future))
+
+	// not checked again before CheckInterval
+	_, ok = f.Verify("bob", "secret")
+	assert.False(t, ok)
+
+	f.mu.Lock()
+	f.lastCheck = time.Time{}
+	f.mu.Unlock()
+	_, ok = f.Verify("bob", "secret")
+	assert.True(t, ok)
+	_, ok = f.Verify("alice", "secret")
+	assert.False(t, ok)
+	_, ok = f.Verify("alice", "changed")
+	assert.True(t, ok)
+
+	// an invalid file keeps the previous credentials
+	require.NoError(t, os.WriteFile(path, []byte("alice:plaintext\n"), 0o600))
+	assert.Error(t, f.Reload())
+	_, ok = f.Verify("bob", "secret")
+	assert.True(t, ok)
+}
+
+func TestHtpasswdFileApache(t *testing.T) {
+	// as written by htpasswd -m and htpasswd -s
+	path := filepath.Join(t.TempDir(), ".htpasswd")
+	require.NoError(t, os.WriteFile(path, []byte(
+		"alice:$apr1$Cz1bSKeU$Fd8lc1diEty36H7y05wCd0\nbob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n"), 0o600))
+
+	f, err := NewHtpasswdFile(path)
+	require.NoError(t, err)
+	for _, user := range []string{"alice", "bob"} {
+		_, ok := f.Verify(user, "secret")
+		assert.True(t, ok, user)
+		_, ok = f.Verify(user, "wrong")
+		assert.False(t, ok, user)
+	}
+}
+
+func TestHtpasswdFileInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"empty":     "# nobody\n",
+		"malformed": "alice\n",
+		"plaintext": "alice:secret\n",
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		_, err := NewHtpasswdFile(path)
+		assert.Error(t, err, name)
+	}
+	_, err := NewHtpasswdFile(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,475 @@
+package hi
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"math"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbcx/hi/internal/json"
+)
+
+// JWTClaimsKey is the key the verified claims of a request are stored under in the context.
+const JWTClaimsKey = "jwt_claims"
+
+// JWT validation errors, recorded in the context errors of the rejected requests.
+var (
+	ErrJWTMissing     = errors.New("jwt: bearer token missing")
+	ErrJWTMalformed   = errors.New("jwt: malformed token")
+	ErrJWTAlgorithm   = errors.New("jwt: algorithm not allowed")
+	ErrJWTUnknownKey  = errors.New("jwt: unknown signing key")
+	ErrJWTSignature   = errors.New("jwt: invalid signature")
+	ErrJWTExpired     = errors.New("jwt: token is expired")
+	ErrJWTNotYetValid = errors.New("jwt: token is not valid yet")
+	ErrJWTIssuer      = errors.New("jwt: invalid issuer")
+	ErrJWTAudience    = errors.New("jwt: invalid audience")
+)
+
+// JWTAlgorithms are the supported signing algorithms.
+var JWTAlgorithms = []string{"HS256", "HS384", "HS512", "RS256", "ES256", "EdDSA"}
+
+// NumericDate is a JWT date, in seconds since the epoch.
+type NumericDate struct {
+	time.Time
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (d NumericDate) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, d.Unix(), 10), nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *NumericDate) UnmarshalJSON(b []byte) error {
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return fmt.Errorf("jwt: invalid numeric date %s", b)
+	}
+	sec, frac := math.Modf(f)
+	d.Time = time.Unix(int64(sec), int64(frac*1e9))
+	return nil
+}
+
+// Audience is the aud claim, a single string or an array of strings.
+type Audience []string
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return fmt.Errorf("jwt: invalid audience %s", b)
+	}
+	*a = many
+	return nil
+}
+
+// RegisteredClaims are the registered JWT claims. Embed it in the claims type of JWTAuth.
+type RegisteredClaims struct {
+	Issuer    string       `json:"iss,omitempty"`
+	Subject   string       `json:"sub,omitempty"`
+	Audience  Audience     `json:"aud,omitempty"`
+	ExpiresAt *NumericDate `json:"exp,omitempty"`
+	NotBefore *NumericDate `json:"nbf,omitempty"`
+	IssuedAt  *NumericDate `json:"iat,omitempty"`
+	ID        string       `json:"jti,omitempty"`
+}
+
+// Registered returns c, so that claims types embedding RegisteredClaims implement Claims.
+func (c *RegisteredClaims) Registered() *RegisteredClaims {
+	return c
+}
+
+// Claims is implemented by the claims types embedding RegisteredClaims.
+type Claims interface {
+	Registered() *RegisteredClaims
+}
+
+// JWTKeySet resolves the key verifying a token from its kid and alg headers. The key is a
+// []byte for HMAC, a *rsa.PublicKey, an *ecdsa.PublicKey or an ed25519.PublicKey.
+type JWTKeySet interface {
+	Key(kid, alg string) (any, error)
+}
+
+// StaticJWTKeys is a JWTKeySet mapping key IDs to keys. The key under "" verifies the tokens
+// without kid.
+type StaticJWTKeys map[string]any
+
+// Key implements the JWTKeySet interface.
+func (keys StaticJWTKeys) Key(kid, _ string) (any, error) {
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrJWTUnknownKey
+}
+
+// JWKSFile is a JWTKeySet read from a local JSON Web Key Set file. The file is read again
+// when a token refers to an unknown key ID and the file changed, so keys can be rotated by
+// rewriting it.
+type JWKSFile struct {
+	path string
+
+	mu      sync.RWMutex
+	keys    map[string]any
+	modTime time.Time
+}
+
+// NewJWKSFile reads the JSON Web Key Set at path.
+func NewJWKSFile(path string) (*JWKSFile, error) {
+	f := &JWKSFile{path: path}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload reads the file again.
+func (f *JWKSFile) Reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.keys = keys
+	f.modTime = info.ModTime()
+	f.mu.Unlock()
+	return nil
+}
+
+// Key implements the JWTKeySet interface.
+func (f *JWKSFile) Key(kid, _ string) (any, error) {
+	f.mu.RLock()
+	key, ok := f.keys[kid]
+	modTime := f.modTime
+	f.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	if info, err := os.Stat(f.path); err != nil || !info.ModTime().After(modTime) {
+		return nil, ErrJWTUnknownKey
+	}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if key, ok = f.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrJWTUnknownKey
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// ParseJWKS parses a JSON Web Key Set into keys by key ID. Keys of unsupported types and
+// encryption keys are skipped.
+func ParseJWKS(data []byte) (map[string]any, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwks: key %q: %w", k.Kid, err)
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	b64 := base64.RawURLEncoding
+	switch k.Kty {
+	case "RSA":
+		n, err1 := b64.DecodeString(k.N)
+		e, err2 := b64.DecodeString(k.E)
+		if err := errors.Join(err1, err2); err != nil || len(e) > 4 {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err1 := b64.DecodeString(k.X)
+		y, err2 := b64.DecodeString(k.Y)
+		if err := errors.Join(err1, err2); err != nil {
+			return nil, errors.New("invalid EC key")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) { //nolint: staticcheck
+			return nil, errors.New("invalid EC key")
+		}
+		return key, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, nil
+		}
+		x, err := b64.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		key, err := b64.DecodeString(k.K)
+		if err != nil {
+			return nil, errors.New("invalid symmetric key")
+		}
+		return key, nil
+	}
+	return nil, nil
+}
+
+// JWTConfig defines the config for JWTAuth middleware.
+type JWTConfig struct {
+	// Keys resolves the verification keys, see StaticJWTKeys and JWKSFile.
+	Keys JWTKeySet
+
+	// Algorithms are the accepted signing algorithms.
+	// Optional. Default value is JWTAlgorithms.
+	Algorithms []string
+
+	// Issuer is the required iss claim.
+	// Optional. Default value accepts any issuer.
+	Issuer string
+
+	// Audience lists the accepted aud claims, the token must carry one of them.
+	// Optional. Default value accepts any audience.
+	Audience []string
+
+	// Leeway is the clock skew tolerated on exp and nbf.
+	// Optional.
+	Leeway time.Duration
+
+	// Realm is the realm of the WWW-Authenticate challenge.
+	// Optional. Default value is "Authorization Required".
+	Realm string
+}
+
+// JWTAuth returns a Bearer JWT authentication middleware. The verified claims are unmarshalled
+// into a C, stored in the context (see JWTClaimsFrom), and the sub claim under AuthUserKey.
+// Requests without a valid token are answered with 401 and an RFC 6750 challenge.
+//
+//	type UserClaims struct {
+//		hi.RegisteredClaims
+//		Roles []string `json:"roles"`
+//	}
+//
+//	router.Use(hi.JWTAuth[*hi.Context, UserClaims](hi.JWTConfig{Keys: keys}))
+func JWTAuth[T IContext, C any, PC interface {
+	*C
+	Claims
+}](conf JWTConfig) HandlerFunc[T] {
+	assert1(conf.Keys != nil, "jwt keys can not be nil")
+	if len(conf.Algorithms) == 0 {
+		conf.Algorithms = JWTAlgorithms
+	}
+	for _, alg := range conf.Algorithms {
+		assert1(slices.Contains(JWTAlgorithms, alg), "unsupported jwt algorithm "+alg)
+	}
+	if conf.Realm == "" {
+		conf.Realm = "Authorization Required"
+	}
+	challenge := "Bearer realm=" + strconv.Quote(conf.Realm)
+
+	return func(c T) {
+		token, err := bearerToken(c.Req())
+		if err != nil {
+			status, header := http.StatusUnauthorized, challenge
+			if err != ErrJWTMissing {
+				status = http.StatusBadRequest
+				header += `, error="invalid_request", error_description=` + strconv.Quote(err.Error())
+			}
+			c.GetExecer().Header("WWW-Authenticate", header)
+			_ = c.Error(err)
+			c.GetExecer().AbortWithStatus(status)
+			return
+		}
+
+		claims := PC(new(C))
+		if err := verifyJWT(token, &conf, claims); err != nil {
+			c.GetExecer().Header("WWW-Authenticate",
+				challenge+`, error="invalid_token", error_description=`+strconv.Quote(err.Error()))
+			_ = c.Error(err)
+			c.GetExecer().AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Set(JWTClaimsKey, claims)
+		if sub := claims.Registered().Subject; sub != "" {
+			c.Set(AuthUserKey, sub)
+		}
+	}
+}
+
+// JWTClaimsFrom returns the claims stored by JWTAuth[T, C], ok is false if there are none.
+func JWTClaimsFrom[C any](c IContext) (claims *C, ok bool) {
+	claims, ok = c.GetKeys()[JWTClaimsKey].(*C)
+	return
+}
+
+func bearerToken(req *http.Request) (string, error) {
+	values := req.Header.Values("Authorization")
+	if len(values) == 0 {
+		return "", ErrJWTMissing
+	}
+	if len(values) > 1 {
+		return "", errors.New("multiple authorization headers")
+	}
+	scheme, token, _ := strings.Cut(values[0], " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", ErrJWTMissing
+	}
+	if token = strings.TrimSpace(token); token == "" {
+		return "", errors.New("empty bearer token")
+	}
+	return token, nil
+}
+
+// verifyJWT verifies the signature and the registered claims of token, unmarshalling its
+// payload into claims.
+func verifyJWT(token string, conf *JWTConfig, claims Claims) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrJWTMalformed
+	}
+	b64 := base64.RawURLEncoding
+	rawHeader, err1 := b64.DecodeString(parts[0])
+	payload, err2 := b64.DecodeString(parts[1])
+	signature, err3 := b64.DecodeString(parts[2])
+	if errors.Join(err1, err2, err3) != nil {
+		return ErrJWTMalformed
+	}
+	var header struct {
+		Alg  string `json:"alg"`
+		Kid  string `json:"kid"`
+		Crit []any  `json:"crit"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil || header.Crit != nil {
+		return ErrJWTMalformed
+	}
+	if !slices.Contains(conf.Algorithms, header.Alg) {
+		return ErrJWTAlgorithm
+	}
+	key, err := conf.Keys.Key(header.Kid, header.Alg)
+	if err != nil {
+		return err
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return ErrJWTMalformed
+	}
+	return validateRegisteredClaims(claims.Registered(), conf, time.Now())
+}
+
+func verifyJWTSignature(alg string, key any, signed string, signature []byte) error {
+	var h func() hash.Hash
+	var ch crypto.Hash
+	switch alg {
+	case "HS256", "RS256", "ES256":
+		h, ch = sha256.New, crypto.SHA256
+	case "HS384":
+		h, ch = sha512.New384, crypto.SHA384
+	case "HS512":
+		h, ch = sha512.New, crypto.SHA512
+	}
+
+	ok := false
+	switch k := key.(type) {
+	case []byte:
+		if strings.HasPrefix(alg, "HS") {
+			mac := hmac.New(h, k)
+			mac.Write([]byte(signed))
+			ok = hmac.Equal(mac.Sum(nil), signature)
+		}
+	case *rsa.PublicKey:
+		if alg == "RS256" {
+			digest := sha256.Sum256([]byte(signed))
+			ok = rsa.VerifyPKCS1v15(k, ch, digest[:], signature) == nil
+		}
+	case *ecdsa.PublicKey:
+		if alg == "ES256" && len(signature) == 64 {
+			digest := sha256.Sum256([]byte(signed))
+			r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+			ok = ecdsa.Verify(k, digest[:], r, s)
+		}
+	case ed25519.PublicKey:
+		if alg == "EdDSA" {
+			ok = ed25519.Verify(k, []byte(signed), signature)
+		}
+	default:
+		return ErrJWTUnknownKey
+	}
+	if !ok {
+		return ErrJWTSignature
+	}
+	return nil
+}
+
+func validateRegisteredClaims(claims *RegisteredClaims, conf *JWTConfig, now time.Time) error {
+	if claims.ExpiresAt != nil && !now.Before(claims.ExpiresAt.Add(conf.Leeway)) {
+		return ErrJWTExpired
+	}
+	if claims.NotBefore != nil && now.Add(conf.Leeway).Before(claims.NotBefore.Time) {
+		return ErrJWTNotYetValid
+	}
+	if conf.Issuer != "" && claims.Issuer != conf.Issuer {
+		return ErrJWTIssuer
+	}
+	if len(conf.Audience) > 0 && !slices.ContainsFunc(claims.Audience, func(aud string) bool {
+		return slices.Contains(conf.Audience, aud)
+	}) {
+		return ErrJWTAudience
+	}
+	return nil
+}
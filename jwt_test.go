@@ -0,0 +1,226 @@
+package hi
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testJWTClaims struct {
+	RegisteredClaims
+	Role string `json:"role"`
+}
+
+func signTestJWT(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT", "kid": kid})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	b64 := base64.RawURLEncoding
+	signed := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		require.NoError(t, err)
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	}
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func jwtRouter(conf JWTConfig) *Engine[*Context] {
+	router := New(&Context{})
+	router.Use(JWTAuth[*Context, testJWTClaims](conf))
+	router.GET("/", func(c *Context) {
+		claims, ok := JWTClaimsFrom[testJWTClaims](c)
+		if !ok {
+			c.String(http.StatusInternalServerError, "no claims")
+			return
+		}
+		c.String(http.StatusOK, c.GetKeys()[AuthUserKey].(string)+":"+claims.Role)
+	})
+	return router
+}
+
+func TestJWTAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	secret := []byte("secret")
+
+	router := jwtRouter(JWTConfig{Keys: StaticJWTKeys{
+		"hs": secret,
+		"rs": &rsaKey.PublicKey,
+		"es": &ecKey.PublicKey,
+		"ed": edPub,
+	}})
+	claims := map[string]any{"sub": "alice", "role": "admin", "exp": time.Now().Add(time.Hour).Unix()}
+
+	for _, tc := range []struct {
+		alg, kid string
+		key      any
+	}{
+		{"HS256", "hs", secret},
+		{"RS256", "rs", rsaKey},
+		{"ES256", "es", ecKey},
+		{"EdDSA", "ed", edKey},
+	} {
+		token := signTestJWT(t, tc.alg, tc.kid, tc.key, claims)
+		w := PerformRequest(router, http.MethodGet, "/", header{"Authorization", "Bearer " + token})
+		assert.Equal(t, http.StatusOK, w.Code, tc.alg)
+		assert.Equal(t, "alice:admin", w.Body.String(), tc.alg)
+	}
+
+	// algorithm confusion: an HMAC token must not verify with an asymmetric key
+	token := signTestJWT(t, "HS256", "rs", secret, claims)
+	w := PerformRequest(router, http.MethodGet, "/", header{"Authorization", "Bearer " + token})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestJWTClaimsValidation(t *testing.T) {
+	secret := []byte("secret")
+	router := jwtRouter(JWTConfig{
+		Keys:     StaticJWTKeys{"": secret},
+		Issuer:   "https://issuer",
+		Audience: []string{"api"},
+		Leeway:   time.Minute,
+	})
+	now := time.Now()
+	valid := map[string]any{"sub": "bob", "iss": "https://issuer", "aud": []string{"web", "api"}}
+
+	for _, tc := range []struct {
+		name   string
+		change map[string]any
+		status int
+		reason string
+	}{
+		{"valid", nil, http.StatusOK, ""},
+		{"single audience", map[string]any{"aud": "api"}, http.StatusOK, ""},
+		{"expired within leeway", map[string]any{"exp": now.Add(-30 * time.Second).Unix()}, http.StatusOK, ""},
+		{"expired", map[string]any{"exp": now.Add(-2 * time.Minute).Unix()}, http.StatusUnauthorized, ErrJWTExpired.Error()},
+		{"not yet valid", map[string]any{"nbf": now.Add(2 * time.Minute).Unix()}, http.StatusUnauthorized, ErrJWTNotYetValid.Error()},
+		{"issuer", map[string]any{"iss": "https://other"}, http.StatusUnauthorized, ErrJWTIssuer.Error()},
+		{"audience", map[string]any{"aud": "other"}, http.StatusUnauthorized, ErrJWTAudience.Error()},
+	} {
+		claims := map[string]any{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		for k, v := range tc.change {
+			claims[k] = v
+		}
+		token := signTestJWT(t, "HS256", "", secret, claims)
+		w := PerformRequest(router, http.MethodGet, "/", header{"Authorization", "Bearer " + token})
+		assert.Equal(t, tc.status, w.Code, tc.name)
+		if tc.reason != "" {
+			assert.Equal(t, `Bearer realm="Authorization Required", error="invalid_token", error_description="`+tc.reason+`"`,
+				w.Header().Get("WWW-Authenticate"), tc.name)
+		}
+	}
+}
+
+func TestJWTChallenge(t *testing.T) {
+	router := jwtRouter(JWTConfig{Keys: StaticJWTKeys{"": []byte("secret")}, Realm: "api"})
+
+	w := PerformRequest(router, http.MethodGet, "/")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer realm="api"`, w.Header().Get("WWW-Authenticate"))
+
+	w = PerformRequest(router, http.MethodGet, "/", header{"Authorization", "Bearer "})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("WWW-Authenticate"), `Bearer realm="api", error="invalid_request"`))
+
+	w = PerformRequest(router, http.MethodGet, "/", header{"Authorization", "Bearer a.b"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+
+	token := signTestJWT(t, "HS256", "", []byte("wrong"), map[string]any{"sub": "eve"})
+	w = PerformRequest(router, http.MethodGet, "/", header{"Authorization", "Bearer " + token})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), ErrJWTSignature.Error())
+}
+
+func TestJWKSFileRotation(t *testing.T) {
+	b64 := base64.RawURLEncoding
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS := func(keys ...map[string]string) {
+		data, err := json.Marshal(map[string]any{"keys": keys})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+	}
+	rsaJWK := map[string]string{
+		"kty": "RSA", "kid": "k1", "use": "sig",
+		"n": b64.EncodeToString(rsaKey.N.Bytes()),
+		"e": b64.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+	}
+	writeJWKS(rsaJWK)
+
+	keys, err := NewJWKSFile(path)
+	require.NoError(t, err)
+	router := jwtRouter(JWTConfig{Keys: keys})
+	claims := map[string]any{"sub": "carol", "role": "user"}
+
+	token := signTestJWT(t, "RS256", "k1", rsaKey, claims)
+	w := PerformRequest(router, http.MethodGet, "/", header{"Authorization", "Bearer " + token})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	token = signTestJWT(t, "ES256", "k2", ecKey, claims)
+	w = PerformRequest(router, http.MethodGet, "/", header{"Authorization", "Bearer " + token})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// rotate in the new key
+	writeJWKS(rsaJWK, map[string]string{
+		"kty": "EC", "kid": "k2", "crv": "P-256",
+		"x": b64.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))),
+		"y": b64.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32))),
+	})
+	future := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(path, future, future))
+
+	w = PerformRequest(router, http.MethodGet, "/", header{"Authorization", "Bearer " + token})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "carol:user", w.Body.String())
+}
+
+func TestJWTAuthPanics(t *testing.T) {
+	assert.Panics(t, func() { JWTAuth[*Context, testJWTClaims](JWTConfig{}) })
+	assert.Panics(t, func() {
+		JWTAuth[*Context, testJWTClaims](JWTConfig{Keys: StaticJWTKeys{}, Algorithms: []string{"none"}})
+	})
+}
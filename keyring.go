@@ -0,0 +1,112 @@
+package hi
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// Keyring errors, recorded in the context errors when a cookie is rejected. ErrNoKeyring is
+// returned when signed or encrypted cookies are used without an Engine.Keyring.
+var (
+	ErrCookieSignature = errors.New("cookie signature invalid")
+	ErrCookieDecrypt   = errors.New("cookie decryption failed")
+	ErrNoKeyring       = errors.New("no keyring configured")
+)
+
+// Keyring holds the secret keys of the signed and encrypted cookies, see Engine.Keyring. The
+// first key signs and encrypts, all of them verify and decrypt: to rotate the keys, put the
+// new key first and drop the old one once the cookies it protected have expired.
+type Keyring struct {
+	signing [][]byte
+	aeads   []cipher.AEAD
+}
+
+// NewKeyring returns a Keyring of keys, which must be random and at least 16 bytes long. The
+// signing and encryption keys are derived from them, a key can serve both purposes.
+func NewKeyring(keys ...[]byte) *Keyring {
+	assert1(len(keys) > 0, "keyring keys can not be empty")
+	k := &Keyring{}
+	for _, key := range keys {
+		assert1(len(key) >= 16, "keyring keys must be at least 16 bytes long")
+		block, err := aes.NewCipher(deriveKey(key, "encryption"))
+		if err != nil {
+			panic(err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			panic(err)
+		}
+		k.signing = append(k.signing, deriveKey(key, "signing"))
+		k.aeads = append(k.aeads, aead)
+	}
+	return k
+}
+
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("hi/keyring/" + purpose))
+	return mac.Sum(nil)
+}
+
+// Sign returns value followed by its HMAC-SHA256 signature, bound to the cookie name.
+func (k *Keyring) Sign(name, value string) string {
+	return value + "." + k.mac(k.signing[0], name, value)
+}
+
+// Verify returns the value of signed if its signature is valid for name, ErrCookieSignature
+// otherwise.
+func (k *Keyring) Verify(name, signed string) (string, error) {
+	i := strings.LastIndexByte(signed, '.')
+	if i < 0 {
+		return "", ErrCookieSignature
+	}
+	value, mac := signed[:i], signed[i+1:]
+	for _, key := range k.signing {
+		if hmac.Equal([]byte(mac), []byte(k.mac(key, name, value))) {
+			return value, nil
+		}
+	}
+	return "", ErrCookieSignature
+}
+
+func (k *Keyring) mac(key []byte, name, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name + "=" + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Encrypt returns plaintext encrypted and authenticated with AES-256-GCM, bound to the cookie
+// name, encoded in unpadded base64url.
+func (k *Keyring) Encrypt(name string, plaintext []byte) string {
+	aead := k.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, []byte(name)))
+}
+
+// Decrypt returns the plaintext of a value returned by Encrypt for name, ErrCookieDecrypt if
+// it was not encrypted with one of the keys or was tampered with.
+func (k *Keyring) Decrypt(name, value string) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrCookieDecrypt
+	}
+	for _, aead := range k.aeads {
+		if len(data) < aead.NonceSize() {
+			break
+		}
+		nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+		if plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(name)); err == nil {
+			return plaintext, nil
+		}
+	}
+	return nil, ErrCookieDecrypt
+}
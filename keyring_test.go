@@ -0,0 +1,62 @@
+package hi
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyringRotation(t *testing.T) {
+	oldKey := []byte("fedcba9876543210")
+	newKey := []byte("0123456789abcdef")
+	old := NewKeyring(oldKey)
+	rotated := NewKeyring(newKey, oldKey)
+
+	signed := old.Sign("uid", "42")
+	value, err := rotated.Verify("uid", signed)
+	require.NoError(t, err)
+	assert.Equal(t, "42", value)
+	_, err = old.Verify("uid", rotated.Sign("uid", "42"))
+	assert.ErrorIs(t, err, ErrCookieSignature)
+	_, err = rotated.Verify("other", signed)
+	assert.ErrorIs(t, err, ErrCookieSignature)
+	_, err = rotated.Verify("uid", "42")
+	assert.ErrorIs(t, err, ErrCookieSignature)
+
+	encrypted := old.Encrypt("cart", []byte("apples"))
+	plaintext, err := rotated.Decrypt("cart", encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "apples", string(plaintext))
+	assert.NotEqual(t, encrypted, old.Encrypt("cart", []byte("apples")), "nonces are random")
+	_, err = NewKeyring(newKey).Decrypt("cart", encrypted)
+	assert.ErrorIs(t, err, ErrCookieDecrypt)
+	tampered := []byte(encrypted)
+	tampered[20] ^= 1
+	_, err = rotated.Decrypt("cart", string(tampered))
+	assert.ErrorIs(t, err, ErrCookieDecrypt)
+	_, err = rotated.Decrypt("cart", "!")
+	assert.ErrorIs(t, err, ErrCookieDecrypt)
+
+	assert.Panics(t, func() { NewKeyring() })
+	assert.Panics(t, func() { NewKeyring([]byte("short")) })
+}
+
+func TestEngineKeyring(t *testing.T) {
+	router := New(&Context{})
+	router.Keyring = NewKeyring([]byte("0123456789abcdef"))
+	router.GET("/set", func(c *Context) {
+		_ = c.SetEncryptedCookie("theme", "dark", 0, "/", "", false, true)
+	})
+	router.GET("/get", func(c *Context) {
+		c.String(http.StatusOK, c.EncryptedCookie("theme", "light").String())
+	})
+
+	w := PerformRequest(router, http.MethodGet, "/set")
+	cookie := w.Result().Cookies()[0]
+	w = PerformRequest(router, http.MethodGet, "/get", header{"Cookie", cookie.Name + "=" + cookie.Value})
+	assert.Equal(t, "dark", w.Body.String())
+	w = PerformRequest(router, http.MethodGet, "/get")
+	assert.Equal(t, "light", w.Body.String())
+}
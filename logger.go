@@ -5,6 +5,8 @@
 package hi
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -35,6 +37,10 @@ const (
 
 var consoleColorMode = autoColor
 
+// StatusClientClosedRequest is the non-standard status code (borrowed from nginx) the Logger
+// reports for requests whose client disconnected before the response was completed.
+const StatusClientClosedRequest = 499
+
 // LoggerConfig defines the config for Logger middleware.
 type LoggerConfig struct {
 	// Optional. Default value is gin.defaultLogFormatter
@@ -83,6 +89,8 @@ type LogFormatterParams struct {
 	BodySize int
 	// Keys are the keys set on the request's context.
 	Keys map[string]any
+	// RequestID is the ID set by the RequestID middleware, if any.
+	RequestID string
 }
 
 // StatusCodeColor is the ANSI color for appropriately logging http status code to a terminal.
@@ -149,13 +157,18 @@ var defaultLogFormatter = func(param LogFormatterParams) string {
 	if param.Latency > time.Minute {
 		param.Latency = param.Latency.Truncate(time.Second)
 	}
-	return fmt.Sprintf("%v |hi|%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+	var requestID string
+	if param.RequestID != "" {
+		requestID = " | " + param.RequestID
+	}
+	return fmt.Sprintf("%v |hi|%s %3d %s| %13v | %15s |%s %-7s %s %#v%s\n%s",
 		param.TimeStamp.Format("2006/01/02 15:04:05"),
 		statusColor, param.StatusCode, resetColor,
 		param.Latency,
 		param.ClientIP,
 		methodColor, param.Method, resetColor,
 		param.Path,
+		requestID,
 		param.ErrorMessage,
 	)
 }
@@ -257,6 +270,7 @@ func LoggerWithConfig[T IContext](conf LoggerConfig) HandlerFunc[T] {
 			isTerm:  isTerm,
 			Keys:    c.GetKeys(),
 		}
+		param.RequestID = GetRequestID(c)
 
 		// Stop timer
 		param.TimeStamp = time.Now()
@@ -265,6 +279,9 @@ func LoggerWithConfig[T IContext](conf LoggerConfig) HandlerFunc[T] {
 		param.ClientIP = ClientIP(c.Req()) //c.ClientIP()
 		param.Method = c.Req().Method
 		param.StatusCode = c.Rsp().Status()
+		if errors.Is(c.Req().Context().Err(), context.Canceled) {
+			param.StatusCode = StatusClientClosedRequest
+		}
 		param.ErrorMessage = c.GetErrors().ByType(ErrorTypePrivate).String()
 
 		param.BodySize = c.Rsp().Size()
@@ -5,8 +5,11 @@
 package hi
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -178,6 +181,26 @@ func TestLoggerWithFormatter(t *testing.T) {
 	assert.Contains(t, buffer.String(), "a=100")
 }
 
+func TestLoggerClientClosedRequest(t *testing.T) {
+	var status int
+	router := New(&Context{})
+	router.Use(LoggerWithConfig[*Context](LoggerConfig{
+		Output: io.Discard,
+		Formatter: func(param LogFormatterParams) string {
+			status = param.StatusCode
+			return ""
+		},
+	}))
+	router.GET("/example", func(c *Context) {})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/example", nil).WithContext(ctx)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, StatusClientClosedRequest, status)
+}
+
 func TestLoggerWithConfigFormatting(t *testing.T) {
 	var gotParam LogFormatterParams
 	var gotKeys map[string]any
@@ -0,0 +1,459 @@
+package hi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsContentType is the Content-Type of the Prometheus text exposition format.
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// UnmatchedRoute is the route label of requests that did not match any route, so that 404
+// scans do not create one series per requested path.
+const UnmatchedRoute = "<unmatched>"
+
+// DefaultMetricsBuckets are the default latency histogram buckets, in seconds.
+var DefaultMetricsBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultMetricsRegistry is the registry used by Metrics when none is configured.
+var DefaultMetricsRegistry = NewMetricsRegistry()
+
+type metricKind int
+
+const (
+	counterKind metricKind = iota
+	gaugeKind
+	histogramKind
+	summaryKind
+)
+
+var metricKindNames = [...]string{"counter", "gauge", "histogram", "summary"}
+
+// MetricsRegistry is a minimal collection of metric families that can be written in the
+// Prometheus text exposition format. It is safe for concurrent use.
+type MetricsRegistry struct {
+	mu       sync.RWMutex
+	families map[string]*metricFamily
+}
+
+// NewMetricsRegistry returns an empty MetricsRegistry.
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{families: make(map[string]*metricFamily)}
+}
+
+// Counter returns the counter family name, registering it if needed.
+func (r *MetricsRegistry) Counter(name, help string, labels ...string) Counter {
+	return Counter{r.register(name, help, counterKind, nil, labels, nil)}
+}
+
+// Gauge returns the gauge family name, registering it if needed.
+func (r *MetricsRegistry) Gauge(name, help string, labels ...string) Gauge {
+	return Gauge{r.register(name, help, gaugeKind, nil, labels, nil)}
+}
+
+// GaugeFunc registers a label-less gauge whose value is read from fn at exposition time.
+func (r *MetricsRegistry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(name, help, gaugeKind, nil, nil, fn)
+}
+
+// CounterFunc registers a label-less counter whose value is read from fn at exposition time.
+func (r *MetricsRegistry) CounterFunc(name, help string, fn func() float64) {
+	r.register(name, help, counterKind, nil, nil, fn)
+}
+
+// Histogram returns the histogram family name, registering it if needed.
+// buckets are the upper bounds of the buckets, DefaultMetricsBuckets if empty.
+func (r *MetricsRegistry) Histogram(name, help string, buckets []float64, labels ...string) Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultMetricsBuckets
+	}
+	buckets = slices.Clone(buckets)
+	sort.Float64s(buckets)
+	return Histogram{r.register(name, help, histogramKind, buckets, labels, nil)}
+}
+
+// Summary returns the summary family name, registering it if needed. Summaries only track the
+// sum and count of the observations, no quantiles.
+func (r *MetricsRegistry) Summary(name, help string, labels ...string) Summary {
+	return Summary{r.register(name, help, summaryKind, nil, labels, nil)}
+}
+
+func (r *MetricsRegistry) register(name, help string, kind metricKind, buckets []float64, labels []string, fn func() float64) *metricFamily {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name]; ok {
+		assert1(f.kind == kind && slices.Equal(f.labels, labels) && slices.Equal(f.buckets, buckets) && fn == nil,
+			"metric "+name+" is already registered with a different definition")
+		return f
+	}
+	f := &metricFamily{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  slices.Clone(labels),
+		buckets: buckets,
+		fn:      fn,
+		series:  make(map[string]*metricSeries),
+	}
+	r.families[name] = f
+	return f
+}
+
+// WriteTo writes all the families in the Prometheus text exposition format.
+func (r *MetricsRegistry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	families := make([]*metricFamily, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.RUnlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, f := range families {
+		f.writeTo(cw)
+	}
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// ServeHTTP implements the http.Handler interface, writing the exposition of all the families.
+func (r *MetricsRegistry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", MetricsContentType)
+	if _, err := r.WriteTo(w); err != nil {
+		debugPrint("cannot write metrics: %v", err)
+	}
+}
+
+// Counter is a family of monotonically increasing values.
+type Counter struct{ f *metricFamily }
+
+// Inc increments the series identified by labelValues by 1.
+func (m Counter) Inc(labelValues ...string) {
+	m.Add(1, labelValues...)
+}
+
+// Add increments the series identified by labelValues by delta, which must not be negative.
+func (m Counter) Add(delta float64, labelValues ...string) {
+	assert1(delta >= 0, "counter can not decrease")
+	s := m.f.with(labelValues)
+	s.mu.Lock()
+	s.value += delta
+	s.mu.Unlock()
+}
+
+// Gauge is a family of values that can go up and down.
+type Gauge struct{ f *metricFamily }
+
+// Add adds delta to the series identified by labelValues.
+func (m Gauge) Add(delta float64, labelValues ...string) {
+	s := m.f.with(labelValues)
+	s.mu.Lock()
+	s.value += delta
+	s.mu.Unlock()
+}
+
+// Set sets the series identified by labelValues to value.
+func (m Gauge) Set(value float64, labelValues ...string) {
+	s := m.f.with(labelValues)
+	s.mu.Lock()
+	s.value = value
+	s.mu.Unlock()
+}
+
+// Histogram is a family of bucketed observations.
+type Histogram struct{ f *metricFamily }
+
+// Observe adds value to the series identified by labelValues.
+func (m Histogram) Observe(value float64, labelValues ...string) {
+	s := m.f.with(labelValues)
+	i := sort.SearchFloat64s(m.f.buckets, value)
+	s.mu.Lock()
+	if i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.sum += value
+	s.count++
+	s.mu.Unlock()
+}
+
+// Summary is a family of observations tracked by their sum and count.
+type Summary struct{ f *metricFamily }
+
+// Observe adds value to the series identified by labelValues.
+func (m Summary) Observe(value float64, labelValues ...string) {
+	s := m.f.with(labelValues)
+	s.mu.Lock()
+	s.sum += value
+	s.count++
+	s.mu.Unlock()
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	kind    metricKind
+	labels  []string
+	buckets []float64
+	fn      func() float64
+
+	mu     sync.RWMutex
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+
+	mu     sync.Mutex
+	value  float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (f *metricFamily) with(labelValues []string) *metricSeries {
+	assert1(len(labelValues) == len(f.labels), "metric "+f.name+" expects "+strconv.Itoa(len(f.labels))+" label values")
+	key := strings.Join(labelValues, "\xff")
+	f.mu.RLock()
+	s, ok := f.series[key]
+	f.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok = f.series[key]; ok {
+		return s
+	}
+	s = &metricSeries{labelValues: slices.Clone(labelValues)}
+	if f.kind == histogramKind {
+		s.counts = make([]uint64, len(f.buckets))
+	}
+	f.series[key] = s
+	return s
+}
+
+func (f *metricFamily) writeTo(w *countingWriter) {
+	w.printf("# HELP %s %s\n", f.name, helpEscaper.Replace(f.help))
+	w.printf("# TYPE %s %s\n", f.name, metricKindNames[f.kind])
+	if f.fn != nil {
+		w.printf("%s %s\n", f.name, formatMetricValue(f.fn()))
+		return
+	}
+
+	f.mu.RLock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	series := make([]*metricSeries, len(keys))
+	for i, key := range keys {
+		series[i] = f.series[key]
+	}
+	f.mu.RUnlock()
+
+	for _, s := range series {
+		labels := formatMetricLabels(f.labels, s.labelValues)
+		s.mu.Lock()
+		switch f.kind {
+		case counterKind, gaugeKind:
+			w.printf("%s%s %s\n", f.name, labels, formatMetricValue(s.value))
+		case histogramKind:
+			var cumulative uint64
+			for i, bound := range f.buckets {
+				cumulative += s.counts[i]
+				w.printf("%s_bucket%s %d\n", f.name, withMetricLabel(labels, "le", formatMetricValue(bound)), cumulative)
+			}
+			w.printf("%s_bucket%s %d\n", f.name, withMetricLabel(labels, "le", "+Inf"), s.count)
+			w.printf("%s_sum%s %s\n", f.name, labels, formatMetricValue(s.sum))
+			w.printf("%s_count%s %d\n", f.name, labels, s.count)
+		case summaryKind:
+			w.printf("%s_sum%s %s\n", f.name, labels, formatMetricValue(s.sum))
+			w.printf("%s_count%s %d\n", f.name, labels, s.count)
+		}
+		s.mu.Unlock()
+	}
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatMetricLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelValueEscaper.Replace(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func withMetricLabel(labels, name, value string) string {
+	pair := name + `="` + value + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *countingWriter) printf(format string, values ...any) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, values...)
+	w.n += int64(n)
+	w.err = err
+}
+
+// MetricsConfig defines the config for Metrics middleware.
+type MetricsConfig struct {
+	// Registry is where the HTTP metrics are registered.
+	// Optional. Default value is DefaultMetricsRegistry.
+	Registry *MetricsRegistry
+
+	// Namespace prefixes the metric names.
+	// Optional. Default value is "hi".
+	Namespace string
+
+	// Buckets are the latency histogram buckets, in seconds.
+	// Optional. Default value is DefaultMetricsBuckets.
+	Buckets []float64
+
+	// SkipPaths is an url path array which are not measured.
+	// Optional.
+	SkipPaths []string
+}
+
+// Metrics returns a middleware that records per-route HTTP metrics in DefaultMetricsRegistry.
+func Metrics[T IContext]() HandlerFunc[T] {
+	return MetricsWithConfig[T](MetricsConfig{})
+}
+
+// MetricsWithConfig returns a Metrics middleware with config. It records, labelled by method,
+// route template (FullPath) and status class:
+//
+//   - <namespace>_http_requests_total, a counter of the handled requests.
+//   - <namespace>_http_request_duration_seconds, a histogram of the latencies.
+//   - <namespace>_http_response_size_bytes, a summary of the response body sizes.
+//   - <namespace>_http_requests_in_flight, a gauge of the requests being handled (no status).
+//
+// Requests that did not match a route are labelled UnmatchedRoute. Expose the registry with
+// MetricsHandler.
+func MetricsWithConfig[T IContext](conf MetricsConfig) HandlerFunc[T] {
+	reg := conf.Registry
+	if reg == nil {
+		reg = DefaultMetricsRegistry
+	}
+	ns := conf.Namespace
+	if ns == "" {
+		ns = "hi"
+	}
+	requests := reg.Counter(ns+"_http_requests_total",
+		"Total number of HTTP requests handled.", "method", "route", "status")
+	duration := reg.Histogram(ns+"_http_request_duration_seconds",
+		"Latency of the HTTP requests in seconds.", conf.Buckets, "method", "route", "status")
+	size := reg.Summary(ns+"_http_response_size_bytes",
+		"Size of the HTTP response bodies in bytes.", "method", "route", "status")
+	inFlight := reg.Gauge(ns+"_http_requests_in_flight",
+		"Number of HTTP requests being handled.", "method", "route")
+
+	var skip map[string]struct{}
+	if length := len(conf.SkipPaths); length > 0 {
+		skip = make(map[string]struct{}, length)
+		for _, path := range conf.SkipPaths {
+			skip[path] = struct{}{}
+		}
+	}
+
+	return func(c T) {
+		if _, ok := skip[c.Req().URL.Path]; ok {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		method := metricsMethod(c.Req().Method)
+		route := c.GetExecer().FullPath()
+		if route == "" {
+			route = UnmatchedRoute
+		}
+
+		inFlight.Add(1, method, route)
+		defer inFlight.Add(-1, method, route)
+		c.Next()
+
+		status := statusClass(c.Rsp().Status())
+		requests.Inc(method, route, status)
+		duration.Observe(time.Since(start).Seconds(), method, route, status)
+		size.Observe(float64(max(c.Rsp().Size(), 0)), method, route, status)
+	}
+}
+
+// MetricsHandler returns a handler that writes the exposition of reg, DefaultMetricsRegistry
+// if nil.
+//
+//	router.GET("/metrics", hi.MetricsHandler[*hi.Context](nil))
+func MetricsHandler[T IContext](reg *MetricsRegistry) HandlerFunc[T] {
+	if reg == nil {
+		reg = DefaultMetricsRegistry
+	}
+	return WrapH[T](reg)
+}
+
+// metricsMethod folds non-standard methods into "OTHER" to bound the method label.
+func metricsMethod(method string) string {
+	if slices.Contains(anyMethods, method) {
+		return method
+	}
+	return "OTHER"
+}
+
+// statusClass returns the class of a status code, e.g. "2xx".
+func statusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "other"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
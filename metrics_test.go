@@ -0,0 +1,101 @@
+package hi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	reg := NewMetricsRegistry()
+	router := New(&Context{})
+	router.Use(MetricsWithConfig[*Context](MetricsConfig{Registry: reg, Buckets: []float64{1, 10}}))
+	router.GET("/users/:id", func(c *Context) { c.String(http.StatusOK, "hello") })
+	router.GET("/metrics", MetricsHandler[*Context](reg))
+
+	PerformRequest(router, http.MethodGet, "/users/1")
+	PerformRequest(router, http.MethodGet, "/users/2")
+	PerformRequest(router, http.MethodGet, "/nope/1")
+	PerformRequest(router, http.MethodGet, "/nope/2")
+	w := PerformRequest(router, http.MethodGet, "/metrics")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, MetricsContentType, w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	assert.Contains(t, body, "# TYPE hi_http_requests_total counter\n")
+	assert.Contains(t, body, `hi_http_requests_total{method="GET",route="/users/:id",status="2xx"} 2`+"\n")
+	assert.Contains(t, body, `hi_http_requests_total{method="GET",route="<unmatched>",status="4xx"} 2`+"\n")
+	assert.Contains(t, body, `hi_http_request_duration_seconds_bucket{method="GET",route="/users/:id",status="2xx",le="1"} 2`+"\n")
+	assert.Contains(t, body, `hi_http_request_duration_seconds_bucket{method="GET",route="/users/:id",status="2xx",le="+Inf"} 2`+"\n")
+	assert.Contains(t, body, `hi_http_request_duration_seconds_count{method="GET",route="/users/:id",status="2xx"} 2`+"\n")
+	assert.Contains(t, body, `hi_http_response_size_bytes_sum{method="GET",route="/users/:id",status="2xx"} 10`+"\n")
+	assert.Contains(t, body, `hi_http_requests_in_flight{method="GET",route="/users/:id"} 0`+"\n")
+	// the scrape itself is in flight while the exposition is written
+	assert.Contains(t, body, `hi_http_requests_in_flight{method="GET",route="/metrics"} 1`+"\n")
+	assert.NotContains(t, body, "/nope")
+}
+
+func TestMetricsSkipPathsAndMethods(t *testing.T) {
+	reg := NewMetricsRegistry()
+	router := New(&Context{})
+	router.Use(MetricsWithConfig[*Context](MetricsConfig{Registry: reg, Namespace: "app", SkipPaths: []string{"/skip"}}))
+	router.GET("/skip", func(c *Context) {})
+	router.Handle("PURGE", "/cache", func(c *Context) {})
+
+	PerformRequest(router, http.MethodGet, "/skip")
+	PerformRequest(router, "PURGE", "/cache")
+
+	var b strings.Builder
+	_, err := reg.WriteTo(&b)
+	assert.NoError(t, err)
+	assert.NotContains(t, b.String(), "/skip")
+	assert.Contains(t, b.String(), `app_http_requests_total{method="OTHER",route="/cache",status="2xx"} 1`)
+}
+
+func TestMetricsRegistryExposition(t *testing.T) {
+	reg := NewMetricsRegistry()
+	c := reg.Counter("jobs_total", "Jobs done.\nSecond line.", "queue")
+	c.Inc(`a"b\c`)
+	c.Add(2, `a"b\c`)
+	g := reg.Gauge("temperature", "Current temperature.")
+	g.Set(21.5)
+	g.Add(-1)
+	reg.GaugeFunc("answer", "The answer.", func() float64 { return 42 })
+	reg.Summary("payload_bytes", "Payload sizes.").Observe(3)
+
+	w := httptest.NewRecorder()
+	reg.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, "# HELP answer The answer.\n"+
+		"# TYPE answer gauge\n"+
+		"answer 42\n"+
+		"# HELP jobs_total Jobs done.\\nSecond line.\n"+
+		"# TYPE jobs_total counter\n"+
+		`jobs_total{queue="a\"b\\c"} 3`+"\n"+
+		"# HELP payload_bytes Payload sizes.\n"+
+		"# TYPE payload_bytes summary\n"+
+		"payload_bytes_sum 3\n"+
+		"payload_bytes_count 1\n"+
+		"# HELP temperature Current temperature.\n"+
+		"# TYPE temperature gauge\n"+
+		"temperature 20.5\n", w.Body.String())
+
+	assert.Equal(t, c, reg.Counter("jobs_total", "Jobs done.", "queue"))
+	assert.Panics(t, func() { reg.Gauge("jobs_total", "Jobs done.", "queue") })
+	assert.Panics(t, func() { c.Inc() })
+	assert.Panics(t, func() { c.Add(-1, "q") })
+
+	h := reg.Histogram("latency_seconds", "Latency.", []float64{1, 0.1})
+	assert.Equal(t, h, reg.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}))
+	assert.Panics(t, func() { reg.Histogram("latency_seconds", "Latency.", []float64{0.5, 1}) })
+	assert.Panics(t, func() { reg.Histogram("latency_seconds", "Latency.", nil) })
+}
+
+func TestStatusClass(t *testing.T) {
+	assert.Equal(t, "2xx", statusClass(http.StatusNoContent))
+	assert.Equal(t, "5xx", statusClass(http.StatusServiceUnavailable))
+	assert.Equal(t, "other", statusClass(0))
+}
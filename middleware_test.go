@@ -5,13 +5,16 @@
 package hi
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/gin-contrib/sse"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMiddlewareGeneralCase(t *testing.T) {
@@ -251,3 +254,50 @@ func TestMiddlewareWrite(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 	assert.Equal(t, strings.Replace("hola\n<map><foo>bar</foo></map>{\"foo\":\"bar\"}{\"foo\":\"bar\"}event:test\ndata:message\n\n", " ", "", -1), strings.Replace(w.Body.String(), " ", "", -1))
 }
+
+func TestMiddlewareStopsOnCanceledRequest(t *testing.T) {
+	signature := ""
+	ctx, cancel := context.WithCancel(context.Background())
+	var errs errorMsgs
+	router := New(&Context{})
+	router.Use(func(c *Context) {
+		signature += "A"
+		c.Next()
+		errs = c.Errors
+		signature += "B"
+	})
+	router.Use(func(c *Context) {
+		signature += "C"
+		cancel()
+	})
+	router.GET("/", func(c *Context) {
+		signature += "D"
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "ACB", signature)
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], context.Canceled)
+}
+
+func TestMiddlewareContinueOnCancel(t *testing.T) {
+	signature := ""
+	ctx, cancel := context.WithCancel(context.Background())
+	router := New(&Context{})
+	router.ContinueOnCancel = true
+	router.Use(func(c *Context) {
+		signature += "A"
+		cancel()
+	})
+	router.GET("/", func(c *Context) {
+		require.ErrorIs(t, c.Err(), context.Canceled)
+		signature += "B"
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "AB", signature)
+}
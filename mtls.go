@@ -0,0 +1,191 @@
+package hi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// ClientCertIdentityKey is the key the identity of the client certificate is stored under in
+// the context.
+const ClientCertIdentityKey = "client_cert_identity"
+
+// Client certificate errors, recorded in the context errors of the rejected requests.
+var (
+	ErrClientCertMissing      = errors.New("client certificate missing")
+	ErrClientCertNoIdentity   = errors.New("client certificate identity not recognized")
+	ErrClientCertUnauthorized = errors.New("client certificate identity not allowed")
+)
+
+// MutualTLSConfig returns a TLS configuration requesting client certificates with mode,
+// verified against the CA certificates of the PEM files caFiles. Set it to Engine.TLSConfig
+// before calling RunTLS.
+func MutualTLSConfig(mode tls.ClientAuthType, caFiles ...string) (*tls.Config, error) {
+	pool := x509.NewCertPool()
+	for _, file := range caFiles {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no CA certificate found", file)
+		}
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: mode,
+		ClientCAs:  pool,
+	}, nil
+}
+
+// CertIdentityRule maps a verified client certificate to an identity, ok is false if the
+// rule does not apply to cert.
+type CertIdentityRule func(cert *x509.Certificate) (identity string, ok bool)
+
+// CertIdentityFromURI returns the first URI SAN starting with prefix, such as a SPIFFE ID
+// with the prefix "spiffe://example.org/".
+func CertIdentityFromURI(prefix string) CertIdentityRule {
+	return func(cert *x509.Certificate) (string, bool) {
+		for _, uri := range cert.URIs {
+			if id := uri.String(); strings.HasPrefix(id, prefix) {
+				return id, true
+			}
+		}
+		return "", false
+	}
+}
+
+// CertIdentityFromDNS returns the first DNS SAN ending with suffix.
+func CertIdentityFromDNS(suffix string) CertIdentityRule {
+	return func(cert *x509.Certificate) (string, bool) {
+		for _, name := range cert.DNSNames {
+			if strings.HasSuffix(name, suffix) {
+				return name, true
+			}
+		}
+		return "", false
+	}
+}
+
+// CertIdentityFromSubject returns the distinguished name of the subject, such as
+// "CN=billing,O=Example".
+func CertIdentityFromSubject(cert *x509.Certificate) (string, bool) {
+	if len(cert.Subject.Names) == 0 {
+		return "", false
+	}
+	return cert.Subject.String(), true
+}
+
+// ClientCertConfig defines the config for ClientCertAuth middleware.
+type ClientCertConfig struct {
+	// Rules map the certificate to an identity, the first rule applying wins.
+	// Optional. Default value tries the URI SANs, the DNS SANs, then the subject.
+	Rules []CertIdentityRule
+
+	// Allowed are the identities accepted, as path.Match patterns such as
+	// "spiffe://example.org/ns/prod/*". See also RequireClientIdentity.
+	// Optional. Default value accepts every identity.
+	Allowed []string
+
+	// Unauthorized answers the rejected requests, err is ErrClientCertMissing,
+	// ErrClientCertNoIdentity or ErrClientCertUnauthorized.
+	// Optional. Default value aborts with status 401 without a certificate, 403 otherwise.
+	Unauthorized func(c IContext, err error)
+}
+
+// ClientCertAuth returns a mutual TLS authentication middleware mapping the verified client
+// certificate to an identity. The server must verify the client certificates, see
+// MutualTLSConfig: certificates that were not verified against the client CAs are ignored.
+// The identity is stored under ClientCertIdentityKey and AuthUserKey.
+func ClientCertAuth[T IContext](allowed ...string) HandlerFunc[T] {
+	return ClientCertAuthWithConfig[T](ClientCertConfig{Allowed: allowed})
+}
+
+// ClientCertAuthWithConfig returns a ClientCertAuth middleware with config.
+func ClientCertAuthWithConfig[T IContext](conf ClientCertConfig) HandlerFunc[T] {
+	if len(conf.Rules) == 0 {
+		conf.Rules = []CertIdentityRule{CertIdentityFromURI(""), CertIdentityFromDNS(""), CertIdentityFromSubject}
+	}
+	checkIdentityPatterns(conf.Allowed)
+	if conf.Unauthorized == nil {
+		conf.Unauthorized = defaultClientCertUnauthorized
+	}
+
+	return func(c T) {
+		cert := verifiedClientCert(c.Req())
+		if cert == nil {
+			conf.Unauthorized(c, ErrClientCertMissing)
+			return
+		}
+		var identity string
+		ok := false
+		for _, rule := range conf.Rules {
+			if identity, ok = rule(cert); ok {
+				break
+			}
+		}
+		if !ok {
+			conf.Unauthorized(c, ErrClientCertNoIdentity)
+			return
+		}
+		if len(conf.Allowed) > 0 && !matchIdentity(conf.Allowed, identity) {
+			conf.Unauthorized(c, ErrClientCertUnauthorized)
+			return
+		}
+		c.Set(ClientCertIdentityKey, identity)
+		c.Set(AuthUserKey, identity)
+	}
+}
+
+// RequireClientIdentity returns a middleware rejecting with 403 the requests whose client
+// certificate identity matches none of the path.Match patterns allowed. Attach it to the
+// groups behind ClientCertAuth to restrict them to some services.
+func RequireClientIdentity[T IContext](allowed ...string) HandlerFunc[T] {
+	assert1(len(allowed) > 0, "allowed identities can not be empty")
+	checkIdentityPatterns(allowed)
+	return func(c T) {
+		identity, _ := c.GetKeys()[ClientCertIdentityKey].(string)
+		if identity == "" || !matchIdentity(allowed, identity) {
+			defaultClientCertUnauthorized(c, ErrClientCertUnauthorized)
+		}
+	}
+}
+
+// verifiedClientCert returns the leaf of the first verified chain of the client, nil if the
+// client sent no certificate or it was not verified.
+func verifiedClientCert(req *http.Request) *x509.Certificate {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return req.TLS.VerifiedChains[0][0]
+}
+
+func checkIdentityPatterns(patterns []string) {
+	for _, pattern := range patterns {
+		_, err := path.Match(pattern, "")
+		assert1(err == nil, "invalid identity pattern "+pattern)
+	}
+}
+
+func matchIdentity(patterns []string, identity string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, identity); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func defaultClientCertUnauthorized(c IContext, err error) {
+	_ = c.Error(err)
+	if err == ErrClientCertMissing {
+		c.GetExecer().AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	c.GetExecer().AbortWithStatus(http.StatusForbidden)
+}
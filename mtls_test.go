@@ -0,0 +1,184 @@
+package hi
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, parent *testCert, template *x509.Certificate) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key}
+}
+
+func newTestCA(t *testing.T) *testCert {
+	return newTestCert(t, nil, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+}
+
+func newTestClientCert(t *testing.T, ca *testCert, cn string, uris ...string) *testCert {
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn, Organization: []string{"Example"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		require.NoError(t, err)
+		template.URIs = append(template.URIs, u)
+	}
+	return newTestCert(t, ca, template)
+}
+
+func clientCertRequest(method, target string, chain ...*testCert) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	req.TLS = &tls.ConnectionState{}
+	if len(chain) > 0 {
+		verified := make([]*x509.Certificate, len(chain))
+		for i, c := range chain {
+			verified[i] = c.cert
+		}
+		req.TLS.PeerCertificates = verified
+		req.TLS.VerifiedChains = [][]*x509.Certificate{verified}
+	}
+	return req
+}
+
+func TestClientCertAuth(t *testing.T) {
+	ca := newTestCA(t)
+	billing := newTestClientCert(t, ca, "billing", "spiffe://example.org/ns/prod/billing")
+	batch := newTestClientCert(t, ca, "batch", "spiffe://example.org/ns/dev/batch")
+	legacy := newTestClientCert(t, ca, "legacy")
+
+	router := New(&Context{})
+	router.Use(ClientCertAuth[*Context]())
+	handler := func(c *Context) { c.String(http.StatusOK, c.GetKeys()[ClientCertIdentityKey].(string)) }
+	router.GET("/", handler)
+	prod := router.Group("/prod", RequireClientIdentity[*Context]("spiffe://example.org/ns/prod/*"))
+	prod.GET("", handler)
+
+	for _, tc := range []struct {
+		cert   *testCert
+		target string
+		status int
+		body   string
+	}{
+		{billing, "/", http.StatusOK, "spiffe://example.org/ns/prod/billing"},
+		{billing, "/prod", http.StatusOK, "spiffe://example.org/ns/prod/billing"},
+		{batch, "/", http.StatusOK, "spiffe://example.org/ns/dev/batch"},
+		{batch, "/prod", http.StatusForbidden, ""},
+		{legacy, "/", http.StatusOK, "CN=legacy,O=Example"},
+		{nil, "/", http.StatusUnauthorized, ""},
+	} {
+		var req *http.Request
+		if tc.cert == nil {
+			req = clientCertRequest(http.MethodGet, tc.target)
+		} else {
+			req = clientCertRequest(http.MethodGet, tc.target, tc.cert, ca)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tc.status, w.Code, tc.target)
+		if tc.body != "" {
+			assert.Equal(t, tc.body, w.Body.String())
+		}
+	}
+
+	// a certificate sent but not verified is ignored
+	req := clientCertRequest(http.MethodGet, "/", billing, ca)
+	req.TLS.VerifiedChains = nil
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestClientCertAuthRules(t *testing.T) {
+	ca := newTestCA(t)
+	cert := newTestClientCert(t, ca, "billing", "https://example.org/billing")
+
+	router := New(&Context{})
+	router.Use(ClientCertAuthWithConfig[*Context](ClientCertConfig{
+		Rules:   []CertIdentityRule{CertIdentityFromURI("spiffe://")},
+		Allowed: []string{"spiffe://example.org/*"},
+	}))
+	router.GET("/", func(c *Context) {})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, clientCertRequest(http.MethodGet, "/", cert, ca))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	assert.Panics(t, func() { ClientCertAuth[*Context]("[") })
+	assert.Panics(t, func() { RequireClientIdentity[*Context]() })
+}
+
+func TestMutualTLSConfig(t *testing.T) {
+	ca := newTestCA(t)
+	client := newTestClientCert(t, ca, "billing", "spiffe://example.org/billing")
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0o600))
+
+	conf, err := MutualTLSConfig(tls.RequireAndVerifyClientCert, caFile)
+	require.NoError(t, err)
+	_, err = MutualTLSConfig(tls.RequireAndVerifyClientCert, filepath.Join(t.TempDir(), "missing.pem"))
+	assert.Error(t, err)
+
+	router := New(&Context{})
+	router.TLSConfig = conf
+	assert.Same(t, conf.ClientCAs, router.newServer(":0").TLSConfig.ClientCAs)
+
+	router.Use(ClientCertAuth[*Context]())
+	router.GET("/", func(c *Context) { c.String(http.StatusOK, c.GetKeys()[AuthUserKey].(string)) })
+	srv := httptest.NewUnstartedServer(router)
+	srv.TLS = conf
+	srv.StartTLS()
+	defer srv.Close()
+
+	transport := srv.Client().Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{client.cert.Raw}, PrivateKey: client.key}}
+	resp, err := (&http.Client{Transport: transport}).Get(srv.URL)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "spiffe://example.org/billing", string(body))
+
+	// the handshake fails without a client certificate
+	_, err = srv.Client().Get(srv.URL)
+	assert.Error(t, err)
+}
@@ -0,0 +1,316 @@
+package hi
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnsupportedHash is returned for password hashes of an unknown format.
+var ErrUnsupportedHash = errors.New("unsupported password hash")
+
+// Verifier checks a user name and password, returning the identity of the user when they
+// are valid. Verifiers must take about the same time whether the user exists or not.
+type Verifier func(user, pass string) (identity any, ok bool)
+
+// ComparePasswordHash reports whether password matches encoded, a bcrypt ($2a$, $2b$, $2y$),
+// argon2 ($argon2id$, $argon2i$, in the PHC format) or SHA-crypt ($5$, $6$) hash. The weak
+// Apache apr1-MD5 ($apr1$) and {SHA} hashes of htpasswd -m and -s are also accepted, for
+// existing files.
+func ComparePasswordHash(encoded, password string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return err == nil, err
+	case strings.HasPrefix(encoded, "$argon2"):
+		return compareArgon2(encoded, password)
+	case strings.HasPrefix(encoded, "$5$"), strings.HasPrefix(encoded, "$6$"):
+		computed, err := shaCrypt(password, encoded)
+		if err != nil {
+			return false, err
+		}
+		return subtle.ConstantTimeCompare([]byte(computed), []byte(encoded)) == 1, nil
+	case strings.HasPrefix(encoded, "$apr1$"):
+		computed := apr1Crypt(password, encoded)
+		return subtle.ConstantTimeCompare([]byte(computed), []byte(encoded)) == 1, nil
+	case strings.HasPrefix(encoded, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		computed := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(computed), []byte(encoded)) == 1, nil
+	}
+	return false, ErrUnsupportedHash
+}
+
+// checkPasswordHash reports an error if encoded is not of a supported format.
+func checkPasswordHash(encoded string) error {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$", "$argon2id$", "$argon2i$", "$5$", "$6$", "$apr1$", "{SHA}"} {
+		if strings.HasPrefix(encoded, prefix) {
+			return nil
+		}
+	}
+	return ErrUnsupportedHash
+}
+
+// HashVerifier returns a Verifier checking passwords against hashes, a map of user names to
+// password hashes in a format supported by ComparePasswordHash. The identity is the user name.
+func HashVerifier(hashes map[string]string) Verifier {
+	assert1(len(hashes) > 0, "Empty list of authorized credentials")
+	var dummy string
+	for user, encoded := range hashes {
+		assert1(user != "", "User can not be empty")
+		if err := checkPasswordHash(encoded); err != nil {
+			panic(fmt.Sprintf("invalid password hash of user %q: %v", user, err))
+		}
+		dummy = encoded
+	}
+	return func(user, pass string) (any, bool) {
+		encoded, found := hashes[user]
+		if !found {
+			// hash anyway, so that unknown users are not told apart by timing
+			encoded = dummy
+		}
+		ok, _ := ComparePasswordHash(encoded, pass)
+		return user, ok && found
+	}
+}
+
+// compareArgon2 checks password against a $argon2id$v=19$m=65536,t=3,p=4$salt$key hash.
+func compareArgon2(encoded, password string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[2] != "v=19" {
+		return false, ErrUnsupportedHash
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, ErrUnsupportedHash
+	}
+	salt, err1 := base64.RawStdEncoding.DecodeString(parts[4])
+	key, err2 := base64.RawStdEncoding.DecodeString(parts[5])
+	if errors.Join(err1, err2) != nil || len(key) == 0 || time == 0 || threads == 0 {
+		return false, ErrUnsupportedHash
+	}
+
+	var computed []byte
+	switch parts[1] {
+	case "argon2id":
+		computed = argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	case "argon2i":
+		computed = argon2.Key([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	default:
+		return false, ErrUnsupportedHash
+	}
+	return subtle.ConstantTimeCompare(computed, key) == 1, nil
+}
+
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// byte order of the encoding of the SHA-crypt digests, in groups of three
+var (
+	sha256CryptOrder = []int{0, 10, 20, 21, 1, 11, 12, 22, 2, 3, 13, 23, 24, 4, 14, 15, 25, 5, 6, 16, 26, 27, 7, 17, 18, 28, 8, 9, 19, 29}
+	sha512CryptOrder = []int{
+		0, 21, 42, 22, 43, 1, 44, 2, 23, 3, 24, 45, 25, 46, 4, 47, 5, 26, 6, 27, 48, 28, 49, 7, 50, 8, 29,
+		9, 30, 51, 31, 52, 10, 53, 11, 32, 12, 33, 54, 34, 55, 13, 56, 14, 35, 15, 36, 57, 37, 58, 16,
+		59, 17, 38, 18, 39, 60, 40, 61, 19, 62, 20, 41,
+	}
+)
+
+// shaCrypt hashes password with the parameters of setting, a SHA-crypt hash or salt string,
+// as specified in https://www.akkadia.org/drepper/SHA-crypt.txt.
+func shaCrypt(password, setting string) (string, error) {
+	var newHash func() hash.Hash
+	var order []int
+	prefix := setting[:3]
+	switch prefix {
+	case "$5$":
+		newHash, order = sha256.New, sha256CryptOrder
+	case "$6$":
+		newHash, order = sha512.New, sha512CryptOrder
+	default:
+		return "", ErrUnsupportedHash
+	}
+
+	params := setting[3:]
+	rounds, customRounds := 5000, false
+	if rest, ok := strings.CutPrefix(params, "rounds="); ok {
+		n, after, found := strings.Cut(rest, "$")
+		r, err := strconv.Atoi(n)
+		if !found || err != nil {
+			return "", ErrUnsupportedHash
+		}
+		rounds, customRounds, params = min(max(r, 1000), 999999999), true, after
+	}
+	salt, _, _ := strings.Cut(params, "$")
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+	pass, s := []byte(password), []byte(salt)
+
+	h := newHash()
+	h.Write(pass)
+	h.Write(s)
+	h.Write(pass)
+	b := h.Sum(nil)
+
+	h.Reset()
+	h.Write(pass)
+	h.Write(s)
+	for n := len(pass); n > 0; n -= len(b) {
+		h.Write(b[:min(n, len(b))])
+	}
+	for n := len(pass); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			h.Write(b)
+		} else {
+			h.Write(pass)
+		}
+	}
+	a := h.Sum(nil)
+
+	h.Reset()
+	for range pass {
+		h.Write(pass)
+	}
+	p := repeatBytes(h.Sum(nil), len(pass))
+
+	h.Reset()
+	for i := 0; i < 16+int(a[0]); i++ {
+		h.Write(s)
+	}
+	sp := repeatBytes(h.Sum(nil), len(s))
+
+	c := a
+	for i := 0; i < rounds; i++ {
+		h.Reset()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(sp)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(c[:0])
+	}
+
+	var out strings.Builder
+	out.WriteString(prefix)
+	if customRounds {
+		fmt.Fprintf(&out, "rounds=%d$", rounds)
+	}
+	out.WriteString(salt)
+	out.WriteByte('$')
+	for i := 0; i < len(order); i += 3 {
+		cryptBase64(&out, uint(c[order[i]])<<16|uint(c[order[i+1]])<<8|uint(c[order[i+2]]), 4)
+	}
+	if len(c) == sha256.Size {
+		cryptBase64(&out, uint(c[31])<<8|uint(c[30]), 3)
+	} else {
+		cryptBase64(&out, uint(c[63]), 2)
+	}
+	return out.String(), nil
+}
+
+// apr1CryptOrder is the byte order of the encoding of the apr1-MD5 digests, in groups of three.
+var apr1CryptOrder = []int{0, 6, 12, 1, 7, 13, 2, 8, 14, 3, 9, 15, 4, 10, 5}
+
+// apr1Crypt hashes password with the salt of setting, an apr1-MD5 hash or salt string, as
+// done by Apache htpasswd -m.
+func apr1Crypt(password, setting string) string {
+	const magic = "$apr1$"
+	salt, _, _ := strings.Cut(strings.TrimPrefix(setting, magic), "$")
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pass, s := []byte(password), []byte(salt)
+
+	h := md5.New()
+	h.Write(pass)
+	h.Write(s)
+	h.Write(pass)
+	b := h.Sum(nil)
+
+	h.Reset()
+	h.Write(pass)
+	h.Write([]byte(magic))
+	h.Write(s)
+	for n := len(pass); n > 0; n -= len(b) {
+		h.Write(b[:min(n, len(b))])
+	}
+	for n := len(pass); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(pass[:1])
+		}
+	}
+	c := h.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		h.Reset()
+		if i&1 != 0 {
+			h.Write(pass)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(pass)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(pass)
+		}
+		c = h.Sum(c[:0])
+	}
+
+	var out strings.Builder
+	out.WriteString(magic)
+	out.WriteString(salt)
+	out.WriteByte('$')
+	for i := 0; i < len(apr1CryptOrder); i += 3 {
+		cryptBase64(&out, uint(c[apr1CryptOrder[i]])<<16|uint(c[apr1CryptOrder[i+1]])<<8|uint(c[apr1CryptOrder[i+2]]), 4)
+	}
+	cryptBase64(&out, uint(c[11]), 2)
+	return out.String()
+}
+
+func repeatBytes(digest []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		out = append(out, digest[:min(n-len(out), len(digest))]...)
+	}
+	return out
+}
+
+func cryptBase64(out *strings.Builder, v uint, n int) {
+	for ; n > 0; n-- {
+		out.WriteByte(cryptAlphabet[v&0x3f])
+		v >>= 6
+	}
+}
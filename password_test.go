@@ -0,0 +1,73 @@
+package hi
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func argon2idHash(password, salt string) string {
+	key := argon2.IDKey([]byte(password), []byte(salt), 1, 1024, 1, 32)
+	return fmt.Sprintf("$argon2id$v=19$m=1024,t=1,p=1$%s$%s",
+		base64.RawStdEncoding.EncodeToString([]byte(salt)), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestShaCrypt(t *testing.T) {
+	for _, tc := range []struct{ setting, want string }{
+		{"$5$saltstring", "$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5"},
+		{"$6$saltstring", "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"},
+		{"$5$rounds=10000$saltstringsaltstring", "$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA"},
+	} {
+		got, err := shaCrypt("Hello world!", tc.setting)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, got)
+	}
+}
+
+func TestComparePasswordHash(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	for _, encoded := range []string{
+		string(bcryptHash),
+		argon2idHash("secret", "somesalt"),
+		"$5$saltstring$C3o4O1TC6aRHF4FI.QSZMXtHbaj2gSXr4sUc/3NcUi.",
+		"$6$saltstring$AIsRs/Ee56G/tC8MEHhvReZTfx8u3rXXMl6eYrjCG9ibix19DxoMBLogdTET5Ukw9Sf7eZTITsuk0Ry5qulYz.",
+		"$apr1$Cz1bSKeU$Fd8lc1diEty36H7y05wCd0",
+		"{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=",
+	} {
+		ok, err := ComparePasswordHash(encoded, "secret")
+		require.NoError(t, err, encoded)
+		assert.True(t, ok, encoded)
+
+		ok, err = ComparePasswordHash(encoded, "wrong")
+		require.NoError(t, err, encoded)
+		assert.False(t, ok, encoded)
+	}
+
+	_, err = ComparePasswordHash("secret", "secret")
+	assert.ErrorIs(t, err, ErrUnsupportedHash)
+	_, err = ComparePasswordHash("$argon2id$v=19$bad", "secret")
+	assert.ErrorIs(t, err, ErrUnsupportedHash)
+}
+
+func TestHashVerifier(t *testing.T) {
+	verify := HashVerifier(map[string]string{"admin": argon2idHash("secret", "somesalt")})
+
+	identity, ok := verify("admin", "secret")
+	assert.True(t, ok)
+	assert.Equal(t, "admin", identity)
+
+	_, ok = verify("admin", "wrong")
+	assert.False(t, ok)
+	_, ok = verify("nobody", "secret")
+	assert.False(t, ok)
+
+	assert.Panics(t, func() { HashVerifier(map[string]string{}) })
+	assert.Panics(t, func() { HashVerifier(map[string]string{"admin": "plaintext"}) })
+}
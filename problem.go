@@ -0,0 +1,287 @@
+package hi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+
+	"github.com/nbcx/hi/internal/json"
+	"github.com/nbcx/hi/render"
+)
+
+// MIMEProblemJSON is the media type of RFC 9457 problem details documents.
+const MIMEProblemJSON = "application/problem+json"
+
+// ProblemTypeBlank is the default problem type, meaning the problem has no
+// additional semantics beyond those of the HTTP status code.
+const ProblemTypeBlank = "about:blank"
+
+// Problem is an RFC 9457 problem details object. Extensions are serialized as
+// additional top-level members next to the standard ones.
+type Problem struct {
+	// Type is a URI reference that identifies the problem type.
+	Type string
+	// Title is a short, human-readable summary of the problem type.
+	Title string
+	// Status is the HTTP status code generated by the origin server.
+	Status int
+	// Detail is a human-readable explanation specific to this occurrence.
+	Detail string
+	// Instance is a URI reference that identifies this occurrence.
+	Instance string
+	// Extensions are additional members of the problem details object.
+	Extensions map[string]any
+}
+
+var _ error = (*Problem)(nil)
+
+// NewProblem returns an "about:blank" problem for the given status code, titled after it.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Type:   ProblemTypeBlank,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// With sets the extension member key to value.
+func (p *Problem) With(key string, value any) *Problem {
+	if p.Extensions == nil {
+		p.Extensions = make(map[string]any)
+	}
+	p.Extensions[key] = value
+	return p
+}
+
+// Error implements the error interface.
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Title + ": " + p.Detail
+	}
+	return p.Title
+}
+
+// MarshalJSON implements the json.Marshaller interface.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	data := make(map[string]any, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		data[k] = v
+	}
+	if p.Type != "" {
+		data["type"] = p.Type
+	}
+	if p.Title != "" {
+		data["title"] = p.Title
+	}
+	if p.Status != 0 {
+		data["status"] = p.Status
+	}
+	if p.Detail != "" {
+		data["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		data["instance"] = p.Instance
+	}
+	return json.Marshal(data)
+}
+
+// ProblemType describes the problem an error is rendered as. Empty fields are
+// derived from Status.
+type ProblemType struct {
+	Type   string
+	Title  string
+	Status int
+	// Public exposes the error message as the problem detail.
+	Public bool
+}
+
+type problemMatcher struct {
+	match func(err error) bool
+	typ   ProblemType
+}
+
+var problemRegistry = struct {
+	sync.RWMutex
+	byErrorType []problemErrorType
+	byGoType    []problemMatcher
+}{
+	byErrorType: []problemErrorType{
+		{ErrorTypeBind, ProblemType{Status: http.StatusBadRequest, Public: true}},
+		{ErrorTypeRender, ProblemType{Status: http.StatusInternalServerError}},
+		{ErrorTypePublic, ProblemType{Status: http.StatusInternalServerError, Public: true}},
+	},
+}
+
+type problemErrorType struct {
+	flags ErrorType
+	typ   ProblemType
+}
+
+// RegisterProblemErrorType maps errors of the given ErrorType to a problem type. It overrides the
+// defaults for ErrorTypeBind, ErrorTypeRender and ErrorTypePublic.
+func RegisterProblemErrorType(flags ErrorType, typ ProblemType) {
+	problemRegistry.Lock()
+	defer problemRegistry.Unlock()
+	for i, entry := range problemRegistry.byErrorType {
+		if entry.flags == flags {
+			problemRegistry.byErrorType[i].typ = typ
+			return
+		}
+	}
+	problemRegistry.byErrorType = append(problemRegistry.byErrorType, problemErrorType{flags, typ})
+}
+
+// RegisterProblem maps errors whose chain contains an E (see errors.As) to a problem type.
+// Go error types take precedence over ErrorType mappings, the first registration wins.
+//
+//	hi.RegisterProblem[*NotFoundError](hi.ProblemType{
+//		Type:   "https://example.com/probs/not-found",
+//		Status: http.StatusNotFound,
+//		Public: true,
+//	})
+func RegisterProblem[E error](typ ProblemType) {
+	assert1(reflect.TypeFor[E]().Kind() != reflect.Interface, "problem error type must be a concrete type")
+	problemRegistry.Lock()
+	defer problemRegistry.Unlock()
+	problemRegistry.byGoType = append(problemRegistry.byGoType, problemMatcher{
+		match: func(err error) bool {
+			var target E
+			return errors.As(err, &target)
+		},
+		typ: typ,
+	})
+}
+
+// ProblemFromError returns the problem details err is rendered as. A *Problem in the chain is
+// returned as is, registered Go error types are looked up next, then the ErrorType of an *Error.
+// Anything else is a 500 whose detail is not disclosed. The Meta of an *Error is carried as
+// extension members.
+func ProblemFromError(err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+
+	typ, ok := lookupProblemType(err)
+	if !ok {
+		typ = ProblemType{Status: http.StatusInternalServerError}
+	}
+	if typ.Status == 0 {
+		typ.Status = http.StatusInternalServerError
+	}
+	p = NewProblem(typ.Status, "")
+	if typ.Type != "" {
+		p.Type = typ.Type
+	}
+	if typ.Title != "" {
+		p.Title = typ.Title
+	}
+	if typ.Public {
+		p.Detail = err.Error()
+	}
+
+	var e *Error
+	if errors.As(err, &e) && e.Meta != nil {
+		value := reflect.ValueOf(e.Meta)
+		if value.Kind() == reflect.Map && value.Type().Key().Kind() == reflect.String {
+			for _, key := range value.MapKeys() {
+				p.With(key.String(), value.MapIndex(key).Interface())
+			}
+		} else {
+			p.With("meta", e.Meta)
+		}
+	}
+	return p
+}
+
+func lookupProblemType(err error) (ProblemType, bool) {
+	problemRegistry.RLock()
+	defer problemRegistry.RUnlock()
+	for _, m := range problemRegistry.byGoType {
+		if m.match(err) {
+			return m.typ, true
+		}
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		return ProblemType{}, false
+	}
+	for _, entry := range problemRegistry.byErrorType {
+		if e.IsType(entry.flags) {
+			return entry.typ, true
+		}
+	}
+	return ProblemType{}, false
+}
+
+// Problem returns the problem details the error is rendered as. See ProblemFromError.
+func (msg *Error) Problem() *Problem {
+	return ProblemFromError(msg)
+}
+
+// AbortWithProblem calls `Abort()` and renders p as an RFC 9457 problem details document, using
+// p.Status as the status code. The request ID, if any, is added as the "request_id" member.
+func (c *Context) AbortWithProblem(p *Problem) {
+	c.Abort()
+	c.Render(p.Status, render.ProblemJSON{Data: withRequestID(c, p)})
+}
+
+// AbortWithErrorProblem pushes err to `c.Errors`, then aborts with the problem details err maps
+// to. See ProblemFromError.
+func (c *Context) AbortWithErrorProblem(err error) *Error {
+	parsed := c.Error(err)
+	c.AbortWithProblem(parsed.Problem())
+	return parsed
+}
+
+// withRequestID returns a copy of p carrying the request ID of c as the
+// "request_id" extension member, or p itself if there is none.
+func withRequestID(c IContext, p *Problem) *Problem {
+	id := GetRequestID(c)
+	if id == "" {
+		return p
+	}
+	cp := *p
+	cp.Extensions = make(map[string]any, len(p.Extensions)+1)
+	for k, v := range p.Extensions {
+		cp.Extensions[k] = v
+	}
+	cp.Extensions[RequestIDKey] = id
+	return &cp
+}
+
+// abortWithProblem renders p for any IContext.
+func abortWithProblem[T IContext](c T, p *Problem) {
+	p = withRequestID(c, p)
+	exec := c.GetExecer()
+	exec.Abort()
+	exec.WriterMem().WriteHeader(p.Status)
+	if err := (render.ProblemJSON{Data: p}).Render(c.Rsp()); err != nil {
+		debugPrint("cannot write problem details: %v", err)
+	}
+}
+
+// acceptsProblem reports whether the request explicitly accepts problem details documents.
+func acceptsProblem(req *http.Request) bool {
+	for _, accepted := range parseAccept(req.Header.Get("Accept")) {
+		if accepted == MIMEProblemJSON {
+			return true
+		}
+	}
+	return false
+}
+
+// ProblemRecovery returns a middleware that recovers from any panics and answers with a 500
+// problem details document. The panic value is only disclosed as detail in debug mode.
+func ProblemRecovery[T IContext]() HandlerFunc[T] {
+	return CustomRecovery[T](func(c T, err any) {
+		p := NewProblem(http.StatusInternalServerError, "")
+		if IsDebugging() {
+			p.Detail = fmt.Sprint(err)
+		}
+		abortWithProblem(c, p)
+	})
+}
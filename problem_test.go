@@ -0,0 +1,130 @@
+package hi
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/nbcx/hi/internal/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testProblemError struct {
+	id string
+}
+
+func (e *testProblemError) Error() string {
+	return "item " + e.id + " not found"
+}
+
+func TestProblemMarshalJSON(t *testing.T) {
+	p := NewProblem(http.StatusForbidden, "not enough credit").With("balance", 30).With("title", "ignored")
+	p.Instance = "/account/12345/msgs/abc"
+
+	jsonBytes, err := json.Marshal(p)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "about:blank",
+		"title": "Forbidden",
+		"status": 403,
+		"detail": "not enough credit",
+		"instance": "/account/12345/msgs/abc",
+		"balance": 30
+	}`, string(jsonBytes))
+	assert.Equal(t, "Forbidden: not enough credit", p.Error())
+	assert.Equal(t, "Forbidden", NewProblem(http.StatusForbidden, "").Error())
+}
+
+func TestProblemFromError(t *testing.T) {
+	p := ProblemFromError(errors.New("secret"))
+	assert.Equal(t, http.StatusInternalServerError, p.Status)
+	assert.Empty(t, p.Detail)
+
+	p = (&Error{Err: errors.New("bad input"), Type: ErrorTypeBind, Meta: H{"field": "name"}}).Problem()
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, "Bad Request", p.Title)
+	assert.Equal(t, "bad input", p.Detail)
+	assert.Equal(t, "name", p.Extensions["field"])
+
+	p = (&Error{Err: errors.New("secret"), Type: ErrorTypePrivate, Meta: 42}).Problem()
+	assert.Equal(t, http.StatusInternalServerError, p.Status)
+	assert.Empty(t, p.Detail)
+	assert.Equal(t, 42, p.Extensions["meta"])
+
+	own := NewProblem(http.StatusConflict, "")
+	assert.Same(t, own, ProblemFromError(&Error{Err: own}))
+}
+
+func TestRegisterProblem(t *testing.T) {
+	RegisterProblem[*testProblemError](ProblemType{
+		Type:   "https://example.com/probs/not-found",
+		Status: http.StatusNotFound,
+		Public: true,
+	})
+	RegisterProblemErrorType(ErrorTypeNu, ProblemType{Status: http.StatusTeapot, Title: "Teapot"})
+
+	p := ProblemFromError(&Error{Err: &testProblemError{id: "7"}, Type: ErrorTypePrivate})
+	assert.Equal(t, "https://example.com/probs/not-found", p.Type)
+	assert.Equal(t, http.StatusNotFound, p.Status)
+	assert.Equal(t, "Not Found", p.Title)
+	assert.Equal(t, "item 7 not found", p.Detail)
+
+	p = ProblemFromError(&Error{Err: errors.New("short and stout"), Type: ErrorTypeNu})
+	assert.Equal(t, http.StatusTeapot, p.Status)
+	assert.Equal(t, "Teapot", p.Title)
+
+	assert.Panics(t, func() { RegisterProblem[error](ProblemType{}) })
+}
+
+func TestContextAbortWithProblem(t *testing.T) {
+	router := New(&Context{})
+	router.GET("/problem", func(c *Context) {
+		c.AbortWithProblem(NewProblem(http.StatusUnprocessableEntity, "invalid"))
+	})
+	router.GET("/error", func(c *Context) {
+		c.AbortWithErrorProblem(&Error{Err: errors.New("invalid name"), Type: ErrorTypeBind}) //nolint: errcheck
+	})
+
+	w := PerformRequest(router, http.MethodGet, "/problem")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, MIMEProblemJSON, w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"type":"about:blank","title":"Unprocessable Entity","status":422,"detail":"invalid"}`, w.Body.String())
+
+	w = PerformRequest(router, http.MethodGet, "/error")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"type":"about:blank","title":"Bad Request","status":400,"detail":"invalid name"}`, w.Body.String())
+}
+
+func TestProblemRecovery(t *testing.T) {
+	router := New(&Context{})
+	router.Use(ProblemRecovery[*Context]())
+	router.GET("/", func(c *Context) {
+		panic(errors.New("oops"))
+	})
+
+	w := PerformRequest(router, http.MethodGet, "/")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, MIMEProblemJSON, w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"type":"about:blank","title":"Internal Server Error","status":500}`, w.Body.String())
+}
+
+func TestProblemNoRouteNegotiation(t *testing.T) {
+	router := New(&Context{})
+	router.HandleMethodNotAllowed = true
+	router.POST("/path", func(c *Context) {})
+
+	w := PerformRequest(router, http.MethodGet, "/missing")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, string(default404Body), w.Body.String())
+
+	w = PerformRequest(router, http.MethodGet, "/missing", header{"Accept", "application/problem+json, application/json;q=0.9"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, MIMEProblemJSON, w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"type":"about:blank","title":"Not Found","status":404}`, w.Body.String())
+
+	w = PerformRequest(router, http.MethodGet, "/path", header{"Accept", MIMEProblemJSON})
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "POST", w.Header().Get("Allow"))
+	assert.JSONEq(t, `{"type":"about:blank","title":"Method Not Allowed","status":405}`, w.Body.String())
+}
@@ -0,0 +1,334 @@
+package hi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// IETF RateLimit header fields (draft-ietf-httpapi-ratelimit-headers).
+const (
+	RateLimitHeader       = "RateLimit"
+	RateLimitPolicyHeader = "RateLimit-Policy"
+)
+
+// ErrRateLimited is recorded in the context errors of the requests rejected by RateLimit.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimitAlgorithm selects how a RateLimitPolicy is enforced.
+type RateLimitAlgorithm uint8
+
+const (
+	// TokenBucket refills Limit tokens per Window, up to Burst, and lets requests through while
+	// tokens are left. It allows bursts and smooths the rate over time.
+	TokenBucket RateLimitAlgorithm = iota
+	// SlidingWindow counts the requests over the last Window, weighting the previous fixed
+	// window by its overlap with the sliding one.
+	SlidingWindow
+)
+
+// RateLimitPolicy is a quota of requests per time window.
+type RateLimitPolicy struct {
+	// Name identifies the policy in the headers and its keys in a shared store.
+	// Optional. Default value is "default".
+	Name string
+	// Algorithm enforces the quota.
+	// Optional. Default value is TokenBucket.
+	Algorithm RateLimitAlgorithm
+	// Limit is the number of requests allowed per Window.
+	Limit int
+	// Window is the period of the quota.
+	Window time.Duration
+	// Burst is the capacity of the token bucket.
+	// Optional. Default value is Limit.
+	Burst int
+}
+
+func (p RateLimitPolicy) burst() int {
+	if p.Burst > 0 {
+		return p.Burst
+	}
+	return p.Limit
+}
+
+// RateLimitResult is the outcome of taking a request from a quota.
+type RateLimitResult struct {
+	// Allowed reports whether the request is within the quota.
+	Allowed bool
+	// Limit is the quota of the policy.
+	Limit int
+	// Remaining is the number of requests left in the quota.
+	Remaining int
+	// Reset is the time until the quota is fully restored.
+	Reset time.Duration
+	// RetryAfter is the time until a request is allowed again, when not Allowed.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore holds the state of the quotas. Implementations backed by a shared database
+// make the limits distributed; Take must then be atomic.
+type RateLimitStore interface {
+	// Take takes one request from the quota of key under policy.
+	Take(ctx context.Context, key string, policy RateLimitPolicy) (RateLimitResult, error)
+}
+
+// RateLimitKeyFunc returns the key a request is accounted under.
+type RateLimitKeyFunc func(c IContext) string
+
+// RateLimitByIP accounts requests by client IP, the address of the connection unless it comes
+// from one of the Engine.SetTrustedProxies, whose X-Forwarded-For or X-Real-IP is used then.
+func RateLimitByIP(c IContext) string {
+	return "ip:" + clientIP(c, defaultRemoteIPHeaders)
+}
+
+// RateLimitByUser accounts requests by the authenticated user stored under AuthUserKey,
+// falling back to the client IP for anonymous requests.
+func RateLimitByUser(c IContext) string {
+	if user, ok := c.GetKeys()[AuthUserKey]; ok && user != nil {
+		return "user:" + fmt.Sprint(user)
+	}
+	return RateLimitByIP(c)
+}
+
+// RateLimitByHeader returns a RateLimitKeyFunc accounting requests by the value of a header,
+// typically an API key, falling back to the client IP when it is missing.
+func RateLimitByHeader(name string) RateLimitKeyFunc {
+	return func(c IContext) string {
+		if value := c.Req().Header.Get(name); value != "" {
+			return "header:" + value
+		}
+		return RateLimitByIP(c)
+	}
+}
+
+// RateLimitByRoute accounts the requests of every client together, per route template.
+func RateLimitByRoute(c IContext) string {
+	return "route:" + c.Req().Method + " " + c.GetExecer().FullPath()
+}
+
+// RateLimitConfig defines the config for RateLimit middleware.
+type RateLimitConfig struct {
+	// Policy is the quota enforced. Limit and Window are required.
+	Policy RateLimitPolicy
+
+	// Store holds the state of the quotas.
+	// Optional. Default value is a new in-memory store, see NewMemoryRateLimitStore.
+	Store RateLimitStore
+
+	// Key returns the key a request is accounted under.
+	// Optional. Default value is RateLimitByIP.
+	Key RateLimitKeyFunc
+
+	// LimitReached answers the rejected requests.
+	// Optional. Default value aborts with status 429.
+	LimitReached func(c IContext, result RateLimitResult)
+
+	// Skip is a Skipper that indicates which requests are not limited.
+	// Optional.
+	Skip Skipper
+}
+
+// RateLimit returns a middleware allowing limit requests per window and client IP, with a
+// token bucket. Attach it to a RouterGroup to limit the routes of the group.
+func RateLimit[T IContext](limit int, window time.Duration) HandlerFunc[T] {
+	return RateLimitWithConfig[T](RateLimitConfig{Policy: RateLimitPolicy{Limit: limit, Window: window}})
+}
+
+// RateLimitWithConfig returns a RateLimit middleware with config.
+//
+// Every limited response carries the RateLimit-Policy and RateLimit headers, rejected ones
+// Retry-After as well. Store errors are recorded in the context errors and the request is let
+// through.
+func RateLimitWithConfig[T IContext](conf RateLimitConfig) HandlerFunc[T] {
+	policy := conf.Policy
+	assert1(policy.Limit > 0, "rate limit must be positive")
+	assert1(policy.Window > 0, "rate limit window must be positive")
+	if policy.Name == "" {
+		policy.Name = "default"
+	}
+	if conf.Store == nil {
+		conf.Store = NewMemoryRateLimitStore()
+	}
+	if conf.Key == nil {
+		conf.Key = RateLimitByIP
+	}
+	if conf.LimitReached == nil {
+		conf.LimitReached = defaultLimitReached
+	}
+	policyHeader := fmt.Sprintf("%q;q=%d;w=%d", policy.Name, policy.Limit, ceilSeconds(policy.Window))
+
+	return func(c T) {
+		if conf.Skip != nil && conf.Skip(c) {
+			return
+		}
+
+		result, err := conf.Store.Take(c.Req().Context(), policy.Name+":"+conf.Key(c), policy)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+
+		exec := c.GetExecer()
+		exec.Header(RateLimitPolicyHeader, policyHeader)
+		exec.Header(RateLimitHeader, fmt.Sprintf("%q;r=%d;t=%d", policy.Name, result.Remaining, ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			exec.Header("Retry-After", strconv.FormatInt(ceilSeconds(result.RetryAfter), 10))
+			conf.LimitReached(c, result)
+		}
+	}
+}
+
+func defaultLimitReached(c IContext, _ RateLimitResult) {
+	_ = c.Error(ErrRateLimited)
+	c.GetExecer().AbortWithStatus(http.StatusTooManyRequests)
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(d.Seconds()))
+}
+
+const rateLimitShards = 64
+
+// MemoryRateLimitStore is an in-memory RateLimitStore, sharded to reduce lock contention.
+// Idle keys are evicted lazily. It only limits the requests served by the current process.
+type MemoryRateLimitStore struct {
+	seed   maphash.Seed
+	shards [rateLimitShards]rateLimitShard
+	now    func() time.Time
+}
+
+type rateLimitShard struct {
+	mu        sync.Mutex
+	entries   map[string]*rateLimitEntry
+	lastSweep time.Time
+}
+
+type rateLimitEntry struct {
+	// token bucket
+	tokens float64
+	last   time.Time
+	// sliding window
+	start time.Time
+	prev  int
+	curr  int
+
+	expires time.Time
+}
+
+var _ RateLimitStore = (*MemoryRateLimitStore)(nil)
+
+// NewMemoryRateLimitStore returns an empty MemoryRateLimitStore.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	s := &MemoryRateLimitStore{seed: maphash.MakeSeed(), now: time.Now}
+	for i := range s.shards {
+		s.shards[i].entries = make(map[string]*rateLimitEntry)
+	}
+	return s
+}
+
+// Take implements the RateLimitStore interface.
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, policy RateLimitPolicy) (RateLimitResult, error) {
+	now := s.now()
+	shard := &s.shards[maphash.String(s.seed, key)%rateLimitShards]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.sweep(now, policy.Window)
+	e, ok := shard.entries[key]
+	if !ok {
+		e = &rateLimitEntry{tokens: float64(policy.burst()), last: now, start: now.Truncate(policy.Window)}
+		shard.entries[key] = e
+	}
+
+	var result RateLimitResult
+	switch policy.Algorithm {
+	case SlidingWindow:
+		result = e.slidingWindow(now, policy)
+		e.expires = e.start.Add(2 * policy.Window)
+	default:
+		result = e.tokenBucket(now, policy)
+		e.expires = now.Add(result.Reset)
+	}
+	return result, nil
+}
+
+// sweep evicts the expired entries, at most once per window.
+func (s *rateLimitShard) sweep(now time.Time, window time.Duration) {
+	if now.Sub(s.lastSweep) < window {
+		return
+	}
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func (e *rateLimitEntry) tokenBucket(now time.Time, policy RateLimitPolicy) RateLimitResult {
+	burst := float64(policy.burst())
+	rate := float64(policy.Limit) / policy.Window.Seconds() // tokens per second
+	e.tokens = math.Min(burst, e.tokens+now.Sub(e.last).Seconds()*rate)
+	e.last = now
+
+	result := RateLimitResult{Limit: policy.Limit}
+	if e.tokens >= 1 {
+		e.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsDuration((1 - e.tokens) / rate)
+	}
+	result.Remaining = int(e.tokens)
+	result.Reset = secondsDuration((burst - e.tokens) / rate)
+	return result
+}
+
+func (e *rateLimitEntry) slidingWindow(now time.Time, policy RateLimitPolicy) RateLimitResult {
+	window := policy.Window
+	if start := now.Truncate(window); !start.Equal(e.start) {
+		if start.Sub(e.start) == window {
+			e.prev = e.curr
+		} else {
+			e.prev = 0
+		}
+		e.curr = 0
+		e.start = start
+	}
+
+	elapsed := now.Sub(e.start)
+	weight := 1 - float64(elapsed)/float64(window)
+	estimate := float64(e.prev)*weight + float64(e.curr)
+	limit := float64(policy.Limit)
+
+	result := RateLimitResult{Limit: policy.Limit, Reset: window - elapsed}
+	if estimate+1 <= limit {
+		e.curr++
+		estimate++
+		result.Allowed = true
+	} else if e.curr+1 > policy.Limit || e.prev == 0 {
+		result.RetryAfter = window - elapsed
+	} else {
+		// wait until the weight of the previous window has decayed enough
+		needed := 1 - (limit-float64(e.curr)-1)/float64(e.prev)
+		result.RetryAfter = time.Duration(needed*float64(window)) - elapsed
+	}
+	result.Remaining = max(policy.Limit-int(math.Ceil(estimate)), 0)
+	if e.curr > 0 {
+		// the current window still weighs on the next one
+		result.Reset += window
+	}
+	return result
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
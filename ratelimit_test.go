@@ -0,0 +1,195 @@
+package hi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestRateLimitStore() (*MemoryRateLimitStore, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewMemoryRateLimitStore()
+	store.now = clock.now
+	return store, clock
+}
+
+// performFrom performs a request from the client at remoteAddr.
+func performFrom(r http.Handler, remoteAddr string, headers ...header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	for _, h := range headers {
+		req.Header.Add(h.Key, h.Value)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitTokenBucket(t *testing.T) {
+	store, clock := newTestRateLimitStore()
+	router := New(&Context{})
+	router.Use(RateLimitWithConfig[*Context](RateLimitConfig{
+		Policy: RateLimitPolicy{Limit: 2, Window: time.Minute},
+		Store:  store,
+	}))
+	router.GET("/", func(c *Context) { c.String(http.StatusOK, "ok") })
+
+	w := PerformRequest(router, http.MethodGet, "/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"default";q=2;w=60`, w.Header().Get(RateLimitPolicyHeader))
+	assert.Equal(t, `"default";r=1;t=30`, w.Header().Get(RateLimitHeader))
+
+	w = PerformRequest(router, http.MethodGet, "/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"default";r=0;t=60`, w.Header().Get(RateLimitHeader))
+
+	w = PerformRequest(router, http.MethodGet, "/")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	// another client has its own bucket
+	w = performFrom(router, "10.0.0.2:1234")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	clock.advance(30 * time.Second)
+	w = PerformRequest(router, http.MethodGet, "/")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRateLimitSlidingWindow(t *testing.T) {
+	store, clock := newTestRateLimitStore()
+	policy := RateLimitPolicy{Name: "sw", Algorithm: SlidingWindow, Limit: 4, Window: time.Minute}
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		result, err := store.Take(ctx, "k", policy)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3-i, result.Remaining)
+	}
+	result, _ := store.Take(ctx, "k", policy)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Minute, result.RetryAfter)
+
+	// half way through the next window, the previous one still weighs 2 requests
+	clock.advance(90 * time.Second)
+	result, _ = store.Take(ctx, "k", policy)
+	assert.True(t, result.Allowed)
+	result, _ = store.Take(ctx, "k", policy)
+	assert.True(t, result.Allowed)
+	result, _ = store.Take(ctx, "k", policy)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 15*time.Second, result.RetryAfter)
+
+	clock.advance(15 * time.Second)
+	result, _ = store.Take(ctx, "k", policy)
+	assert.True(t, result.Allowed)
+
+	// windows older than the previous one are forgotten
+	clock.advance(3 * time.Minute)
+	result, _ = store.Take(ctx, "k", policy)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 3, result.Remaining)
+}
+
+func TestRateLimitKeysAndGroups(t *testing.T) {
+	router := New(&Context{})
+	api := router.Group("/api", func(c *Context) { c.Set(AuthUserKey, c.GetHeader("X-User")) })
+	api.Use(RateLimitWithConfig[*Context](RateLimitConfig{
+		Policy: RateLimitPolicy{Name: "api", Limit: 1, Window: time.Hour},
+		Key:    RateLimitByUser,
+		LimitReached: func(c IContext, result RateLimitResult) {
+			c.(*Context).AbortWithStatusJSON(http.StatusTooManyRequests, H{"remaining": result.Remaining})
+		},
+	}))
+	api.GET("/", func(c *Context) {})
+	router.GET("/open", func(c *Context) {})
+
+	assert.Equal(t, http.StatusOK, PerformRequest(router, http.MethodGet, "/api/", header{"X-User", "alice"}).Code)
+	assert.Equal(t, http.StatusOK, PerformRequest(router, http.MethodGet, "/api/", header{"X-User", "bob"}).Code)
+	w := PerformRequest(router, http.MethodGet, "/api/", header{"X-User", "alice"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.JSONEq(t, `{"remaining":0}`, w.Body.String())
+
+	w = PerformRequest(router, http.MethodGet, "/open")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(RateLimitHeader))
+}
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(context.Context, string, RateLimitPolicy) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("store down")
+}
+
+func TestRateLimitStoreErrorFailsOpen(t *testing.T) {
+	router := New(&Context{})
+	var errs []string
+	router.Use(func(c *Context) {
+		c.Next()
+		errs = c.Errors.Errors()
+	})
+	router.Use(RateLimitWithConfig[*Context](RateLimitConfig{
+		Policy: RateLimitPolicy{Limit: 1, Window: time.Second},
+		Store:  failingRateLimitStore{},
+	}))
+	router.GET("/", func(c *Context) {})
+
+	assert.Equal(t, http.StatusOK, PerformRequest(router, http.MethodGet, "/").Code)
+	assert.Equal(t, []string{"store down"}, errs)
+	assert.Panics(t, func() { RateLimit[*Context](0, time.Second) })
+}
+
+func TestRateLimitByIPIgnoresSpoofedHeaders(t *testing.T) {
+	store, _ := newTestRateLimitStore()
+	router := New(&Context{})
+	router.Use(RateLimitWithConfig[*Context](RateLimitConfig{
+		Policy: RateLimitPolicy{Limit: 2, Window: time.Minute},
+		Store:  store,
+	}))
+	router.GET("/", func(c *Context) { c.String(http.StatusOK, "ok") })
+
+	// a client rotating fake forwarding headers shares the bucket of its address
+	codes := make([]int, 0, 4)
+	for i := range 4 {
+		ip := fmt.Sprintf("10.0.0.%d", i+10)
+		codes = append(codes, performFrom(router, "192.0.2.7:1234", header{"X-Forwarded-For", ip}, header{"X-Real-IP", ip}).Code)
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests}, codes)
+
+	// behind a trusted proxy, the clients it reports have their own buckets
+	require.NoError(t, router.SetTrustedProxies([]string{"192.0.2.1"}))
+	for i := range 3 {
+		ip := fmt.Sprintf("10.0.0.%d", i+10)
+		w := performFrom(router, "192.0.2.1:1234", header{"X-Forwarded-For", "203.0.113.9, " + ip})
+		assert.Equal(t, http.StatusOK, w.Code, ip)
+	}
+}
+
+func TestRateLimitKeyFuncs(t *testing.T) {
+	c, _ := CreateTestContext(nil)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/", nil)
+	c.Request.RemoteAddr = "10.0.0.1:1234"
+	c.Request.Header.Set("X-API-Key", "k1")
+	c.GetExecer().SetFullPath("/users/:id")
+
+	assert.Equal(t, "ip:10.0.0.1", RateLimitByIP(c))
+	assert.Equal(t, "ip:10.0.0.1", RateLimitByUser(c))
+	c.Set(AuthUserKey, "alice")
+	assert.Equal(t, "user:alice", RateLimitByUser(c))
+	assert.Equal(t, "header:k1", RateLimitByHeader("X-API-Key")(c))
+	assert.Equal(t, "ip:10.0.0.1", RateLimitByHeader("X-Other")(c))
+	assert.Equal(t, "route:GET /users/:id", RateLimitByRoute(c))
+}
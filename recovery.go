@@ -87,14 +87,18 @@ func CustomRecoveryWithWriter[T IContext](out io.Writer, handle RecoveryFunc[T])
 						}
 					}
 					headersToStr := strings.Join(headers, "\r\n")
+					var requestID string
+					if id := GetRequestID(c); id != "" {
+						requestID = " (request " + id + ")"
+					}
 					if brokenPipe {
-						logger.Printf("%s\n%s%s", err, headersToStr, reset)
+						logger.Printf("%s%s\n%s%s", err, requestID, headersToStr, reset)
 					} else if IsDebugging() {
-						logger.Printf("[Recovery] %s panic recovered:\n%s\n%s\n%s%s",
-							timeFormat(time.Now()), headersToStr, err, stack, reset)
+						logger.Printf("[Recovery] %s panic recovered%s:\n%s\n%s\n%s%s",
+							timeFormat(time.Now()), requestID, headersToStr, err, stack, reset)
 					} else {
-						logger.Printf("[Recovery] %s panic recovered:\n%s\n%s%s",
-							timeFormat(time.Now()), err, stack, reset)
+						logger.Printf("[Recovery] %s panic recovered%s:\n%s\n%s%s",
+							timeFormat(time.Now()), requestID, err, stack, reset)
 					}
 				}
 				if brokenPipe {
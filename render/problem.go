@@ -0,0 +1,30 @@
+package render
+
+import (
+	"net/http"
+
+	"github.com/nbcx/hi/internal/json"
+)
+
+// ProblemJSON contains the given problem details object (RFC 9457).
+type ProblemJSON struct {
+	Data any
+}
+
+var problemJSONContentType = []string{"application/problem+json"}
+
+// Render (ProblemJSON) marshals the given problem details and writes it with the problem+json ContentType.
+func (r ProblemJSON) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	jsonBytes, err := json.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(jsonBytes)
+	return err
+}
+
+// WriteContentType (ProblemJSON) writes problem+json ContentType.
+func (r ProblemJSON) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, problemJSONContentType)
+}
@@ -42,6 +42,25 @@ func TestRenderJSON(t *testing.T) {
 	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
 }
 
+func TestRenderProblemJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	data := map[string]any{
+		"title":  "Not Found",
+		"status": 404,
+	}
+
+	(ProblemJSON{data}).WriteContentType(w)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	err := (ProblemJSON{data}).Render(w)
+
+	require.NoError(t, err)
+	assert.Equal(t, `{"status":404,"title":"Not Found"}`, w.Body.String())
+
+	err = (ProblemJSON{make(chan int)}).Render(httptest.NewRecorder())
+	require.Error(t, err)
+}
+
 func TestRenderJSONError(t *testing.T) {
 	w := httptest.NewRecorder()
 	data := make(chan int)
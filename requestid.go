@@ -0,0 +1,84 @@
+package hi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// RequestIDKey is the key the request ID is stored under in the context.
+const RequestIDKey = "request_id"
+
+// RequestIDHeader is the default header the request ID is read from and echoed on.
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// RequestIDConfig defines the config for RequestID middleware.
+type RequestIDConfig struct {
+	// Header is the request header an incoming ID is accepted from and the response header it
+	// is echoed on.
+	// Optional. Default value is RequestIDHeader.
+	Header string
+
+	// Generator returns a new ID when the request does not carry a valid one.
+	// Optional. Default value generates 128 random bits, hex encoded.
+	Generator func() string
+
+	// Validator reports whether an incoming ID is accepted.
+	// Optional. Default value accepts up to 128 visible ASCII characters.
+	Validator func(id string) bool
+}
+
+// RequestID returns a middleware that accepts a valid incoming X-Request-ID or generates a
+// new one, stores it in the context under RequestIDKey and echoes it on the response.
+func RequestID[T IContext]() HandlerFunc[T] {
+	return RequestIDWithConfig[T](RequestIDConfig{})
+}
+
+// RequestIDWithConfig returns a RequestID middleware with config.
+func RequestIDWithConfig[T IContext](conf RequestIDConfig) HandlerFunc[T] {
+	if conf.Header == "" {
+		conf.Header = RequestIDHeader
+	}
+	if conf.Generator == nil {
+		conf.Generator = generateRequestID
+	}
+	if conf.Validator == nil {
+		conf.Validator = validRequestID
+	}
+
+	return func(c T) {
+		id := c.Req().Header.Get(conf.Header)
+		if !conf.Validator(id) {
+			id = conf.Generator()
+		}
+		c.Set(RequestIDKey, id)
+		c.GetExecer().Header(conf.Header, id)
+	}
+}
+
+// GetRequestID returns the request ID stored by the RequestID middleware, or "" if there is none.
+func GetRequestID(c IContext) string {
+	id, _ := c.GetKeys()[RequestIDKey].(string)
+	return id
+}
+
+func generateRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package hi
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDGenerated(t *testing.T) {
+	var id string
+	router := New(&Context{})
+	router.Use(RequestID[*Context]())
+	router.GET("/", func(c *Context) {
+		id = GetRequestID(c)
+		assert.Equal(t, id, c.Value(RequestIDKey))
+	})
+
+	w := PerformRequest(router, http.MethodGet, "/")
+
+	assert.Len(t, id, 32)
+	assert.Equal(t, id, w.Header().Get(RequestIDHeader))
+
+	first := id
+	PerformRequest(router, http.MethodGet, "/")
+	assert.NotEqual(t, first, id)
+}
+
+func TestRequestIDPropagated(t *testing.T) {
+	router := New(&Context{})
+	router.Use(RequestID[*Context]())
+	router.GET("/", func(c *Context) {})
+
+	w := PerformRequest(router, http.MethodGet, "/", header{RequestIDHeader, "upstream-42"})
+	assert.Equal(t, "upstream-42", w.Header().Get(RequestIDHeader))
+
+	for _, invalid := range []string{"with space", "new\nline", strings.Repeat("x", maxRequestIDLength+1)} {
+		w = PerformRequest(router, http.MethodGet, "/", header{RequestIDHeader, invalid})
+		assert.NotEqual(t, invalid, w.Header().Get(RequestIDHeader))
+		assert.Len(t, w.Header().Get(RequestIDHeader), 32)
+	}
+}
+
+func TestRequestIDWithConfig(t *testing.T) {
+	router := New(&Context{})
+	router.Use(RequestIDWithConfig[*Context](RequestIDConfig{
+		Header:    "X-Correlation-ID",
+		Generator: func() string { return "generated" },
+		Validator: func(id string) bool { return strings.HasPrefix(id, "ok-") },
+	}))
+	router.GET("/", func(c *Context) {})
+
+	w := PerformRequest(router, http.MethodGet, "/", header{"X-Correlation-ID", "ok-1"})
+	assert.Equal(t, "ok-1", w.Header().Get("X-Correlation-ID"))
+
+	w = PerformRequest(router, http.MethodGet, "/", header{"X-Correlation-ID", "ko-1"})
+	assert.Equal(t, "generated", w.Header().Get("X-Correlation-ID"))
+	assert.Empty(t, w.Header().Get(RequestIDHeader))
+}
+
+func TestRequestIDInLoggerAndProblem(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	var gotID string
+	router := New(&Context{})
+	router.Use(RequestID[*Context](), LoggerWithConfig[*Context](LoggerConfig{
+		Output: buffer,
+		Formatter: func(param LogFormatterParams) string {
+			gotID = param.RequestID
+			return defaultLogFormatter(param)
+		},
+	}))
+	router.GET("/", func(c *Context) {
+		c.AbortWithProblem(NewProblem(http.StatusConflict, ""))
+	})
+
+	w := PerformRequest(router, http.MethodGet, "/", header{RequestIDHeader, "req-1"})
+
+	assert.Equal(t, "req-1", gotID)
+	assert.Contains(t, buffer.String(), `"/" | req-1`)
+	assert.JSONEq(t, `{"type":"about:blank","title":"Conflict","status":409,"request_id":"req-1"}`, w.Body.String())
+}
+
+func TestRequestIDInRecovery(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	router := New(&Context{})
+	router.Use(RequestID[*Context](), RecoveryWithWriter[*Context](buffer))
+	router.GET("/", func(c *Context) {
+		panic(fmt.Errorf("oops"))
+	})
+
+	w := PerformRequest(router, http.MethodGet, "/", header{RequestIDHeader, "req-2"})
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, buffer.String(), "panic recovered (request req-2)")
+}
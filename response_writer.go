@@ -47,6 +47,8 @@ type responseWriter struct {
 	http.ResponseWriter
 	size   int
 	status int
+	// beforeHeader are called once, right before the header is written
+	beforeHeader []func()
 }
 
 var _ ResponseWriter = (*responseWriter)(nil)
@@ -59,6 +61,13 @@ func (w *responseWriter) reset(writer http.ResponseWriter) {
 	w.ResponseWriter = writer
 	w.size = noWritten
 	w.status = defaultStatus
+	w.beforeHeader = nil
+}
+
+// before registers fn to be called right before the header is written, while it can still be
+// modified.
+func (w *responseWriter) before(fn func()) {
+	w.beforeHeader = append(w.beforeHeader, fn)
 }
 
 func (w *responseWriter) WriteHeader(code int) {
@@ -73,6 +82,11 @@ func (w *responseWriter) WriteHeader(code int) {
 
 func (w *responseWriter) WriteHeaderNow() {
 	if !w.Written() {
+		for len(w.beforeHeader) > 0 {
+			fn := w.beforeHeader[0]
+			w.beforeHeader = w.beforeHeader[1:]
+			fn()
+		}
 		w.size = 0
 		w.ResponseWriter.WriteHeader(w.status)
 	}
@@ -0,0 +1,371 @@
+package hi
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nbcx/hi/internal/json"
+)
+
+// CSPNonceKey is the key the CSP nonce of a request is stored under in the context.
+const CSPNonceKey = "csp_nonce"
+
+// CSPNonceSource is a source expression placeholder replaced by the nonce of each request,
+// e.g. NewCSP().ScriptSrc("'self'", CSPNonceSource).
+const CSPNonceSource = "'nonce'"
+
+// Content-Security-Policy header fields.
+const (
+	CSPHeader           = "Content-Security-Policy"
+	CSPReportOnlyHeader = "Content-Security-Policy-Report-Only"
+)
+
+// maxCSPReportSize bounds the size of the violation reports read by CSPReportHandler.
+const maxCSPReportSize = 64 << 10
+
+// CSP is a Content-Security-Policy builder. Directives are serialized in the order they are
+// first added.
+//
+//	csp := hi.NewCSP().
+//		DefaultSrc("'self'").
+//		ScriptSrc("'self'", hi.CSPNonceSource).
+//		ReportURI("/csp-report")
+type CSP struct {
+	names   []string
+	sources map[string][]string
+}
+
+// NewCSP returns an empty policy.
+func NewCSP() *CSP {
+	return &CSP{sources: make(map[string][]string)}
+}
+
+// Add appends sources to directive, adding the directive if needed. Directives without
+// sources, like upgrade-insecure-requests, are added without any.
+func (p *CSP) Add(directive string, sources ...string) *CSP {
+	if _, ok := p.sources[directive]; !ok {
+		p.names = append(p.names, directive)
+	}
+	p.sources[directive] = append(p.sources[directive], sources...)
+	return p
+}
+
+// DefaultSrc adds sources to the default-src directive.
+func (p *CSP) DefaultSrc(sources ...string) *CSP { return p.Add("default-src", sources...) }
+
+// ScriptSrc adds sources to the script-src directive.
+func (p *CSP) ScriptSrc(sources ...string) *CSP { return p.Add("script-src", sources...) }
+
+// StyleSrc adds sources to the style-src directive.
+func (p *CSP) StyleSrc(sources ...string) *CSP { return p.Add("style-src", sources...) }
+
+// ImgSrc adds sources to the img-src directive.
+func (p *CSP) ImgSrc(sources ...string) *CSP { return p.Add("img-src", sources...) }
+
+// ConnectSrc adds sources to the connect-src directive.
+func (p *CSP) ConnectSrc(sources ...string) *CSP { return p.Add("connect-src", sources...) }
+
+// FontSrc adds sources to the font-src directive.
+func (p *CSP) FontSrc(sources ...string) *CSP { return p.Add("font-src", sources...) }
+
+// ObjectSrc adds sources to the object-src directive.
+func (p *CSP) ObjectSrc(sources ...string) *CSP { return p.Add("object-src", sources...) }
+
+// FrameAncestors adds sources to the frame-ancestors directive.
+func (p *CSP) FrameAncestors(sources ...string) *CSP { return p.Add("frame-ancestors", sources...) }
+
+// BaseURI adds sources to the base-uri directive.
+func (p *CSP) BaseURI(sources ...string) *CSP { return p.Add("base-uri", sources...) }
+
+// FormAction adds sources to the form-action directive.
+func (p *CSP) FormAction(sources ...string) *CSP { return p.Add("form-action", sources...) }
+
+// UpgradeInsecureRequests adds the upgrade-insecure-requests directive.
+func (p *CSP) UpgradeInsecureRequests() *CSP { return p.Add("upgrade-insecure-requests") }
+
+// ReportURI adds the report-uri directive, e.g. the path CSPReportHandler is served on.
+func (p *CSP) ReportURI(uri string) *CSP { return p.Add("report-uri", uri) }
+
+// ReportTo adds the report-to directive, naming a Reporting-Endpoints endpoint.
+func (p *CSP) ReportTo(group string) *CSP { return p.Add("report-to", group) }
+
+// UsesNonce reports whether the policy contains CSPNonceSource.
+func (p *CSP) UsesNonce() bool {
+	for _, sources := range p.sources {
+		for _, source := range sources {
+			if source == CSPNonceSource {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String returns the policy with CSPNonceSource replaced by nonce.
+func (p *CSP) String(nonce string) string {
+	var b strings.Builder
+	for i, name := range p.names {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(name)
+		for _, source := range p.sources[name] {
+			b.WriteByte(' ')
+			if source == CSPNonceSource {
+				source = "'nonce-" + nonce + "'"
+			}
+			b.WriteString(source)
+		}
+	}
+	return b.String()
+}
+
+// SecureConfig defines the config for Secure middleware.
+type SecureConfig struct {
+	// HSTSMaxAge is the max-age of Strict-Transport-Security, sent on HTTPS requests only
+	// (TLS, or X-Forwarded-Proto: https from one of the Engine.SetTrustedProxies). A negative
+	// value disables the header.
+	// Optional. Default value is 2 years.
+	HSTSMaxAge time.Duration
+
+	// HSTSIncludeSubdomains and HSTSPreload add the includeSubDomains and preload directives.
+	// Optional.
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	// DisableNosniff removes X-Content-Type-Options: nosniff.
+	// Optional.
+	DisableNosniff bool
+
+	// ReferrerPolicy is the Referrer-Policy, "-" disables the header.
+	// Optional. Default value is "strict-origin-when-cross-origin".
+	ReferrerPolicy string
+
+	// PermissionsPolicy is the Permissions-Policy, e.g. "camera=(), geolocation=()".
+	// Optional.
+	PermissionsPolicy string
+
+	// CrossOriginOpenerPolicy is the Cross-Origin-Opener-Policy, "-" disables the header.
+	// Optional. Default value is "same-origin".
+	CrossOriginOpenerPolicy string
+
+	// CrossOriginEmbedderPolicy is the Cross-Origin-Embedder-Policy, e.g. "require-corp".
+	// Optional.
+	CrossOriginEmbedderPolicy string
+
+	// CSP is the Content-Security-Policy. When it uses CSPNonceSource, a nonce is generated for
+	// every request, see CSPNonce.
+	// Optional.
+	CSP *CSP
+
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only, to evaluate it
+	// without enforcing it.
+	// Optional.
+	CSPReportOnly bool
+}
+
+// Secure returns a middleware setting the security headers with their default values.
+func Secure[T IContext]() HandlerFunc[T] {
+	return SecureWithConfig[T](SecureConfig{})
+}
+
+// SecureWithConfig returns a Secure middleware with config.
+func SecureWithConfig[T IContext](conf SecureConfig) HandlerFunc[T] {
+	if conf.HSTSMaxAge == 0 {
+		conf.HSTSMaxAge = 2 * 365 * 24 * time.Hour
+	}
+	var hsts string
+	if conf.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.FormatInt(int64(conf.HSTSMaxAge/time.Second), 10)
+		if conf.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if conf.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+	if conf.ReferrerPolicy == "" {
+		conf.ReferrerPolicy = "strict-origin-when-cross-origin"
+	}
+	if conf.CrossOriginOpenerPolicy == "" {
+		conf.CrossOriginOpenerPolicy = "same-origin"
+	}
+
+	static := make(http.Header)
+	setHeader := func(key, value string) {
+		if value != "" && value != "-" {
+			static.Set(key, value)
+		}
+	}
+	if !conf.DisableNosniff {
+		setHeader("X-Content-Type-Options", "nosniff")
+	}
+	setHeader("Referrer-Policy", conf.ReferrerPolicy)
+	setHeader("Permissions-Policy", conf.PermissionsPolicy)
+	setHeader("Cross-Origin-Opener-Policy", conf.CrossOriginOpenerPolicy)
+	setHeader("Cross-Origin-Embedder-Policy", conf.CrossOriginEmbedderPolicy)
+
+	cspHeader := CSPHeader
+	if conf.CSPReportOnly {
+		cspHeader = CSPReportOnlyHeader
+	}
+	var csp string
+	nonced := conf.CSP != nil && conf.CSP.UsesNonce()
+	if conf.CSP != nil && !nonced {
+		csp = conf.CSP.String("")
+	}
+
+	return func(c T) {
+		header := c.Rsp().Header()
+		for key, values := range static {
+			header[key] = slices.Clone(values)
+		}
+		if hsts != "" && isHTTPS(c) {
+			header.Set("Strict-Transport-Security", hsts)
+		}
+		switch {
+		case nonced:
+			nonce := generateCSPNonce()
+			c.Set(CSPNonceKey, nonce)
+			header.Set(cspHeader, conf.CSP.String(nonce))
+		case csp != "":
+			header.Set(cspHeader, csp)
+		}
+	}
+}
+
+// CSPNonce returns the CSP nonce of the request, or "" if there is none. Pass it to the
+// templates to set the nonce attribute of the inline scripts and styles.
+//
+//	c.HTML(http.StatusOK, "index.tmpl", hi.H{"nonce": hi.CSPNonce(c)})
+func CSPNonce(c IContext) string {
+	nonce, _ := c.GetKeys()[CSPNonceKey].(string)
+	return nonce
+}
+
+func generateCSPNonce() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(b[:])
+}
+
+// isHTTPS reports whether the request was made over HTTPS, directly or, as told by
+// X-Forwarded-Proto, through one of the Engine.SetTrustedProxies.
+func isHTTPS(c IContext) bool {
+	req := c.Req()
+	return req.TLS != nil ||
+		c.GetExecer().TrustedProxy() && strings.EqualFold(req.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// CSPReport is a CSP violation report.
+type CSPReport struct {
+	DocumentURI        string `json:"document-uri"`
+	Referrer           string `json:"referrer"`
+	BlockedURI         string `json:"blocked-uri"`
+	ViolatedDirective  string `json:"violated-directive"`
+	EffectiveDirective string `json:"effective-directive"`
+	OriginalPolicy     string `json:"original-policy"`
+	Disposition        string `json:"disposition"`
+	StatusCode         int    `json:"status-code"`
+	SourceFile         string `json:"source-file"`
+	LineNumber         int    `json:"line-number"`
+	ColumnNumber       int    `json:"column-number"`
+	Sample             string `json:"script-sample"`
+}
+
+// reportingCSPBody is the body of a "csp-violation" report of the Reporting API.
+type reportingCSPBody struct {
+	DocumentURL        string `json:"documentURL"`
+	Referrer           string `json:"referrer"`
+	BlockedURL         string `json:"blockedURL"`
+	EffectiveDirective string `json:"effectiveDirective"`
+	OriginalPolicy     string `json:"originalPolicy"`
+	Disposition        string `json:"disposition"`
+	StatusCode         int    `json:"statusCode"`
+	SourceFile         string `json:"sourceFile"`
+	LineNumber         int    `json:"lineNumber"`
+	ColumnNumber       int    `json:"columnNumber"`
+	Sample             string `json:"sample"`
+}
+
+// CSPReportHandler returns a handler accepting CSP violation reports, both the
+// application/csp-report documents of report-uri and the application/reports+json batches of
+// report-to, and handing each of them to fn. It answers 204, or 400 on malformed reports.
+func CSPReportHandler[T IContext](fn func(c IContext, report CSPReport)) HandlerFunc[T] {
+	if fn == nil {
+		fn = func(c IContext, report CSPReport) {
+			debugPrint("[WARNING] CSP violation on %s: %s blocked %s\n",
+				report.DocumentURI, report.EffectiveDirective, report.BlockedURI)
+		}
+	}
+
+	return func(c T) {
+		body, err := io.ReadAll(io.LimitReader(c.Req().Body, maxCSPReportSize))
+		if err != nil {
+			_ = c.Error(err)
+			c.GetExecer().AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		reports, err := parseCSPReports(c.Req().Header.Get("Content-Type"), body)
+		if err != nil {
+			_ = c.Error(err).SetType(ErrorTypeBind)
+			c.GetExecer().AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		for _, report := range reports {
+			fn(c, report)
+		}
+		c.GetExecer().AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+func parseCSPReports(contentType string, body []byte) ([]CSPReport, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "application/reports+json" {
+		var batch []struct {
+			Type string           `json:"type"`
+			Body reportingCSPBody `json:"body"`
+		}
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return nil, err
+		}
+		reports := make([]CSPReport, 0, len(batch))
+		for _, r := range batch {
+			if r.Type != "csp-violation" {
+				continue
+			}
+			reports = append(reports, CSPReport{
+				DocumentURI:        r.Body.DocumentURL,
+				Referrer:           r.Body.Referrer,
+				BlockedURI:         r.Body.BlockedURL,
+				ViolatedDirective:  r.Body.EffectiveDirective,
+				EffectiveDirective: r.Body.EffectiveDirective,
+				OriginalPolicy:     r.Body.OriginalPolicy,
+				Disposition:        r.Body.Disposition,
+				StatusCode:         r.Body.StatusCode,
+				SourceFile:         r.Body.SourceFile,
+				LineNumber:         r.Body.LineNumber,
+				ColumnNumber:       r.Body.ColumnNumber,
+				Sample:             r.Body.Sample,
+			})
+		}
+		return reports, nil
+	}
+
+	var doc struct {
+		Report CSPReport `json:"csp-report"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	return []CSPReport{doc.Report}, nil
+}
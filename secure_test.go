@@ -0,0 +1,103 @@
+package hi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecureDefaults(t *testing.T) {
+	router := New(&Context{})
+	router.Use(Secure[*Context]())
+	router.GET("/", func(c *Context) {})
+	router.GET("/add", func(c *Context) { c.Response.Header().Add("Referrer-Policy", "no-referrer") })
+
+	w := PerformRequest(router, http.MethodGet, "/")
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "strict-origin-when-cross-origin", w.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "same-origin", w.Header().Get("Cross-Origin-Opener-Policy"))
+	assert.Empty(t, w.Header().Get("Cross-Origin-Embedder-Policy"))
+	assert.Empty(t, w.Header().Get("Strict-Transport-Security"))
+	assert.Empty(t, w.Header().Get(CSPHeader))
+
+	// X-Forwarded-Proto is only trusted from the trusted proxies
+	w = PerformRequest(router, http.MethodGet, "/", header{"X-Forwarded-Proto", "https"})
+	assert.Empty(t, w.Header().Get("Strict-Transport-Security"))
+	require.NoError(t, router.SetTrustedProxies([]string{"192.0.2.0/24"}))
+	w = PerformRequest(router, http.MethodGet, "/", header{"X-Forwarded-Proto", "https"})
+	assert.Equal(t, "max-age=63072000", w.Header().Get("Strict-Transport-Security"))
+
+	// the headers added to are not shared between the responses
+	w = PerformRequest(router, http.MethodGet, "/add")
+	assert.Len(t, w.Header().Values("Referrer-Policy"), 2)
+	w = PerformRequest(router, http.MethodGet, "/")
+	assert.Equal(t, []string{"strict-origin-when-cross-origin"}, w.Header().Values("Referrer-Policy"))
+}
+
+func TestSecureWithConfig(t *testing.T) {
+	router := New(&Context{})
+	router.Use(SecureWithConfig[*Context](SecureConfig{
+		HSTSMaxAge:                -1,
+		ReferrerPolicy:            "-",
+		PermissionsPolicy:         "camera=(), geolocation=()",
+		CrossOriginEmbedderPolicy: "require-corp",
+		CSP:                       NewCSP().DefaultSrc("'self'").ObjectSrc("'none'").UpgradeInsecureRequests(),
+		CSPReportOnly:             true,
+	}))
+	router.GET("/", func(c *Context) { assert.Empty(t, CSPNonce(c)) })
+	require.NoError(t, router.SetTrustedProxies([]string{"192.0.2.1"}))
+
+	w := PerformRequest(router, http.MethodGet, "/", header{"X-Forwarded-Proto", "https"})
+	assert.Empty(t, w.Header().Get("Strict-Transport-Security"))
+	assert.Empty(t, w.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "camera=(), geolocation=()", w.Header().Get("Permissions-Policy"))
+	assert.Equal(t, "require-corp", w.Header().Get("Cross-Origin-Embedder-Policy"))
+	assert.Empty(t, w.Header().Get(CSPHeader))
+	assert.Equal(t, "default-src 'self'; object-src 'none'; upgrade-insecure-requests", w.Header().Get(CSPReportOnlyHeader))
+}
+
+func TestSecureCSPNonce(t *testing.T) {
+	router := New(&Context{})
+	router.Use(SecureWithConfig[*Context](SecureConfig{
+		CSP: NewCSP().DefaultSrc("'self'").ScriptSrc("'self'", CSPNonceSource).ReportURI("/csp-report"),
+	}))
+	router.GET("/", func(c *Context) { c.String(http.StatusOK, CSPNonce(c)) })
+
+	w := PerformRequest(router, http.MethodGet, "/")
+	nonce := w.Body.String()
+	require.NotEmpty(t, nonce)
+	assert.Equal(t, "default-src 'self'; script-src 'self' 'nonce-"+nonce+"'; report-uri /csp-report", w.Header().Get(CSPHeader))
+
+	w = PerformRequest(router, http.MethodGet, "/")
+	assert.NotEqual(t, nonce, w.Body.String())
+}
+
+func TestCSPReportHandler(t *testing.T) {
+	var reports []CSPReport
+	router := New(&Context{})
+	router.POST("/csp-report", CSPReportHandler[*Context](func(c IContext, report CSPReport) {
+		reports = append(reports, report)
+	}))
+	post := func(contentType, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/csp-report", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, post("application/csp-report",
+		`{"csp-report":{"document-uri":"https://example.com/","blocked-uri":"inline","violated-directive":"script-src","line-number":3}}`))
+	assert.Equal(t, http.StatusNoContent, post("application/reports+json",
+		`[{"type":"csp-violation","body":{"documentURL":"https://example.com/a","blockedURL":"eval","effectiveDirective":"script-src-elem"}},{"type":"deprecation","body":{}}]`))
+	assert.Equal(t, http.StatusBadRequest, post("application/csp-report", `{`))
+
+	require.Len(t, reports, 2)
+	assert.Equal(t, CSPReport{DocumentURI: "https://example.com/", BlockedURI: "inline", ViolatedDirective: "script-src", LineNumber: 3}, reports[0])
+	assert.Equal(t, "https://example.com/a", reports[1].DocumentURI)
+	assert.Equal(t, "script-src-elem", reports[1].EffectiveDirective)
+}
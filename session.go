@@ -0,0 +1,614 @@
+package hi
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionKey is the key the *Session of a request is stored under in the context.
+const SessionKey = "_hi/session"
+
+// DefaultSessionCookieName is the default name of the session cookie.
+const DefaultSessionCookieName = "hi_session"
+
+// ErrSessionNotFound is returned by the SessionStore implementations for unknown or expired
+// sessions.
+var ErrSessionNotFound = errors.New("session not found")
+
+const sessionFlashKey = "_flash"
+
+func init() {
+	// the session values are interface values, register the composite types they commonly hold
+	gob.Register([]any{})
+	gob.Register(map[string]any{})
+}
+
+// SessionRecord is the state of a session kept by a SessionStore.
+type SessionRecord struct {
+	Values   map[string]any
+	Created  time.Time
+	Accessed time.Time
+}
+
+// SessionStore keeps the sessions. Values of custom types must be registered with
+// gob.Register for the stores serializing them.
+type SessionStore interface {
+	// Load returns the session id, ErrSessionNotFound if it does not exist or expired.
+	Load(ctx context.Context, id string) (*SessionRecord, error)
+	// Save stores rec under id, for ttl. It returns the session ID to send to the client:
+	// id itself for server-side stores, the encoded record for client-side ones.
+	Save(ctx context.Context, id string, rec *SessionRecord, ttl time.Duration) (string, error)
+	// Delete removes the session id.
+	Delete(ctx context.Context, id string) error
+}
+
+// MemorySessionStore is an in-memory SessionStore. Expired sessions are evicted lazily. It
+// only shares the sessions between the requests served by the current process.
+type MemorySessionStore struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	lastSweep time.Time
+}
+
+type memorySession struct {
+	rec     SessionRecord
+	expires time.Time
+}
+
+var _ SessionStore = (*MemorySessionStore)(nil)
+
+// NewMemorySessionStore returns an empty MemorySessionStore.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{now: time.Now, sessions: make(map[string]memorySession)}
+}
+
+// Load implements the SessionStore interface.
+func (s *MemorySessionStore) Load(_ context.Context, id string) (*SessionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok || !s.now().Before(session.expires) {
+		return nil, ErrSessionNotFound
+	}
+	rec := session.rec
+	rec.Values = maps.Clone(rec.Values)
+	return &rec, nil
+}
+
+// Save implements the SessionStore interface.
+func (s *MemorySessionStore) Save(_ context.Context, id string, rec *SessionRecord, ttl time.Duration) (string, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) >= time.Minute {
+		s.lastSweep = now
+		for key, session := range s.sessions {
+			if !now.Before(session.expires) {
+				delete(s.sessions, key)
+			}
+		}
+	}
+	stored := *rec
+	stored.Values = maps.Clone(rec.Values)
+	s.sessions[id] = memorySession{rec: stored, expires: now.Add(ttl)}
+	return id, nil
+}
+
+// Delete implements the SessionStore interface.
+func (s *MemorySessionStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// FileSessionStore is a SessionStore keeping every session in a gob encoded file of a
+// directory, so that the sessions survive restarts. Expired files are removed by Cleanup.
+type FileSessionStore struct {
+	dir string
+	now func() time.Time
+}
+
+type storedSession struct {
+	Record  SessionRecord
+	Expires time.Time
+}
+
+var _ SessionStore = (*FileSessionStore)(nil)
+
+// NewFileSessionStore returns a FileSessionStore keeping the sessions in dir, created if it
+// does not exist.
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{dir: dir, now: time.Now}, nil
+}
+
+func (s *FileSessionStore) path(id string) (string, error) {
+	if id == "" || strings.Trim(id, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_") != "" {
+		return "", ErrSessionNotFound
+	}
+	return filepath.Join(s.dir, "session_"+id), nil
+}
+
+// Load implements the SessionStore interface.
+func (s *FileSessionStore) Load(_ context.Context, id string) (*SessionRecord, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var session storedSession
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&session); err != nil {
+		return nil, err
+	}
+	if !s.now().Before(session.Expires) {
+		_ = os.Remove(path)
+		return nil, ErrSessionNotFound
+	}
+	return &session.Record, nil
+}
+
+// Save implements the SessionStore interface.
+func (s *FileSessionStore) Save(_ context.Context, id string, rec *SessionRecord, ttl time.Duration) (string, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(storedSession{Record: *rec, Expires: s.now().Add(ttl)}); err != nil {
+		return "", err
+	}
+	// write then rename, so that concurrent requests never read a partial file
+	tmp, err := os.CreateTemp(s.dir, ".session_*")
+	if err != nil {
+		return "", err
+	}
+	if _, err = tmp.Write(buf.Bytes()); err == nil {
+		err = tmp.Close()
+	} else {
+		_ = tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	return id, nil
+}
+
+// Delete implements the SessionStore interface.
+func (s *FileSessionStore) Delete(_ context.Context, id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Cleanup removes the files of the expired sessions. Call it periodically.
+func (s *FileSessionStore) Cleanup() error {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "session_*"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		id := strings.TrimPrefix(filepath.Base(path), "session_")
+		if _, err := s.Load(context.Background(), id); err != nil && err != ErrSessionNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxCookieSessionSize keeps the session cookies under the 4096 bytes browsers accept.
+const maxCookieSessionSize = 3800
+
+// CookieSessionStore is a SessionStore keeping the sessions in the session cookie itself,
+// encrypted with a Keyring, so that no server-side storage is needed. Keep the values small,
+// the cookie is limited to about 4KB. Being stateless, it can not revoke a session: the
+// cookies of a regenerated or destroyed session remain valid until they expire.
+type CookieSessionStore struct {
+	keyring *Keyring
+	now     func() time.Time
+}
+
+var _ SessionStore = (*CookieSessionStore)(nil)
+
+// NewCookieSessionStore returns a CookieSessionStore encrypting the sessions with keyring,
+// typically the Engine.Keyring.
+func NewCookieSessionStore(keyring *Keyring) *CookieSessionStore {
+	assert1(keyring != nil, "keyring can not be nil")
+	return &CookieSessionStore{keyring: keyring, now: time.Now}
+}
+
+// Load implements the SessionStore interface.
+func (s *CookieSessionStore) Load(_ context.Context, id string) (*SessionRecord, error) {
+	data, err := s.keyring.Decrypt(SessionKey, id)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+	var session storedSession
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&session); err != nil {
+		return nil, err
+	}
+	if !s.now().Before(session.Expires) {
+		return nil, ErrSessionNotFound
+	}
+	return &session.Record, nil
+}
+
+// Save implements the SessionStore interface, id is ignored.
+func (s *CookieSessionStore) Save(_ context.Context, _ string, rec *SessionRecord, ttl time.Duration) (string, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(storedSession{Record: *rec, Expires: s.now().Add(ttl)}); err != nil {
+		return "", err
+	}
+	encrypted := s.keyring.Encrypt(SessionKey, buf.Bytes())
+	if len(encrypted) > maxCookieSessionSize {
+		return "", fmt.Errorf("session of %d bytes too large for a cookie", len(encrypted))
+	}
+	return encrypted, nil
+}
+
+// Delete implements the SessionStore interface, it does nothing.
+func (s *CookieSessionStore) Delete(context.Context, string) error {
+	return nil
+}
+
+// SessionConfig defines the config for Sessions middleware.
+type SessionConfig struct {
+	// Store keeps the sessions.
+	// Optional. Default value is a new MemorySessionStore.
+	Store SessionStore
+
+	// Keys sign the session cookie, see NewKeyring.
+	// Optional. Default value uses Engine.Keyring.
+	Keys [][]byte
+
+	// CookieName is the name of the session cookie.
+	// Optional. Default value is DefaultSessionCookieName.
+	CookieName string
+
+	// CookiePath, CookieDomain and CookieSecure are the attributes of the session cookie.
+	// Optional. Default value of CookiePath is "/".
+	CookiePath   string
+	CookieDomain string
+	CookieSecure bool
+
+	// CookieMaxAge is the max age of the session cookie in seconds.
+	// Optional. Default value is 0, the cookie lasts until the browser is closed.
+	CookieMaxAge int
+
+	// SameSite is passed to Context.SetSameSite for the cookie.
+	// Optional. Default value is http.SameSiteLaxMode.
+	SameSite http.SameSite
+
+	// IdleTimeout expires the sessions not used for that long.
+	// Optional. Default value is 30 minutes.
+	IdleTimeout time.Duration
+
+	// AbsoluteTimeout expires the sessions that long after their creation, however active.
+	// Optional. Default value is 24 hours.
+	AbsoluteTimeout time.Duration
+
+	now func() time.Time
+}
+
+// Sessions returns a middleware providing sessions kept in store, with a session ID cookie
+// signed with keys, or the Engine.Keyring without keys. Access the session with
+// Context.Session or SessionFrom.
+func Sessions[T IContext](store SessionStore, keys ...[]byte) HandlerFunc[T] {
+	return SessionsWithConfig[T](SessionConfig{Store: store, Keys: keys})
+}
+
+// SessionsWithConfig returns a Sessions middleware with config.
+//
+// The session is loaded on first use and saved only when modified, or when it must be kept
+// from idling out, right before the response header is written, and again at the end of the
+// handlers chain if it changed since. Without Keys nor Engine.Keyring, requests are aborted
+// with 500 and ErrNoKeyring is recorded.
+func SessionsWithConfig[T IContext](conf SessionConfig) HandlerFunc[T] {
+	var keyring *Keyring
+	if len(conf.Keys) > 0 {
+		keyring = NewKeyring(conf.Keys...)
+	}
+	if conf.Store == nil {
+		conf.Store = NewMemorySessionStore()
+	}
+	if conf.CookieName == "" {
+		conf.CookieName = DefaultSessionCookieName
+	}
+	if conf.CookiePath == "" {
+		conf.CookiePath = "/"
+	}
+	if conf.SameSite == 0 {
+		conf.SameSite = http.SameSiteLaxMode
+	}
+	if conf.IdleTimeout <= 0 {
+		conf.IdleTimeout = 30 * time.Minute
+	}
+	if conf.AbsoluteTimeout <= 0 {
+		conf.AbsoluteTimeout = 24 * time.Hour
+	}
+	if conf.now == nil {
+		conf.now = time.Now
+	}
+
+	return func(c T) {
+		keys := keyring
+		if keys == nil {
+			if keys = c.GetExecer().Keyring(); keys == nil {
+				_ = c.Error(fmt.Errorf("sessions: %w", ErrNoKeyring))
+				c.GetExecer().AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+		}
+		s := &Session{conf: &conf, c: c, keyring: keys}
+		c.Set(SessionKey, s)
+		w := c.GetExecer().WriterMem()
+		w.before(func() { s.commit(true) })
+		c.Next()
+		s.commit(!w.Written())
+	}
+}
+
+// SessionFrom returns the session of the request, nil without the Sessions middleware.
+func SessionFrom(c IContext) *Session {
+	s, _ := c.GetKeys()[SessionKey].(*Session)
+	return s
+}
+
+// Session returns the session of the request, nil without the Sessions middleware.
+func (c *Context) Session() *Session {
+	return SessionFrom(c)
+}
+
+// Session is the session of a request. It is loaded on first use. It is not safe for
+// concurrent use.
+type Session struct {
+	conf    *SessionConfig
+	c       IContext
+	keyring *Keyring
+
+	id        string
+	cookieID  string
+	rec       *SessionRecord
+	loaded    bool
+	isNew     bool
+	modified  bool
+	touched   bool
+	renew     bool
+	destroyed bool
+}
+
+func (s *Session) load() {
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+	now := s.conf.now()
+	if id, ok := s.readCookie(); ok {
+		rec, err := s.conf.Store.Load(s.c.Req().Context(), id)
+		switch {
+		case err == nil && rec != nil:
+			if now.Sub(rec.Created) < s.conf.AbsoluteTimeout && now.Sub(rec.Accessed) < s.conf.IdleTimeout {
+				if rec.Values == nil {
+					rec.Values = make(map[string]any)
+				}
+				s.id, s.cookieID, s.rec = id, id, rec
+				// refresh the idle timeout once a quarter of it elapsed, not on every request
+				s.touched = now.Sub(rec.Accessed) > s.conf.IdleTimeout/4
+				return
+			}
+			_ = s.conf.Store.Delete(s.c.Req().Context(), id)
+			s.cookieID = id
+		case err != ErrSessionNotFound:
+			_ = s.c.Error(err)
+		default:
+			s.cookieID = id
+		}
+	}
+	s.isNew = true
+	s.rec = &SessionRecord{Values: make(map[string]any), Created: now, Accessed: now}
+}
+
+// ID returns the session ID, "" for a new session not saved yet.
+func (s *Session) ID() string {
+	s.load()
+	return s.id
+}
+
+// IsNew reports whether the session was created by the request.
+func (s *Session) IsNew() bool {
+	s.load()
+	return s.isNew
+}
+
+// Get returns the value of key, nil if it is not set.
+func (s *Session) Get(key string) any {
+	s.load()
+	return s.rec.Values[key]
+}
+
+// Set sets the value of key.
+func (s *Session) Set(key string, value any) {
+	s.load()
+	s.rec.Values[key] = value
+	s.modified = true
+}
+
+// Delete removes key.
+func (s *Session) Delete(key string) {
+	s.load()
+	if _, ok := s.rec.Values[key]; ok {
+		delete(s.rec.Values, key)
+		s.modified = true
+	}
+}
+
+// Clear removes all values.
+func (s *Session) Clear() {
+	s.load()
+	if len(s.rec.Values) > 0 {
+		clear(s.rec.Values)
+		s.modified = true
+	}
+}
+
+// AddFlash adds a flash message, kept until read by Flashes, typically on the next request.
+func (s *Session) AddFlash(value any) {
+	s.load()
+	flashes, _ := s.rec.Values[sessionFlashKey].([]any)
+	s.rec.Values[sessionFlashKey] = append(flashes, value)
+	s.modified = true
+}
+
+// Flashes returns and removes the flash messages.
+func (s *Session) Flashes() []any {
+	s.load()
+	flashes, _ := s.rec.Values[sessionFlashKey].([]any)
+	if len(flashes) > 0 {
+		delete(s.rec.Values, sessionFlashKey)
+		s.modified = true
+	}
+	return flashes
+}
+
+// Regenerate gives the session a new ID, keeping its values, to prevent session fixation.
+// Call it when the privileges of the user change, at login in particular.
+func (s *Session) Regenerate() {
+	s.load()
+	s.renew = true
+	s.modified = true
+}
+
+// Destroy deletes the session and expires its cookie.
+func (s *Session) Destroy() {
+	s.load()
+	s.destroyed = true
+}
+
+// commit saves the session if needed. The cookie is only set when headerWritable.
+func (s *Session) commit(headerWritable bool) {
+	if !s.loaded {
+		return
+	}
+	ctx := s.c.Req().Context()
+	if s.destroyed {
+		if s.id != "" {
+			if err := s.conf.Store.Delete(ctx, s.id); err != nil {
+				_ = s.c.Error(err)
+			}
+			s.id = ""
+		}
+		if s.cookieID != "" && headerWritable {
+			s.setCookie("", -1)
+			s.cookieID = ""
+		}
+		return
+	}
+	if !s.modified && !s.touched {
+		return
+	}
+
+	if s.renew && s.id != "" {
+		if err := s.conf.Store.Delete(ctx, s.id); err != nil {
+			_ = s.c.Error(err)
+		}
+		s.id = ""
+	}
+	id := s.id
+	if id == "" {
+		id = newSessionID()
+	}
+	now := s.conf.now()
+	s.rec.Accessed = now
+	ttl := min(s.conf.IdleTimeout, s.conf.AbsoluteTimeout-now.Sub(s.rec.Created))
+	saved, err := s.conf.Store.Save(ctx, id, s.rec, ttl)
+	s.modified, s.touched, s.renew = false, false, false
+	if err != nil {
+		_ = s.c.Error(err)
+		return
+	}
+	s.id = saved
+
+	if saved != s.cookieID {
+		if !headerWritable {
+			debugPrint("[WARNING] session %s saved after the response header was written, its cookie could not be set\n", s.conf.CookieName)
+			return
+		}
+		s.setCookie(saved, s.conf.CookieMaxAge)
+		s.cookieID = saved
+	}
+}
+
+func (s *Session) setCookie(id string, maxAge int) {
+	value := ""
+	if id != "" {
+		value = s.keyring.Sign(s.conf.CookieName, id)
+	}
+	setContextCookie(s.c, &http.Cookie{
+		Name:     s.conf.CookieName,
+		Value:    value,
+		MaxAge:   maxAge,
+		Path:     s.conf.CookiePath,
+		Domain:   s.conf.CookieDomain,
+		SameSite: s.conf.SameSite,
+		Secure:   s.conf.CookieSecure,
+		HttpOnly: true,
+	})
+}
+
+// readCookie returns the session ID of the request cookie if its signature is valid.
+func (s *Session) readCookie() (string, bool) {
+	cookie, err := s.c.Req().Cookie(s.conf.CookieName)
+	if err != nil {
+		return "", false
+	}
+	value, err := url.QueryUnescape(cookie.Value)
+	if err != nil {
+		return "", false
+	}
+	id, err := s.keyring.Verify(s.conf.CookieName, value)
+	if err != nil || id == "" {
+		_ = s.c.Error(fmt.Errorf("cookie %s: %w", s.conf.CookieName, ErrCookieSignature))
+		return "", false
+	}
+	return id, true
+}
+
+func newSessionID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,260 @@
+package hi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSessionKey = []byte("0123456789abcdef0123456789abcdef")
+
+func sessionRouter(conf SessionConfig) *Engine[*Context] {
+	router := New(&Context{})
+	router.Use(SessionsWithConfig[*Context](conf))
+	router.GET("/noop", func(c *Context) { c.String(http.StatusOK, "noop") })
+	router.GET("/user", func(c *Context) {
+		user, _ := c.Session().Get("user").(string)
+		c.String(http.StatusOK, user)
+	})
+	router.POST("/login", func(c *Context) {
+		c.Session().Regenerate()
+		c.Session().Set("user", c.Query("user").String())
+		c.String(http.StatusOK, "ok")
+	})
+	router.POST("/logout", func(c *Context) {
+		c.Session().Destroy()
+		c.Status(http.StatusNoContent)
+	})
+	router.POST("/flash", func(c *Context) {
+		c.Session().AddFlash("saved")
+		c.Status(http.StatusNoContent)
+	})
+	router.GET("/flash", func(c *Context) {
+		c.String(http.StatusOK, fmt.Sprint(c.Session().Flashes()))
+	})
+	return router
+}
+
+func sessionCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == DefaultSessionCookieName {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func withCookie(cookie *http.Cookie) header {
+	return header{"Cookie", cookie.Name + "=" + cookie.Value}
+}
+
+func TestSessions(t *testing.T) {
+	router := sessionRouter(SessionConfig{Keys: [][]byte{testSessionKey}})
+
+	w := PerformRequest(router, http.MethodGet, "/noop")
+	assert.Nil(t, sessionCookie(t, w), "untouched sessions are not saved")
+
+	w = PerformRequest(router, http.MethodPost, "/login?user=alice")
+	first := sessionCookie(t, w)
+	require.NotNil(t, first)
+	assert.True(t, first.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, first.SameSite)
+	assert.Equal(t, "/", first.Path)
+
+	w = PerformRequest(router, http.MethodGet, "/user", withCookie(first))
+	assert.Equal(t, "alice", w.Body.String())
+	assert.Nil(t, sessionCookie(t, w), "unmodified sessions are not saved again")
+
+	tampered := *first
+	tampered.Value = "x" + tampered.Value[1:]
+	w = PerformRequest(router, http.MethodGet, "/user", withCookie(&tampered))
+	assert.Empty(t, w.Body.String())
+
+	// logging in again regenerates the ID and invalidates the previous one
+	w = PerformRequest(router, http.MethodPost, "/login?user=bob", withCookie(first))
+	second := sessionCookie(t, w)
+	require.NotNil(t, second)
+	assert.NotEqual(t, first.Value, second.Value)
+	w = PerformRequest(router, http.MethodGet, "/user", withCookie(first))
+	assert.Empty(t, w.Body.String())
+	w = PerformRequest(router, http.MethodGet, "/user", withCookie(second))
+	assert.Equal(t, "bob", w.Body.String())
+
+	w = PerformRequest(router, http.MethodPost, "/logout", withCookie(second))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	expired := sessionCookie(t, w)
+	require.NotNil(t, expired)
+	assert.Equal(t, -1, expired.MaxAge)
+	w = PerformRequest(router, http.MethodGet, "/user", withCookie(second))
+	assert.Empty(t, w.Body.String())
+}
+
+func TestSessionsFlashes(t *testing.T) {
+	router := sessionRouter(SessionConfig{Keys: [][]byte{testSessionKey}})
+
+	w := PerformRequest(router, http.MethodPost, "/flash")
+	cookie := sessionCookie(t, w)
+	require.NotNil(t, cookie)
+	PerformRequest(router, http.MethodPost, "/flash", withCookie(cookie))
+
+	w = PerformRequest(router, http.MethodGet, "/flash", withCookie(cookie))
+	assert.Equal(t, "[saved saved]", w.Body.String())
+	w = PerformRequest(router, http.MethodGet, "/flash", withCookie(cookie))
+	assert.Equal(t, "[]", w.Body.String())
+}
+
+func TestSessionsKeyRotation(t *testing.T) {
+	store := NewMemorySessionStore()
+	oldKey := []byte("fedcba9876543210fedcba9876543210")
+	w := PerformRequest(sessionRouter(SessionConfig{Store: store, Keys: [][]byte{oldKey}}), http.MethodPost, "/login?user=alice")
+	cookie := sessionCookie(t, w)
+	require.NotNil(t, cookie)
+
+	router := sessionRouter(SessionConfig{Store: store, Keys: [][]byte{testSessionKey, oldKey}})
+	w = PerformRequest(router, http.MethodGet, "/user", withCookie(cookie))
+	assert.Equal(t, "alice", w.Body.String())
+
+	router = sessionRouter(SessionConfig{Store: store, Keys: [][]byte{testSessionKey}})
+	w = PerformRequest(router, http.MethodGet, "/user", withCookie(cookie))
+	assert.Empty(t, w.Body.String())
+
+	assert.Panics(t, func() { Sessions[*Context](store, []byte("short")) })
+}
+
+func TestCookieSessionStore(t *testing.T) {
+	keyring := NewKeyring(testSessionKey)
+	router := sessionRouter(SessionConfig{Store: NewCookieSessionStore(keyring)})
+	router.Keyring = keyring
+
+	w := PerformRequest(router, http.MethodPost, "/login?user=alice")
+	cookie := sessionCookie(t, w)
+	require.NotNil(t, cookie)
+	assert.NotContains(t, cookie.Value, "alice")
+	w = PerformRequest(router, http.MethodGet, "/user", withCookie(cookie))
+	assert.Equal(t, "alice", w.Body.String())
+
+	w = PerformRequest(router, http.MethodPost, "/flash", withCookie(cookie))
+	updated := sessionCookie(t, w)
+	require.NotNil(t, updated)
+	w = PerformRequest(router, http.MethodGet, "/flash", withCookie(updated))
+	assert.Equal(t, "[saved]", w.Body.String())
+
+	var errs []*Error
+	router = New(&Context{})
+	router.Use(func(c *Context) {
+		c.Next()
+		errs = c.Errors
+	}, Sessions[*Context](NewCookieSessionStore(keyring)))
+	router.GET("/", func(c *Context) { c.Session().Set("blob", strings.Repeat("x", 4096)) })
+	w = PerformRequest(router, http.MethodGet, "/")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], ErrNoKeyring)
+	router.Keyring = keyring
+	w = PerformRequest(router, http.MethodGet, "/")
+	assert.Nil(t, sessionCookie(t, w))
+	assert.Len(t, errs, 1)
+}
+
+func TestSessionsExpiry(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewMemorySessionStore()
+	store.now = clock.now
+	router := sessionRouter(SessionConfig{
+		Store:           store,
+		Keys:            [][]byte{testSessionKey},
+		IdleTimeout:     10 * time.Minute,
+		AbsoluteTimeout: time.Hour,
+		now:             clock.now,
+	})
+
+	w := PerformRequest(router, http.MethodPost, "/login?user=alice")
+	cookie := sessionCookie(t, w)
+	require.NotNil(t, cookie)
+
+	clock.advance(11 * time.Minute)
+	w = PerformRequest(router, http.MethodGet, "/user", withCookie(cookie))
+	assert.Empty(t, w.Body.String(), "idle timeout")
+
+	w = PerformRequest(router, http.MethodPost, "/login?user=alice")
+	cookie = sessionCookie(t, w)
+	require.NotNil(t, cookie)
+	// activity keeps the session alive until the absolute timeout
+	for range 11 {
+		clock.advance(5 * time.Minute)
+		w = PerformRequest(router, http.MethodGet, "/user", withCookie(cookie))
+		assert.Equal(t, "alice", w.Body.String())
+	}
+	clock.advance(5 * time.Minute)
+	w = PerformRequest(router, http.MethodGet, "/user", withCookie(cookie))
+	assert.Empty(t, w.Body.String(), "absolute timeout")
+}
+
+func TestSessionsAfterHeaderWritten(t *testing.T) {
+	store := NewMemorySessionStore()
+	router := New(&Context{})
+	router.Use(Sessions[*Context](store, testSessionKey))
+	router.GET("/", func(c *Context) {
+		c.Session().Set("visits", 1)
+		c.String(http.StatusOK, "ok")
+		c.Session().Set("visits", 2)
+	})
+
+	w := PerformRequest(router, http.MethodGet, "/")
+	cookie := sessionCookie(t, w)
+	require.NotNil(t, cookie)
+	id := cookie.Value[:strings.LastIndexByte(cookie.Value, '.')]
+	rec, err := store.Load(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, 2, rec.Values["visits"], "changes after the header was written are saved too")
+}
+
+func TestFileSessionStore(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	dir := t.TempDir()
+	store, err := NewFileSessionStore(dir)
+	require.NoError(t, err)
+	store.now = clock.now
+	ctx := context.Background()
+
+	rec := &SessionRecord{
+		Values:  map[string]any{"user": "alice", "flashes": []any{"saved"}},
+		Created: clock.now(),
+	}
+	id, err := store.Save(ctx, "abc-123_x", rec, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "abc-123_x", id)
+
+	loaded, err := store.Load(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, rec.Values, loaded.Values)
+	assert.True(t, rec.Created.Equal(loaded.Created))
+
+	_, err = store.Load(ctx, "../../etc/passwd")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	_, err = store.Save(ctx, "../escape", rec, time.Minute)
+	assert.Error(t, err)
+
+	_, err = store.Save(ctx, "other", rec, time.Hour)
+	require.NoError(t, err)
+	clock.advance(2 * time.Minute)
+	require.NoError(t, store.Cleanup())
+	_, err = os.Stat(filepath.Join(dir, "session_abc-123_x"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = store.Load(ctx, "other")
+	assert.NoError(t, err)
+
+	require.NoError(t, store.Delete(ctx, "other"))
+	_, err = store.Load(ctx, "other")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+}
@@ -0,0 +1,162 @@
+package hi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SlogConfig defines the config for SlogLogger middleware.
+type SlogConfig struct {
+	// Logger is where request records are emitted.
+	// Optional. Default value is slog.Default().
+	Logger *slog.Logger
+
+	// Message is the message of every request record.
+	// Optional. Default value is "request".
+	Message string
+
+	// Level returns the level of a request record from its status code.
+	// Optional. Default value is DefaultSlogLevel.
+	Level func(status int) slog.Level
+
+	// Keys lists the keys set on the request's context that are emitted as attributes.
+	// Optional.
+	Keys []string
+
+	// Attrs returns extra attributes extracted from the keys set on the request's context.
+	// Optional.
+	Attrs func(keys map[string]any) []slog.Attr
+
+	// SkipPaths is an url path array which logs are not written.
+	// Optional.
+	SkipPaths []string
+
+	// Skip is a Skipper that indicates which logs should not be written.
+	// Optional.
+	Skip Skipper
+}
+
+// DefaultSlogLevel logs server errors at slog.LevelError, client errors at
+// slog.LevelWarn and everything else at slog.LevelInfo.
+func DefaultSlogLevel(status int) slog.Level {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return slog.LevelError
+	case status >= http.StatusBadRequest:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// SlogLogger instances a Logger middleware that emits one structured record per request to logger.
+func SlogLogger[T IContext](logger *slog.Logger) HandlerFunc[T] {
+	return SlogLoggerWithConfig[T](SlogConfig{Logger: logger})
+}
+
+// SlogLoggerWithConfig instances a Logger middleware emitting structured records with config.
+//
+// Every record carries the method, the matched route template (FullPath), the path, the status
+// code, the latency, the response size, the client IP, the request ID and the private errors.
+func SlogLoggerWithConfig[T IContext](conf SlogConfig) HandlerFunc[T] {
+	logger := conf.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	message := conf.Message
+	if message == "" {
+		message = "request"
+	}
+	level := conf.Level
+	if level == nil {
+		level = DefaultSlogLevel
+	}
+
+	var skip map[string]struct{}
+	if length := len(conf.SkipPaths); length > 0 {
+		skip = make(map[string]struct{}, length)
+		for _, path := range conf.SkipPaths {
+			skip[path] = struct{}{}
+		}
+	}
+
+	return func(c T) {
+		start := time.Now()
+		req := c.Req()
+		path := req.URL.Path
+
+		c.Next()
+		if _, ok := skip[path]; ok || (conf.Skip != nil && conf.Skip(c)) {
+			return
+		}
+
+		status := c.Rsp().Status()
+		if errors.Is(req.Context().Err(), context.Canceled) {
+			status = StatusClientClosedRequest
+		}
+		lvl := level(status)
+		ctx := req.Context()
+		if !logger.Enabled(ctx, lvl) {
+			return
+		}
+
+		attrs := make([]slog.Attr, 0, 10+len(conf.Keys))
+		attrs = append(attrs,
+			slog.String("method", req.Method),
+			slog.String("route", c.GetExecer().FullPath()),
+			slog.String("path", path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.Int("bytes", c.Rsp().Size()),
+			slog.String("client_ip", clientIP(c, defaultRemoteIPHeaders)),
+		)
+		if query := req.URL.RawQuery; query != "" {
+			attrs = append(attrs, slog.String("query", query))
+		}
+		if id := GetRequestID(c); id != "" {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+		if errs := c.GetErrors().ByType(ErrorTypePrivate); len(errs) > 0 {
+			attrs = append(attrs, slog.Any("errors", errs.Errors()))
+		}
+		keys := c.GetKeys()
+		for _, key := range conf.Keys {
+			if value, ok := keys[key]; ok {
+				attrs = append(attrs, slog.Any(key, value))
+			}
+		}
+		if conf.Attrs != nil {
+			attrs = append(attrs, conf.Attrs(keys)...)
+		}
+
+		logger.LogAttrs(ctx, lvl, message, attrs...)
+	}
+}
+
+// DebugPrintToSlog routes the debug output (see DebugPrintFunc and DebugPrintRouteFunc) to h.
+// Warnings are emitted at slog.LevelWarn, everything else at slog.LevelInfo.
+func DebugPrintToSlog(h slog.Handler) {
+	logger := slog.New(h).With(slog.String("component", "hi-debug"))
+	DebugPrintFunc = func(format string, values ...any) {
+		msg := strings.TrimSpace(fmt.Sprintf(format, values...))
+		lvl := slog.LevelInfo
+		if warning, ok := strings.CutPrefix(msg, "[WARNING]"); ok {
+			msg = strings.TrimSpace(warning)
+			lvl = slog.LevelWarn
+		}
+		logger.Log(context.Background(), lvl, msg)
+	}
+	DebugPrintRouteFunc = func(httpMethod, absolutePath, handlerName string, nuHandlers int) {
+		logger.LogAttrs(context.Background(), slog.LevelInfo, "route",
+			slog.String("method", httpMethod),
+			slog.String("path", absolutePath),
+			slog.String("handler", handlerName),
+			slog.Int("handlers", nuHandlers),
+		)
+	}
+}
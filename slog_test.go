@@ -0,0 +1,141 @@
+package hi
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nbcx/hi/internal/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeSlogRecords(t *testing.T, buffer *bytes.Buffer) []map[string]any {
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		record := map[string]any{}
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestSlogLogger(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	logger := slog.New(slog.NewJSONHandler(buffer, nil))
+
+	router := New(&Context{})
+	router.Use(RequestID[*Context](), SlogLoggerWithConfig[*Context](SlogConfig{
+		Logger: logger,
+		Keys:   []string{AuthUserKey},
+		Attrs: func(keys map[string]any) []slog.Attr {
+			return []slog.Attr{slog.Int("keys", len(keys))}
+		},
+	}))
+	router.GET("/user/:id", func(c *Context) {
+		c.Set(AuthUserKey, "admin")
+		c.String(http.StatusOK, "ok")
+	})
+	router.GET("/fail", func(c *Context) {
+		c.Error(errors.New("boom")) //nolint: errcheck
+		c.Status(http.StatusInternalServerError)
+	})
+
+	PerformRequest(router, http.MethodGet, "/user/42?a=1", header{"X-Request-ID", "abc"})
+	PerformRequest(router, http.MethodGet, "/fail")
+	PerformRequest(router, http.MethodGet, "/missing")
+
+	records := decodeSlogRecords(t, buffer)
+	require.Len(t, records, 3)
+
+	assert.Equal(t, "INFO", records[0]["level"])
+	assert.Equal(t, "request", records[0]["msg"])
+	assert.Equal(t, "GET", records[0]["method"])
+	assert.Equal(t, "/user/:id", records[0]["route"])
+	assert.Equal(t, "/user/42", records[0]["path"])
+	assert.Equal(t, "a=1", records[0]["query"])
+	assert.InDelta(t, 200, records[0]["status"], 0)
+	assert.InDelta(t, 2, records[0]["bytes"], 0)
+	assert.Equal(t, "192.0.2.1", records[0]["client_ip"])
+	assert.Equal(t, "abc", records[0]["request_id"])
+	assert.Equal(t, "admin", records[0][AuthUserKey])
+	assert.InDelta(t, 2, records[0]["keys"], 0)
+	assert.Contains(t, records[0], "latency")
+
+	assert.Equal(t, "ERROR", records[1]["level"])
+	assert.Equal(t, []any{"boom"}, records[1]["errors"])
+
+	assert.Equal(t, "WARN", records[2]["level"])
+	assert.Equal(t, "", records[2]["route"])
+	assert.InDelta(t, 404, records[2]["status"], 0)
+}
+
+func TestSlogLoggerLevelAndSkip(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	logger := slog.New(slog.NewJSONHandler(buffer, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	router := New(&Context{})
+	router.Use(SlogLoggerWithConfig[*Context](SlogConfig{
+		Logger:    logger,
+		Message:   "http",
+		SkipPaths: []string{"/skipped"},
+		Level: func(status int) slog.Level {
+			if status == http.StatusNotFound {
+				return slog.LevelDebug
+			}
+			return slog.LevelWarn
+		},
+	}))
+	router.GET("/logged", func(c *Context) {})
+	router.GET("/skipped", func(c *Context) {})
+
+	PerformRequest(router, http.MethodGet, "/logged")
+	PerformRequest(router, http.MethodGet, "/skipped")
+	PerformRequest(router, http.MethodGet, "/missing")
+
+	records := decodeSlogRecords(t, buffer)
+	require.Len(t, records, 1)
+	assert.Equal(t, "http", records[0]["msg"])
+	assert.Equal(t, "/logged", records[0]["path"])
+}
+
+func TestDefaultSlogLevel(t *testing.T) {
+	assert.Equal(t, slog.LevelInfo, DefaultSlogLevel(http.StatusOK))
+	assert.Equal(t, slog.LevelInfo, DefaultSlogLevel(http.StatusFound))
+	assert.Equal(t, slog.LevelWarn, DefaultSlogLevel(http.StatusNotFound))
+	assert.Equal(t, slog.LevelError, DefaultSlogLevel(http.StatusBadGateway))
+}
+
+func TestDebugPrintToSlog(t *testing.T) {
+	defer func() {
+		DebugPrintFunc = nil
+		DebugPrintRouteFunc = nil
+	}()
+	SetMode(DebugMode)
+	defer SetMode(TestMode)
+
+	buffer := new(bytes.Buffer)
+	DebugPrintToSlog(slog.NewJSONHandler(buffer, nil))
+
+	debugPrint("Listening and serving HTTP on %s\n", ":8080")
+	debugPrint("[WARNING] Running in debug mode")
+	router := New(&Context{})
+	router.GET("/ping", func(c *Context) {})
+
+	records := decodeSlogRecords(t, buffer)
+	require.Len(t, records, 3)
+	assert.Equal(t, "Listening and serving HTTP on :8080", records[0]["msg"])
+	assert.Equal(t, "INFO", records[0]["level"])
+	assert.Equal(t, "hi-debug", records[0]["component"])
+	assert.Equal(t, "Running in debug mode", records[1]["msg"])
+	assert.Equal(t, "WARN", records[1]["level"])
+	assert.Equal(t, "route", records[2]["msg"])
+	assert.Equal(t, "/ping", records[2]["path"])
+	assert.InDelta(t, 1, records[2]["handlers"], 0)
+}
@@ -10,6 +10,7 @@ import "net/http"
 func CreateTestContext(w http.ResponseWriter) (c *Context, r *Engine[*Context]) {
 	r = New(&Context{})
 	c = r.allocateContext(&Context{})
+	c.SetExecer(NewExecer(c, nil))
 	c.Reset()
 	c.GetExecer().WriterMem().reset(w)
 	return
@@ -18,6 +19,7 @@ func CreateTestContext(w http.ResponseWriter) (c *Context, r *Engine[*Context])
 // CreateTestContextOnly returns a fresh context base on the engine for testing purposes
 func CreateTestContextOnly(w http.ResponseWriter, r *Engine[*Context]) (c *Context) {
 	c = r.allocateContext(&Context{})
+	c.SetExecer(NewExecer(c, nil))
 	c.Reset()
 	c.GetExecer().WriterMem().reset(w)
 	return
@@ -0,0 +1,216 @@
+package hi
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var defaultTimeoutBody = []byte("503 service unavailable")
+
+// TimeoutConfig defines the config for Timeout middleware.
+type TimeoutConfig struct {
+	// Timeout bounds the execution time of the remaining handlers in the chain.
+	Timeout time.Duration
+
+	// StatusCode is written when the handlers have not written a response by the deadline.
+	// Optional. Default value is http.StatusServiceUnavailable.
+	StatusCode int
+
+	// Body is written along with StatusCode.
+	// Optional. Default value is "503 service unavailable".
+	Body []byte
+
+	// ContentType is the Content-Type of Body.
+	// Optional. Default value is MIMEPlain.
+	ContentType string
+}
+
+// Timeout returns a middleware that bounds the execution time of the remaining handlers to
+// timeout, answering 503 if they have not written a response by then.
+func Timeout[T IContext](timeout time.Duration) HandlerFunc[T] {
+	return TimeoutWithConfig[T](TimeoutConfig{Timeout: timeout})
+}
+
+// TimeoutWithConfig returns a Timeout middleware with config.
+//
+// The handlers keep running on the request goroutine, cancellation is cooperative: the
+// derived context is exposed through Context.Done()/Context.Err() (or Execer.Context() for
+// custom contexts) and handlers are expected to return once it is done. Writes issued after
+// the timeout response has been sent are discarded and fail with http.ErrHandlerTimeout.
+// It can be attached to the engine, a group or a single route:
+//
+//	router.GET("/report", hi.Timeout[*hi.Context](5*time.Second), report)
+func TimeoutWithConfig[T IContext](conf TimeoutConfig) HandlerFunc[T] {
+	assert1(conf.Timeout > 0, "timeout must be greater than 0")
+	if conf.StatusCode == 0 {
+		conf.StatusCode = http.StatusServiceUnavailable
+	}
+	if conf.Body == nil {
+		conf.Body = defaultTimeoutBody
+	}
+	if conf.ContentType == "" {
+		conf.ContentType = MIMEPlain
+	}
+
+	return func(c T) {
+		exec := c.GetExecer()
+		prev := exec.Context()
+		parent := prev
+		if parent == nil {
+			parent = c.Req().Context()
+		}
+		ctx, cancel := context.WithDeadline(parent, time.Now().Add(conf.Timeout))
+		defer cancel()
+
+		rw := exec.WriterMem()
+		tw := &timeoutWriter{
+			ResponseWriter: rw.ResponseWriter,
+			h:              rw.ResponseWriter.Header().Clone(),
+			ctx:            ctx,
+			conf:           &conf,
+		}
+		if rw.Written() {
+			tw.wroteHeader = true
+		}
+		rw.ResponseWriter = tw
+
+		// The timeout response is sent once ctx expires, or by the first write issued
+		// after, so that handlers observing ctx.Done() can not get theirs in first.
+		stop := context.AfterFunc(ctx, tw.timeout)
+		defer stop()
+
+		exec.SetContext(ctx)
+		defer exec.SetContext(prev)
+		c.Next()
+
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		if tw.expire() {
+			// Reflect what was actually sent so Logger and friends report it, and keep tw
+			// installed so that writes from outer middleware are discarded as well.
+			rw.status = conf.StatusCode
+			rw.size = len(conf.Body)
+			return
+		}
+		if !tw.wroteHeader {
+			tw.commitHeader()
+		}
+		tw.closed = true
+		rw.ResponseWriter = tw.ResponseWriter
+	}
+}
+
+// timeoutWriter guards the underlying http.ResponseWriter so that the timeout
+// response and the handlers' writes never interleave. Handlers write headers
+// into h, which is only copied to the underlying writer once they commit.
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	conf        *TimeoutConfig
+	mu          sync.Mutex
+	h           http.Header
+	wroteHeader bool
+	timedOut    bool
+	closed      bool
+}
+
+var _ http.ResponseWriter = (*timeoutWriter)(nil)
+
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expire() || tw.wroteHeader {
+		return
+	}
+	tw.commitHeader()
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(data []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expire() {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.commitHeader()
+	}
+	return tw.ResponseWriter.Write(data)
+}
+
+// Flush implements the http.Flusher interface.
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expire() {
+		return
+	}
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements the http.Hijacker interface. A hijacked connection is no
+// longer answered by the timeout response.
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expire() {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	tw.wroteHeader = true
+	return tw.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// CloseNotify implements the http.CloseNotifier interface.
+func (tw *timeoutWriter) CloseNotify() <-chan bool {
+	return tw.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
+// commitHeader copies the handlers' headers to the underlying writer. It must
+// be called with mu held.
+func (tw *timeoutWriter) commitHeader() {
+	dst := tw.ResponseWriter.Header()
+	clear(dst)
+	for k, v := range tw.h {
+		dst[k] = v
+	}
+	tw.wroteHeader = true
+}
+
+func (tw *timeoutWriter) timeout() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.expire()
+}
+
+// expire sends the timeout response if the deadline has passed before the handlers wrote
+// theirs, and reports whether it has been sent. It must be called with mu held.
+func (tw *timeoutWriter) expire() bool {
+	if tw.timedOut {
+		return true
+	}
+	if tw.wroteHeader || tw.closed || !errors.Is(tw.ctx.Err(), context.DeadlineExceeded) {
+		return false
+	}
+	tw.timedOut = true
+	tw.ResponseWriter.Header().Set("Content-Type", tw.conf.ContentType)
+	tw.ResponseWriter.WriteHeader(tw.conf.StatusCode)
+	if _, err := tw.ResponseWriter.Write(tw.conf.Body); err != nil {
+		debugPrint("cannot write message to writer during timeout: %v", err)
+	}
+	return true
+}
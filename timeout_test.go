@@ -0,0 +1,121 @@
+package hi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeoutNotReached(t *testing.T) {
+	router := New(&Context{})
+	router.GET("/", Timeout[*Context](time.Second), func(c *Context) {
+		_, ok := c.Deadline()
+		assert.True(t, ok)
+		require.NoError(t, c.Err())
+		c.Header("X-Handler", "done")
+		c.String(http.StatusOK, "ok")
+	})
+
+	w := PerformRequest(router, http.MethodGet, "/")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+	assert.Equal(t, "done", w.Header().Get("X-Handler"))
+}
+
+func TestTimeoutKeepsUncommittedHeaders(t *testing.T) {
+	router := New(&Context{})
+	router.GET("/", Timeout[*Context](time.Second), func(c *Context) {
+		c.Header("X-Handler", "done")
+		c.Status(http.StatusNoContent)
+	})
+
+	w := PerformRequest(router, http.MethodGet, "/")
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "done", w.Header().Get("X-Handler"))
+}
+
+func TestTimeoutReached(t *testing.T) {
+	var status int
+	var writeErr error
+	router := New(&Context{})
+	router.Use(func(c *Context) {
+		c.Next()
+		status = c.Response.Status()
+	})
+	router.GET("/", Timeout[*Context](10*time.Millisecond), func(c *Context) {
+		<-c.Done()
+		assert.ErrorIs(t, c.Err(), context.DeadlineExceeded)
+		c.Header("X-Late", "1")
+		_, writeErr = c.Response.WriteString("late")
+	})
+
+	w := PerformRequest(router, http.MethodGet, "/")
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, string(defaultTimeoutBody), w.Body.String())
+	assert.Empty(t, w.Header().Get("X-Late"))
+	require.ErrorIs(t, writeErr, http.ErrHandlerTimeout)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+}
+
+func TestTimeoutDerivedContext(t *testing.T) {
+	type key struct{}
+	var valueErr, cancelErr error
+	router := New(&Context{})
+	router.GET("/", Timeout[*Context](10*time.Millisecond), func(c *Context) {
+		valueCtx := context.WithValue(c, key{}, "v")
+		cancelCtx, cancel := context.WithCancel(valueCtx)
+		defer cancel()
+		<-cancelCtx.Done()
+		valueErr, cancelErr = valueCtx.Err(), cancelCtx.Err()
+		c.String(http.StatusOK, "late")
+	})
+
+	w := PerformRequest(router, http.MethodGet, "/")
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, string(defaultTimeoutBody), w.Body.String())
+	require.ErrorIs(t, valueErr, context.DeadlineExceeded)
+	require.ErrorIs(t, cancelErr, context.DeadlineExceeded)
+}
+
+func TestTimeoutWithConfig(t *testing.T) {
+	router := New(&Context{})
+	router.GET("/", TimeoutWithConfig[*Context](TimeoutConfig{
+		Timeout:     10 * time.Millisecond,
+		StatusCode:  http.StatusGatewayTimeout,
+		Body:        []byte(`{"error":"timeout"}`),
+		ContentType: MIMEJSON,
+	}), func(c *Context) {
+		<-c.Done()
+	})
+
+	w := PerformRequest(router, http.MethodGet, "/")
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, `{"error":"timeout"}`, w.Body.String())
+	assert.Equal(t, MIMEJSON, w.Header().Get("Content-Type"))
+}
+
+func TestTimeoutAfterWrite(t *testing.T) {
+	router := New(&Context{})
+	router.GET("/", Timeout[*Context](10*time.Millisecond), func(c *Context) {
+		c.String(http.StatusOK, "early")
+		<-c.Done()
+	})
+
+	w := PerformRequest(router, http.MethodGet, "/")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "early", w.Body.String())
+}
+
+func TestTimeoutInvalid(t *testing.T) {
+	assert.Panics(t, func() { Timeout[*Context](0) })
+}
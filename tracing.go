@@ -0,0 +1,484 @@
+package hi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// W3C Trace Context headers.
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+// TraceKey is the key the tracing state of a request is stored under in the context.
+const TraceKey = "_hi/tracekey"
+
+// maxTraceStateLength bounds the propagated tracestate, as vendors must accept at least 512 chars.
+const maxTraceStateLength = 512
+
+// TraceID is a W3C trace-id.
+type TraceID [16]byte
+
+// IsValid reports whether id is not all zeros.
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// String returns the lowercase hex encoding of id.
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanID is a W3C parent-id.
+type SpanID [8]byte
+
+// IsValid reports whether id is not all zeros.
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// String returns the lowercase hex encoding of id.
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// TraceFlagsSampled is the sampled bit of the trace-flags.
+const TraceFlagsSampled byte = 0x01
+
+// SpanContext is the propagated part of a span.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+	// Remote is set when the span context was extracted from an incoming request.
+	Remote bool
+}
+
+// IsValid reports whether sc has a valid trace-id and span-id.
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// IsSampled reports whether the sampled flag is set.
+func (sc SpanContext) IsSampled() bool { return sc.Flags&TraceFlagsSampled != 0 }
+
+// TraceParent returns the traceparent header value of sc.
+func (sc SpanContext) TraceParent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceParent parses a traceparent header value. Versions newer than 00 are parsed as
+// version 00, as mandated by the specification; version ff is invalid.
+func ParseTraceParent(value string) (sc SpanContext, ok bool) {
+	const length = 55 // 2 + 1 + 32 + 1 + 16 + 1 + 2
+	if len(value) < length || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return sc, false
+	}
+	version, ok := decodeLowerHex(value[:2])
+	if !ok || version[0] == 0xff || (version[0] == 0 && len(value) != length) ||
+		(len(value) > length && value[length] != '-') {
+		return sc, false
+	}
+	traceID, ok1 := decodeLowerHex(value[3:35])
+	spanID, ok2 := decodeLowerHex(value[36:52])
+	flags, ok3 := decodeLowerHex(value[53:55])
+	if !ok1 || !ok2 || !ok3 {
+		return sc, false
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Flags = flags[0]
+	sc.Remote = true
+	return sc, sc.IsValid()
+}
+
+func decodeLowerHex(s string) ([]byte, bool) {
+	for i := 0; i < len(s); i++ {
+		if !('0' <= s[i] && s[i] <= '9' || 'a' <= s[i] && s[i] <= 'f') {
+			return nil, false
+		}
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
+
+// sanitizeTraceState drops a tracestate that is too long or has empty list members,
+// rather than propagating a malformed value.
+func sanitizeTraceState(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" || len(value) > maxTraceStateLength {
+		return ""
+	}
+	for _, member := range strings.Split(value, ",") {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+		key, val, found := strings.Cut(member, "=")
+		if !found || key == "" || val == "" {
+			return ""
+		}
+	}
+	return value
+}
+
+// Span is a unit of work of a trace.
+type Span interface {
+	// SpanContext returns the propagated part of the span.
+	SpanContext() SpanContext
+	// SetAttribute records an attribute on the span.
+	SetAttribute(key string, value any)
+	// RecordError records err on the span and marks it as failed.
+	RecordError(err error)
+	// End completes the span. Calls after the first one are ignored.
+	End()
+}
+
+// Tracer creates spans.
+type Tracer interface {
+	// Start creates a span named name, child of the span carried by ctx or, failing that, of the
+	// remote span context carried by ctx. The returned context carries the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+type spanContextKey struct{}
+
+type remoteSpanContextKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil if there is none.
+func SpanFromContext(ctx context.Context) Span {
+	span, _ := ctx.Value(spanContextKey{}).(Span)
+	return span
+}
+
+// ContextWithRemoteSpanContext returns a copy of ctx carrying sc as the remote parent of the
+// spans started from it.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteSpanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context of the span carried by ctx, or the remote
+// span context carried by ctx.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.SpanContext()
+	}
+	sc, _ := ctx.Value(remoteSpanContextKey{}).(SpanContext)
+	return sc
+}
+
+// InjectTraceContext sets the traceparent and tracestate headers of an outgoing request from
+// the span context carried by ctx.
+func InjectTraceContext(ctx context.Context, header http.Header) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	header.Set(TraceParentHeader, sc.TraceParent())
+	if sc.TraceState != "" {
+		header.Set(TraceStateHeader, sc.TraceState)
+	} else {
+		header.Del(TraceStateHeader)
+	}
+}
+
+// SpanData is a completed span, as handed to a SpanExporter.
+type SpanData struct {
+	Name        string
+	SpanContext SpanContext
+	Parent      SpanContext
+	Start       time.Time
+	End         time.Time
+	Attributes  map[string]any
+	Errors      []error
+}
+
+// SpanExporter receives the sampled spans once they end.
+type SpanExporter interface {
+	ExportSpan(span SpanData)
+}
+
+// NewTracer returns a Tracer generating random IDs and handing the sampled spans to exporter
+// when they end. A nil exporter drops them, the tracer then only propagates the trace context.
+// New traces are sampled, child spans inherit the sampled flag of their parent.
+func NewTracer(exporter SpanExporter) Tracer {
+	return &tracer{exporter: exporter}
+}
+
+type tracer struct {
+	exporter SpanExporter
+}
+
+func (t *tracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{Flags: TraceFlagsSampled}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.TraceState = parent.TraceState
+	} else {
+		parent = SpanContext{}
+		randomID(sc.TraceID[:])
+	}
+	randomID(sc.SpanID[:])
+
+	span := &recordingSpan{
+		tracer: t,
+		data: SpanData{
+			Name:        name,
+			SpanContext: sc,
+			Parent:      parent,
+			Start:       time.Now(),
+		},
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+func randomID(b []byte) {
+	for {
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+		for _, v := range b {
+			if v != 0 {
+				return
+			}
+		}
+	}
+}
+
+type recordingSpan struct {
+	tracer *tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+func (s *recordingSpan) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *recordingSpan) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]any)
+	}
+	s.data.Attributes[key] = value
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Errors = append(s.data.Errors, err)
+	}
+}
+
+func (s *recordingSpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	s.mu.Unlock()
+
+	if s.tracer.exporter != nil && s.data.SpanContext.IsSampled() {
+		s.tracer.exporter.ExportSpan(s.data)
+	}
+}
+
+// InMemoryExporter is a SpanExporter keeping the spans in memory, for tests and local debugging.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// ExportSpan implements the SpanExporter interface.
+func (e *InMemoryExporter) ExportSpan(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the exported spans, in the order they ended.
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Reset drops the exported spans.
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// TraceScope selects the optional child spans created by the Tracing middleware.
+type TraceScope uint8
+
+const (
+	// TraceMiddleware creates a span around each handler following Tracing in the chain.
+	TraceMiddleware TraceScope = 1 << iota
+	// TraceBinding creates a span around each binding of the request.
+	TraceBinding
+	// TraceRender creates a span around each rendering of the response.
+	TraceRender
+)
+
+// TracingConfig defines the config for Tracing middleware.
+type TracingConfig struct {
+	// Tracer creates the spans.
+	// Optional. Default value is NewTracer(nil), which propagates the trace context only.
+	Tracer Tracer
+
+	// SpanName returns the name of the request span.
+	// Optional. Default value is the method followed by the route template, e.g. "GET /users/:id".
+	SpanName func(c IContext) string
+
+	// Scopes selects the optional child spans.
+	// Optional. Default value is no child span.
+	Scopes TraceScope
+
+	// SkipPaths is an url path array which are not traced.
+	// Optional.
+	SkipPaths []string
+}
+
+type requestTrace struct {
+	tracer Tracer
+	scopes TraceScope
+}
+
+// Tracing returns a middleware that creates a span per request with tracer, continuing the
+// trace of an incoming traceparent header.
+func Tracing[T IContext](tracer Tracer) HandlerFunc[T] {
+	return TracingWithConfig[T](TracingConfig{Tracer: tracer})
+}
+
+// TracingWithConfig returns a Tracing middleware with config.
+//
+// The request span carries the standard HTTP attributes and the errors of the context. It is
+// installed in the context.Context of the request, so SpanFromContext(c) and
+// InjectTraceContext(c, header) work from the handlers.
+func TracingWithConfig[T IContext](conf TracingConfig) HandlerFunc[T] {
+	if conf.Tracer == nil {
+		conf.Tracer = NewTracer(nil)
+	}
+	if conf.SpanName == nil {
+		conf.SpanName = defaultSpanName
+	}
+	trace := &requestTrace{tracer: conf.Tracer, scopes: conf.Scopes}
+
+	var skip map[string]struct{}
+	if length := len(conf.SkipPaths); length > 0 {
+		skip = make(map[string]struct{}, length)
+		for _, path := range conf.SkipPaths {
+			skip[path] = struct{}{}
+		}
+	}
+
+	return func(c T) {
+		req := c.Req()
+		if _, ok := skip[req.URL.Path]; ok {
+			c.Next()
+			return
+		}
+
+		exec := c.GetExecer()
+		prev := exec.Context()
+		parent := prev
+		if parent == nil {
+			parent = req.Context()
+		}
+		if sc, ok := ParseTraceParent(req.Header.Get(TraceParentHeader)); ok {
+			sc.TraceState = sanitizeTraceState(req.Header.Get(TraceStateHeader))
+			parent = ContextWithRemoteSpanContext(parent, sc)
+		}
+
+		ctx, span := conf.Tracer.Start(parent, conf.SpanName(c))
+		span.SetAttribute("http.request.method", req.Method)
+		span.SetAttribute("url.path", req.URL.Path)
+		span.SetAttribute("client.address", clientIP(c, defaultRemoteIPHeaders))
+		if route := exec.FullPath(); route != "" {
+			span.SetAttribute("http.route", route)
+		}
+		if id := GetRequestID(c); id != "" {
+			span.SetAttribute(RequestIDKey, id)
+		}
+		exec.SetContext(ctx)
+		c.Set(TraceKey, trace)
+		if conf.Scopes&TraceMiddleware != 0 {
+			exec.SetHandlerObserver(trace.observeHandler(exec))
+		}
+		defer func() {
+			exec.SetHandlerObserver(nil)
+			exec.SetContext(prev)
+
+			status := c.Rsp().Status()
+			span.SetAttribute("http.response.status_code", status)
+			for _, err := range c.GetErrors() {
+				span.RecordError(err.Err)
+			}
+			if status >= http.StatusInternalServerError && len(c.GetErrors()) == 0 {
+				span.RecordError(errors.New(http.StatusText(status)))
+			}
+			span.End()
+		}()
+
+		c.Next()
+	}
+}
+
+func defaultSpanName(c IContext) string {
+	if route := c.GetExecer().FullPath(); route != "" {
+		return c.Req().Method + " " + route
+	}
+	return c.Req().Method
+}
+
+// observeHandler returns a HandlerObserver wrapping each handler in a child span of the
+// span of the handler calling it.
+func (t *requestTrace) observeHandler(exec Execer) HandlerObserver {
+	return func(index int, name string) func() {
+		prev := exec.Context()
+		ctx, span := t.tracer.Start(prev, name)
+		span.SetAttribute("hi.handler.index", index)
+		exec.SetContext(ctx)
+		return func() {
+			exec.SetContext(prev)
+			span.End()
+		}
+	}
+}
+
+// startTraceSpan starts a child span of the request span if the Tracing middleware enabled
+// scope. The returned function ends it, recording err; it is never nil.
+func startTraceSpan(c *Context, scope TraceScope, name string) func(err error) {
+	trace, _ := c.GetKeys()[TraceKey].(*requestTrace)
+	if trace == nil || trace.scopes&scope == 0 {
+		return func(error) {}
+	}
+	ctx := c.stdContext()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, span := trace.tracer.Start(ctx, name)
+	return func(err error) {
+		span.RecordError(err)
+		span.End()
+	}
+}
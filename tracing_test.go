@@ -0,0 +1,132 @@
+package hi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	sc, ok := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.IsSampled())
+	assert.True(t, sc.Remote)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.TraceParent())
+
+	_, ok = ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future")
+	assert.True(t, ok)
+
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7_01",
+	} {
+		_, ok := ParseTraceParent(value)
+		assert.False(t, ok, value)
+	}
+}
+
+func TestTracingContinuesIncomingTrace(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	router := New(&Context{})
+	router.Use(Tracing[*Context](NewTracer(exporter)))
+	router.GET("/users/:id", func(c *Context) {
+		header := http.Header{}
+		InjectTraceContext(c, header)
+		c.String(http.StatusOK, header.Get(TraceParentHeader)+" "+header.Get(TraceStateHeader))
+	})
+
+	w := PerformRequest(router, http.MethodGet, "/users/1",
+		header{TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		header{TraceStateHeader, "vendor=value"})
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "GET /users/:id", span.Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID.String())
+	assert.Equal(t, "vendor=value", span.SpanContext.TraceState)
+	assert.Equal(t, "/users/:id", span.Attributes["http.route"])
+	assert.Equal(t, http.StatusOK, span.Attributes["http.response.status_code"])
+	assert.Equal(t, span.SpanContext.TraceParent()+" vendor=value", w.Body.String())
+}
+
+func TestTracingNewTraceAndErrors(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	router := New(&Context{})
+	router.Use(Tracing[*Context](NewTracer(exporter)))
+	router.GET("/fail", func(c *Context) {
+		c.AbortWithError(http.StatusInternalServerError, errors.New("boom")) //nolint: errcheck
+	})
+
+	PerformRequest(router, http.MethodGet, "/fail", header{TraceParentHeader, "garbage"})
+	PerformRequest(router, http.MethodGet, "/missing")
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 2)
+	assert.True(t, spans[0].SpanContext.IsValid())
+	assert.False(t, spans[0].Parent.IsValid())
+	assert.EqualError(t, errors.Join(spans[0].Errors...), "boom")
+	assert.Equal(t, "GET", spans[1].Name)
+}
+
+func TestTracingUnsampledIsNotExported(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	router := New(&Context{})
+	router.Use(Tracing[*Context](NewTracer(exporter)))
+	router.GET("/", func(c *Context) {
+		assert.False(t, SpanContextFromContext(c).IsSampled())
+	})
+
+	PerformRequest(router, http.MethodGet, "/",
+		header{TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"})
+	assert.Empty(t, exporter.Spans())
+}
+
+func TestTracingChildSpans(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	router := New(&Context{})
+	router.Use(TracingWithConfig[*Context](TracingConfig{
+		Tracer: NewTracer(exporter),
+		Scopes: TraceMiddleware | TraceBinding | TraceRender,
+	}))
+	router.Use(func(c *Context) { c.Next() })
+	router.POST("/", func(c *Context) {
+		var obj struct {
+			Name string `json:"name"`
+		}
+		_ = c.ShouldBindJSON(&obj)
+		c.JSON(http.StatusOK, obj)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"hi"}`)))
+	assert.Equal(t, `{"name":"hi"}`, w.Body.String())
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 5)
+	byName := make(map[string]SpanData, len(spans))
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	request := spans[4]
+	assert.Equal(t, "POST /", request.Name)
+	middleware, handler := spans[3], spans[2]
+	assert.Equal(t, request.SpanContext.SpanID, middleware.Parent.SpanID)
+	assert.Equal(t, middleware.SpanContext.SpanID, handler.Parent.SpanID)
+	assert.Equal(t, 2, handler.Attributes["hi.handler.index"])
+	assert.Equal(t, handler.SpanContext.SpanID, byName["bind json"].Parent.SpanID)
+	assert.Equal(t, handler.SpanContext.SpanID, byName["render"].Parent.SpanID)
+}
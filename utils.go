@@ -5,8 +5,10 @@
 package hi
 
 import (
+	"bytes"
 	"encoding/xml"
 	"errors"
+	"io"
 	"net"
 	"net/http"
 	"os"
@@ -83,6 +85,33 @@ func assert1(guard bool, text string) {
 	}
 }
 
+// cachedBody reads the request body, at most limit bytes if limit is positive, and caches it
+// under BodyBytesKey, leaving it readable by the handlers and ShouldBindBodyWith. Larger
+// bodies fail with an *http.MaxBytesError.
+func cachedBody(c IContext, limit int64) ([]byte, error) {
+	if body, ok := c.GetKeys()[BodyBytesKey].([]byte); ok {
+		return body, nil
+	}
+	req := c.Req()
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	var r io.Reader = req.Body
+	if limit > 0 {
+		r = io.LimitReader(req.Body, limit+1)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && int64(len(body)) > limit {
+		return nil, &http.MaxBytesError{Limit: limit}
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	c.Set(BodyBytesKey, body)
+	return body, nil
+}
+
 func filterFlags(content string) string {
 	for i, char := range content {
 		if char == ' ' || char == ';' {
@@ -167,7 +196,9 @@ func isASCII(s string) bool {
 
 // todo: ClientIP() string // todo: 待移除
 // GetIP returns request real ip.
-
+//
+// ClientIP believes the X-Real-IP and X-Forward-For headers of any client, use it for display
+// only; Context.ClientIP and the middleware only believe them from the trusted proxies.
 func ClientIP(r *http.Request) (ip string) {
 	ip, _ = ClientIPE(r)
 	return
@@ -201,3 +232,29 @@ func ClientIPE(r *http.Request) (string, error) {
 
 	return "", errors.New("no valid ip found")
 }
+
+// defaultRemoteIPHeaders are the headers a trusted proxy reports the client IP in.
+var defaultRemoteIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+
+// clientIP returns the IP of the client of c: the address of the connection or, when it comes
+// from one of the Engine.SetTrustedProxies, the address reported in the first of headers that
+// holds one.
+func clientIP(c IContext, headers []string) string {
+	req := c.Req()
+	remote, _, err := net.SplitHostPort(strings.TrimSpace(req.RemoteAddr))
+	if err != nil {
+		return ""
+	}
+	if exec := c.GetExecer(); exec == nil || !exec.TrustedProxy() {
+		return remote
+	}
+	for _, header := range headers {
+		// the last address is the one the trusted proxy appended, those before it are the
+		// client's word
+		values := strings.Split(req.Header.Get(header), ",")
+		if ip := strings.TrimSpace(values[len(values)-1]); net.ParseIP(ip) != nil {
+			return ip
+		}
+	}
+	return remote
+}
@@ -0,0 +1,260 @@
+package hi
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Webhook verification errors, recorded in the context errors of the rejected requests.
+var (
+	ErrWebhookSignature = errors.New("webhook: invalid signature")
+	ErrWebhookTimestamp = errors.New("webhook: timestamp outside tolerance")
+)
+
+// DefaultWebhookMaxBodySize is the default maximum size of a verified webhook body.
+const DefaultWebhookMaxBodySize = 1 << 20
+
+// WebhookSignature is what a WebhookScheme extracts from a request: the HMAC signatures to
+// check and the message they sign.
+type WebhookSignature struct {
+	// Hash is the hash function of the HMAC.
+	Hash func() hash.Hash
+	// Message is the signed content, built from the body and the signed headers.
+	Message []byte
+	// Signatures are the candidate signatures, the request is valid if one of them matches.
+	Signatures [][]byte
+	// Timestamp is the signed time of the request, zero if the scheme is not timestamped.
+	Timestamp time.Time
+}
+
+// WebhookScheme parses the signature of a webhook request, see HMACWebhookScheme,
+// GitHubWebhookScheme, StripeWebhookScheme and SlackWebhookScheme.
+type WebhookScheme interface {
+	Parse(header http.Header, body []byte) (WebhookSignature, error)
+}
+
+// WebhookSchemeFunc is a function implementing WebhookScheme.
+type WebhookSchemeFunc func(header http.Header, body []byte) (WebhookSignature, error)
+
+// Parse implements the WebhookScheme interface.
+func (f WebhookSchemeFunc) Parse(header http.Header, body []byte) (WebhookSignature, error) {
+	return f(header, body)
+}
+
+// HMACWebhookScheme is a generic scheme with a hex signature in SignatureHeader, such as
+// "X-Signature: sha256=<hex>". With a TimestampHeader, the signed message is the Unix time
+// of the header, a dot and the body; it is the body alone otherwise.
+type HMACWebhookScheme struct {
+	// SignatureHeader holds the signature.
+	SignatureHeader string
+	// Prefix precedes the hex signature, such as "sha256=".
+	Prefix string
+	// TimestampHeader holds the Unix time of the request.
+	// Optional.
+	TimestampHeader string
+	// Hash is the hash function of the HMAC.
+	// Optional. Default value is sha256.New.
+	Hash func() hash.Hash
+}
+
+// Parse implements the WebhookScheme interface.
+func (s HMACWebhookScheme) Parse(header http.Header, body []byte) (WebhookSignature, error) {
+	sig := WebhookSignature{Hash: s.Hash, Message: body}
+	if sig.Hash == nil {
+		sig.Hash = sha256.New
+	}
+	if s.TimestampHeader != "" {
+		ts := header.Get(s.TimestampHeader)
+		t, err := parseUnixTimestamp(ts)
+		if err != nil {
+			return sig, err
+		}
+		sig.Timestamp = t
+		sig.Message = append([]byte(ts+"."), body...)
+	}
+	mac, err := decodeHexSignature(header.Get(s.SignatureHeader), s.Prefix)
+	if err != nil {
+		return sig, err
+	}
+	sig.Signatures = [][]byte{mac}
+	return sig, nil
+}
+
+// GitHubWebhookScheme verifies the X-Hub-Signature-256 header of GitHub webhooks.
+var GitHubWebhookScheme WebhookScheme = HMACWebhookScheme{SignatureHeader: "X-Hub-Signature-256", Prefix: "sha256="}
+
+// StripeWebhookScheme verifies the Stripe-Signature header of Stripe webhooks, holding the
+// timestamp and one or more v1 signatures of the timestamp, a dot and the body.
+var StripeWebhookScheme WebhookScheme = WebhookSchemeFunc(func(header http.Header, body []byte) (WebhookSignature, error) {
+	sig := WebhookSignature{Hash: sha256.New}
+	var ts string
+	for _, item := range strings.Split(header.Get("Stripe-Signature"), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(item), "=")
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			if mac, err := hex.DecodeString(value); err == nil {
+				sig.Signatures = append(sig.Signatures, mac)
+			}
+		}
+	}
+	t, err := parseUnixTimestamp(ts)
+	if err != nil {
+		return sig, err
+	}
+	if len(sig.Signatures) == 0 {
+		return sig, ErrWebhookSignature
+	}
+	sig.Timestamp = t
+	sig.Message = append([]byte(ts+"."), body...)
+	return sig, nil
+})
+
+// SlackWebhookScheme verifies the X-Slack-Signature header of Slack requests, signing
+// "v0:", the X-Slack-Request-Timestamp header, a colon and the body.
+var SlackWebhookScheme WebhookScheme = WebhookSchemeFunc(func(header http.Header, body []byte) (WebhookSignature, error) {
+	sig := WebhookSignature{Hash: sha256.New}
+	ts := header.Get("X-Slack-Request-Timestamp")
+	t, err := parseUnixTimestamp(ts)
+	if err != nil {
+		return sig, err
+	}
+	mac, err := decodeHexSignature(header.Get("X-Slack-Signature"), "v0=")
+	if err != nil {
+		return sig, err
+	}
+	sig.Timestamp = t
+	sig.Message = append([]byte("v0:"+ts+":"), body...)
+	sig.Signatures = [][]byte{mac}
+	return sig, nil
+})
+
+func parseUnixTimestamp(ts string) (time.Time, error) {
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrWebhookTimestamp
+	}
+	return time.Unix(sec, 0), nil
+}
+
+func decodeHexSignature(value, prefix string) ([]byte, error) {
+	value, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return nil, ErrWebhookSignature
+	}
+	mac, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, ErrWebhookSignature
+	}
+	return mac, nil
+}
+
+// WebhookConfig defines the config for VerifyWebhook middleware.
+type WebhookConfig struct {
+	// Scheme parses the signatures.
+	Scheme WebhookScheme
+
+	// Secrets are the HMAC keys, a signature made with any of them is valid so that secrets
+	// can be rotated.
+	Secrets [][]byte
+
+	// Tolerance is the maximum difference between the signed timestamp and the server clock,
+	// for timestamped schemes. Negative disables the check.
+	// Optional. Default value is 5 minutes.
+	Tolerance time.Duration
+
+	// MaxBodySize is the maximum size of the body, larger requests are rejected with 413.
+	// Optional. Default value is DefaultWebhookMaxBodySize.
+	MaxBodySize int64
+
+	// Failed answers the requests failing verification.
+	// Optional. Default value aborts with status 401.
+	Failed func(c IContext, err error)
+}
+
+// VerifyWebhook returns a middleware verifying the HMAC signature of webhook requests with
+// secret.
+func VerifyWebhook[T IContext](scheme WebhookScheme, secret []byte) HandlerFunc[T] {
+	return VerifyWebhookWithConfig[T](WebhookConfig{Scheme: scheme, Secrets: [][]byte{secret}})
+}
+
+// VerifyWebhookWithConfig returns a VerifyWebhook middleware with config.
+//
+// The raw body is verified, then cached under BodyBytesKey and left readable, so that the
+// handlers can still bind it, with ShouldBindBodyWith in particular.
+func VerifyWebhookWithConfig[T IContext](conf WebhookConfig) HandlerFunc[T] {
+	assert1(conf.Scheme != nil, "webhook scheme can not be nil")
+	assert1(len(conf.Secrets) > 0, "webhook secrets can not be empty")
+	for _, secret := range conf.Secrets {
+		assert1(len(secret) > 0, "webhook secret can not be empty")
+	}
+	if conf.Tolerance == 0 {
+		conf.Tolerance = 5 * time.Minute
+	}
+	if conf.MaxBodySize <= 0 {
+		conf.MaxBodySize = DefaultWebhookMaxBodySize
+	}
+	if conf.Failed == nil {
+		conf.Failed = defaultWebhookFailed
+	}
+
+	return func(c T) {
+		body, err := cachedBody(c, conf.MaxBodySize)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				_ = c.Error(err)
+				c.GetExecer().AbortWithStatus(http.StatusRequestEntityTooLarge)
+				return
+			}
+			conf.Failed(c, err)
+			return
+		}
+
+		sig, err := conf.Scheme.Parse(c.Req().Header, body)
+		if err == nil {
+			err = verifyWebhookSignature(sig, conf.Secrets)
+		}
+		if err == nil && !sig.Timestamp.IsZero() && conf.Tolerance > 0 {
+			if skew := time.Since(sig.Timestamp); skew > conf.Tolerance || skew < -conf.Tolerance {
+				err = ErrWebhookTimestamp
+			}
+		}
+		if err != nil {
+			conf.Failed(c, err)
+		}
+	}
+}
+
+// verifyWebhookSignature checks every candidate signature against every secret, so that the
+// time taken does not reveal which one matched.
+func verifyWebhookSignature(sig WebhookSignature, secrets [][]byte) error {
+	valid := false
+	for _, secret := range secrets {
+		mac := hmac.New(sig.Hash, secret)
+		mac.Write(sig.Message)
+		expected := mac.Sum(nil)
+		for _, candidate := range sig.Signatures {
+			if hmac.Equal(expected, candidate) {
+				valid = true
+			}
+		}
+	}
+	if !valid {
+		return ErrWebhookSignature
+	}
+	return nil
+}
+
+func defaultWebhookFailed(c IContext, err error) {
+	_ = c.Error(err)
+	c.GetExecer().AbortWithStatus(http.StatusUnauthorized)
+}
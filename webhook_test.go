@@ -0,0 +1,112 @@
+package hi
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func hmacHex(secret, message string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookRouter(conf WebhookConfig) *Engine[*Context] {
+	router := New(&Context{})
+	router.POST("/hook", VerifyWebhookWithConfig[*Context](conf), func(c *Context) {
+		var event struct{ Type string }
+		if err := c.ShouldBindBodyWithJSON(&event); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.String(http.StatusOK, event.Type)
+	})
+	return router
+}
+
+func postWebhook(router *Engine[*Context], body string, headers ...header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(body))
+	req.Header.Set("Content-Type", MIMEJSON)
+	for _, h := range headers {
+		req.Header.Set(h.Key, h.Value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestVerifyWebhookHMAC(t *testing.T) {
+	router := webhookRouter(WebhookConfig{
+		Scheme:  HMACWebhookScheme{SignatureHeader: "X-Signature", Prefix: "sha256=", TimestampHeader: "X-Timestamp"},
+		Secrets: [][]byte{[]byte("old"), []byte("new")},
+	})
+	body := `{"Type":"push"}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	for _, secret := range []string{"old", "new"} {
+		w := postWebhook(router, body,
+			header{"X-Timestamp", now},
+			header{"X-Signature", "sha256=" + hmacHex(secret, now+"."+body)})
+		assert.Equal(t, http.StatusOK, w.Code, secret)
+		assert.Equal(t, "push", w.Body.String())
+	}
+
+	w := postWebhook(router, body,
+		header{"X-Timestamp", now},
+		header{"X-Signature", "sha256=" + hmacHex("wrong", now+"."+body)})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = postWebhook(router, `{"Type":"delete"}`,
+		header{"X-Timestamp", now},
+		header{"X-Signature", "sha256=" + hmacHex("new", now+"."+body)})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// a replayed request is outside the tolerance
+	old := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	w = postWebhook(router, body,
+		header{"X-Timestamp", old},
+		header{"X-Signature", "sha256=" + hmacHex("new", old+"."+body)})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = postWebhook(router, body, header{"X-Signature", "sha256=" + hmacHex("new", body)})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestVerifyWebhookProviders(t *testing.T) {
+	body := `{"Type":"event"}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	router := webhookRouter(WebhookConfig{Scheme: GitHubWebhookScheme, Secrets: [][]byte{[]byte("s")}})
+	w := postWebhook(router, body, header{"X-Hub-Signature-256", "sha256=" + hmacHex("s", body)})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	router = webhookRouter(WebhookConfig{Scheme: StripeWebhookScheme, Secrets: [][]byte{[]byte("s")}})
+	w = postWebhook(router, body,
+		header{"Stripe-Signature", "t=" + now + ",v1=" + hmacHex("other", now+"."+body) + ",v1=" + hmacHex("s", now+"."+body)})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	router = webhookRouter(WebhookConfig{Scheme: SlackWebhookScheme, Secrets: [][]byte{[]byte("s")}})
+	w = postWebhook(router, body,
+		header{"X-Slack-Request-Timestamp", now},
+		header{"X-Slack-Signature", "v0=" + hmacHex("s", "v0:"+now+":"+body)})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestVerifyWebhookBodySize(t *testing.T) {
+	router := webhookRouter(WebhookConfig{Scheme: GitHubWebhookScheme, Secrets: [][]byte{[]byte("s")}, MaxBodySize: 8})
+	body := `{"Type":"too large"}`
+	w := postWebhook(router, body, header{"X-Hub-Signature-256", "sha256=" + hmacHex("s", body)})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	assert.Panics(t, func() { VerifyWebhook[*Context](GitHubWebhookScheme, nil) })
+	assert.Panics(t, func() { VerifyWebhookWithConfig[*Context](WebhookConfig{Scheme: GitHubWebhookScheme}) })
+}